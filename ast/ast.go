@@ -46,18 +46,35 @@ func (p *Program) String() string {
 }
 
 type LetStatement struct {
-	Token token.Token // The token.LET token
+	Token token.Token // The token.LET or token.CONST token
 	Name  *Identifier
-	Value Expression
+	// Set instead of Name when destructuring, as in let [a, b] = pair
+	Pattern Pattern
+	Value   Expression
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) IsConst() bool        { return ls.Token.Type == token.CONST }
+
+// Bindings returns the names the statement declares.
+func (ls *LetStatement) Bindings() []*Identifier {
+	if ls.Pattern != nil {
+		return PatternBindings(ls.Pattern)
+	}
+
+	return []*Identifier{ls.Name}
+}
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -69,12 +86,90 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// FunctionStatement declares a named function, fn name(params) {...}. The
+// name is bound before the rest of the enclosing block runs, so declarations
+// can refer to each other regardless of their order.
+type FunctionStatement struct {
+	Token    token.Token // The fn token
+	Name     *Identifier
+	Function *FunctionLiteral
+}
+
+func (fs *FunctionStatement) statementNode()       {}
+func (fs *FunctionStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *FunctionStatement) String() string       { return fs.Function.String() }
+
+// StructStatement declares a record type with a fixed set of fields, and
+// binds its name to a constructor taking the fields in order.
+type StructStatement struct {
+	Token  token.Token // The struct token
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) String() string {
+	if len(ss.Fields) == 0 {
+		return "struct " + ss.Name.String() + " {}"
+	}
+
+	fields := []string{}
+	for _, f := range ss.Fields {
+		fields = append(fields, f.String())
+	}
+
+	return "struct " + ss.Name.String() + " { " + strings.Join(fields, ", ") + " }"
+}
+
+type ImportStatement struct {
+	Token token.Token // The import token
+	Path  *StringLiteral
+	Alias *Identifier
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	return "import \"" + is.Path.Value + "\" as " + is.Alias.String()
+}
+
+// ExportStatement makes the name declared by a top-level let, const or fn
+// statement accessible to files that import the module.
+type ExportStatement struct {
+	Token     token.Token // The export token
+	Statement Statement   // A *LetStatement, *FunctionStatement or *StructStatement
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) String() string       { return "export " + es.Statement.String() }
+
+// Names returns the names the exported statement declares.
+func (es *ExportStatement) Names() []string {
+	switch stmt := es.Statement.(type) {
+	case *LetStatement:
+		names := []string{}
+		for _, ident := range stmt.Bindings() {
+			names = append(names, ident.Value)
+		}
+		return names
+	case *FunctionStatement:
+		return []string{stmt.Name.Value}
+	case *StructStatement:
+		return []string{stmt.Name.Value}
+	}
+
+	return nil
+}
+
 type Identifier struct {
 	Token token.Token // The token.IDENT token
 	Value string
 }
 
 func (i *Identifier) expressionNode()      {}
+func (i *Identifier) patternNode()         {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 func (i *Identifier) String() string {
 	return i.Value
@@ -101,6 +196,27 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+type ThrowStatement struct {
+	Token token.Token // The token.THROW token, either throw or raise
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral() + " ")
+
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
 type ExpressionStatement struct {
 	Token      token.Token // The first token of the expression
 	Expression Expression
@@ -164,6 +280,52 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// ComparisonChain is a chain of ordering comparisons such as a < b <= c,
+// which holds when every adjacent pair holds, like in Python. Each operand is
+// evaluated at most once, and evaluation stops at the first pair that fails.
+type ComparisonChain struct {
+	Token     token.Token // The first operator token
+	Operands  []Expression
+	Operators []string // Operators[i] compares Operands[i] with Operands[i+1]
+}
+
+func (cc *ComparisonChain) expressionNode()      {}
+func (cc *ComparisonChain) TokenLiteral() string { return cc.Token.Literal }
+func (cc *ComparisonChain) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(cc.Operands[0].String())
+	for i, operator := range cc.Operators {
+		out.WriteString(" " + operator + " ")
+		out.WriteString(cc.Operands[i+1].String())
+	}
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// RangeExpression is start..end, or start..=end to include end, optionally
+// followed by by step.
+type RangeExpression struct {
+	Token     token.Token // The .. or ..= token
+	Start     Expression
+	End       Expression
+	Step      Expression // May be nil
+	Inclusive bool
+}
+
+func (re *RangeExpression) expressionNode()      {}
+func (re *RangeExpression) TokenLiteral() string { return re.Token.Literal }
+func (re *RangeExpression) String() string {
+	out := "(" + re.Start.String() + re.Token.Literal + re.End.String()
+	if re.Step != nil {
+		out += " by " + re.Step.String()
+	}
+
+	return out + ")"
+}
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -173,6 +335,14 @@ func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
+type NullLiteral struct {
+	Token token.Token
+}
+
+func (nl *NullLiteral) expressionNode()      {}
+func (nl *NullLiteral) TokenLiteral() string { return nl.Token.Literal }
+func (nl *NullLiteral) String() string       { return nl.Token.Literal }
+
 type IfExpression struct {
 	Token        token.Token // The if token
 	Condition    Expression
@@ -206,6 +376,21 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// ConditionalExpression is the inline conditional cond ? a : b. Only the
+// branch selected by the condition is evaluated.
+type ConditionalExpression struct {
+	Token       token.Token // The ? token
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+func (ce *ConditionalExpression) expressionNode()      {}
+func (ce *ConditionalExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *ConditionalExpression) String() string {
+	return "(" + ce.Condition.String() + " ? " + ce.Consequence.String() + " : " + ce.Alternative.String() + ")"
+}
+
 type ElifExpression struct {
 	Token       token.Token // The elif token
 	Condition   Expression
@@ -243,35 +428,117 @@ func (bs *BlockStatement) String() string {
 	return out.String()
 }
 
+type TryExpression struct {
+	Token          token.Token // The try token
+	Body           *BlockStatement
+	CatchParameter *Identifier     // nil when the caught error is not bound, as in catch { }
+	Catch          *BlockStatement // nil when there is no catch block
+	Finally        *BlockStatement // nil when there is no finally block
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try { ")
+	out.WriteString(te.Body.String())
+	out.WriteString(" }")
+
+	if te.Catch != nil {
+		out.WriteString(" catch ")
+		if te.CatchParameter != nil {
+			out.WriteString("(" + te.CatchParameter.String() + ") ")
+		}
+		out.WriteString("{ ")
+		out.WriteString(te.Catch.String())
+		out.WriteString(" }")
+	}
+
+	if te.Finally != nil {
+		out.WriteString(" finally { ")
+		out.WriteString(te.Finally.String())
+		out.WriteString(" }")
+	}
+
+	return out.String()
+}
+
 type FunctionLiteral struct {
-	Token      token.Token // The fn token
+	Token      token.Token // The fn token, or the opening | of a lambda
+	Name       string      // Set for declarations such as fn add(a, b) {...}, empty otherwise
 	Parameters []*Identifier
+	Defaults   map[string]Expression // Default values of optional parameters, by name
+	Rest       *Identifier           // Collects extra arguments, as in fn(a, ...rest). May be nil
 	Body       *BlockStatement
+	Generator  bool // Set when the body yields, so that calls return an iterator
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+
+// IsLambda reports whether the function was written in the |x| x * 2
+// shorthand, whose body is a single implicitly returned expression.
+func (fl *FunctionLiteral) IsLambda() bool { return fl.Token.Type == token.PIPE }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	if fl.IsLambda() {
+		out.WriteString("|")
+		out.WriteString(ParametersString(fl.Parameters, fl.Defaults, fl.Rest))
+		out.WriteString("| ")
+
+		// The parser wraps a lambda's expression in a return statement, but a
+		// lambda built any other way is printed with its whole body
+		if fl.Body != nil && len(fl.Body.Statements) == 1 {
+			if ret, ok := fl.Body.Statements[0].(*ReturnStatement); ok && ret.ReturnValue != nil {
+				out.WriteString(ret.ReturnValue.String())
+				return out.String()
+			}
+		}
+		if fl.Body != nil {
+			out.WriteString(fl.Body.String())
+		}
+
+		return out.String()
 	}
 
 	out.WriteString(fl.TokenLiteral())
-	out.WriteString("()")
-	out.WriteString(strings.Join(params, ", "))
+	if fl.Name != "" {
+		out.WriteString(" " + fl.Name)
+	}
+	out.WriteString("(")
+	out.WriteString(ParametersString(fl.Parameters, fl.Defaults, fl.Rest))
 	out.WriteString(") ")
 	out.WriteString(fl.Body.String())
 
 	return out.String()
 }
 
+// ParametersString formats a parameter list as it would be written in source,
+// without the surrounding parentheses.
+func ParametersString(params []*Identifier, defaults map[string]Expression, rest *Identifier) string {
+	parts := []string{}
+	for _, p := range params {
+		if def, ok := defaults[p.Value]; ok {
+			parts = append(parts, p.String()+" = "+def.String())
+		} else {
+			parts = append(parts, p.String())
+		}
+	}
+
+	if rest != nil {
+		parts = append(parts, "..."+rest.String())
+	}
+
+	return strings.Join(parts, ", ")
+}
+
 type CallExpression struct {
 	Token     token.Token // The '(' token
 	Function  Expression  // Identifier or FunctinLiteral
 	Arguments []Expression
+	Optional  bool // f?.(x), evaluates to null instead of calling when f is null
 }
 
 func (ce *CallExpression) expressionNode()      {}
@@ -285,6 +552,9 @@ func (ce *CallExpression) String() string {
 	}
 
 	out.WriteString(ce.Function.String())
+	if ce.Optional {
+		out.WriteString("?.")
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(args, ", "))
 	out.WriteString(")")
@@ -292,6 +562,54 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+type SpreadExpression struct {
+	Token token.Token // The ... token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) String() string       { return "..." + se.Value.String() }
+
+type KeywordArgument struct {
+	Token token.Token // The token of the parameter name
+	Name  *Identifier
+	Value Expression
+}
+
+func (ka *KeywordArgument) expressionNode()      {}
+func (ka *KeywordArgument) TokenLiteral() string { return ka.Token.Literal }
+func (ka *KeywordArgument) String() string       { return ka.Name.String() + " = " + ka.Value.String() }
+
+type MemberExpression struct {
+	Token    token.Token // The . or ?. token
+	Object   Expression
+	Property *Identifier
+	Optional bool // a?.b, evaluates to null when a is null or a hash without key b
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	op := "."
+	if me.Optional {
+		op = "?."
+	}
+	return "(" + me.Object.String() + op + me.Property.String() + ")"
+}
+
+// OptionalChain is a chain of postfix links containing at least one optional
+// link, as in a?.[k][j]. An optional link that short-circuits skips the rest
+// of the chain, which then evaluates to null.
+type OptionalChain struct {
+	Token      token.Token // The first ?. token
+	Expression Expression  // The outermost link of the chain
+}
+
+func (oc *OptionalChain) expressionNode()      {}
+func (oc *OptionalChain) TokenLiteral() string { return oc.Token.Literal }
+func (oc *OptionalChain) String() string       { return oc.Expression.String() }
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -324,9 +642,10 @@ func (al *ArrayLiteral) String() string {
 }
 
 type IndexExpression struct {
-	Token token.Token // The [ token
-	Left  Expression
-	Index Expression
+	Token    token.Token // The [ token
+	Left     Expression
+	Index    Expression
+	Optional bool // a?.[k], evaluates to null when a is null or k is missing
 }
 
 func (ie *IndexExpression) expressionNode()      {}
@@ -336,6 +655,9 @@ func (ie *IndexExpression) String() string {
 
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
+	if ie.Optional {
+		out.WriteString("?.")
+	}
 	out.WriteString("[")
 	out.WriteString(ie.Index.String())
 	out.WriteString("])")
@@ -343,6 +665,43 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+type SliceExpression struct {
+	Token token.Token // The [ token
+	Left  Expression
+	Start Expression // nil when omitted, as in a[:2]
+	End   Expression // nil when omitted, as in a[1:]
+	Step  Expression // nil when omitted, as in a[1:2]
+
+	Optional bool // a?.[1:2], evaluates to null when a is null
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	if se.Optional {
+		out.WriteString("?.")
+	}
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	if se.Step != nil {
+		out.WriteString(":")
+		out.WriteString(se.Step.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
 type HashLiteral struct {
 	Token token.Token // the '{' token
 	Pairs map[Expression]Expression
@@ -385,3 +744,201 @@ func (ae *AssignmentExpression) String() string {
 
 	return out.String()
 }
+
+// Pattern is the left-hand side of a match arm. Identifiers in a pattern bind
+// the part of the value they match.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// WildcardPattern is _, which matches anything without binding it
+type WildcardPattern struct {
+	Token token.Token // The _ token
+}
+
+func (wp *WildcardPattern) patternNode()         {}
+func (wp *WildcardPattern) TokenLiteral() string { return wp.Token.Literal }
+func (wp *WildcardPattern) String() string       { return "_" }
+
+// LiteralPattern matches values equal to an integer, string, boolean or null
+// literal.
+type LiteralPattern struct {
+	Token token.Token // The first token of the literal
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Token.Literal }
+func (lp *LiteralPattern) String() string       { return lp.Value.String() }
+
+// ArrayPattern matches arrays element by element. Without a rest pattern the
+// array must have exactly as many elements as the pattern.
+type ArrayPattern struct {
+	Token    token.Token // The [ token
+	Elements []Pattern
+	Rest     *Identifier // Binds the remaining elements, as in [head, ...tail]. May be nil
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashPattern matches hashes that have every key of the pattern, with values
+// that match the corresponding patterns. Other keys are ignored.
+type HashPattern struct {
+	Token  token.Token // The { token
+	Keys   []Expression
+	Values []Pattern
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for i, key := range hp.Keys {
+		pairs = append(pairs, key.String()+": "+hp.Values[i].String())
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// PatternBindings returns the identifiers a pattern binds, in source order.
+func PatternBindings(pattern Pattern) []*Identifier {
+	switch pattern := pattern.(type) {
+	case *Identifier:
+		return []*Identifier{pattern}
+	case *ArrayPattern:
+		bindings := []*Identifier{}
+		for _, el := range pattern.Elements {
+			bindings = append(bindings, PatternBindings(el)...)
+		}
+		if pattern.Rest != nil {
+			bindings = append(bindings, pattern.Rest)
+		}
+		return bindings
+	case *HashPattern:
+		bindings := []*Identifier{}
+		for _, value := range pattern.Values {
+			bindings = append(bindings, PatternBindings(value)...)
+		}
+		return bindings
+	default:
+		return nil
+	}
+}
+
+// YieldExpression hands a value to the caller of a generator and suspends it
+// until the next value is requested. It evaluates to null.
+type YieldExpression struct {
+	Token token.Token // The yield token
+	Value Expression
+}
+
+func (ye *YieldExpression) expressionNode()      {}
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) String() string {
+	return "yield " + ye.Value.String()
+}
+
+type MatchExpression struct {
+	Token   token.Token // The match token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	return "match (" + me.Subject.String() + ") { " + strings.Join(arms, ", ") + " }"
+}
+
+// MatchArm is pattern => body, or pattern if guard => body. The body is
+// either a *BlockStatement or an Expression.
+type MatchArm struct {
+	Token   token.Token // The => token
+	Pattern Pattern
+	Guard   Expression // May be nil
+	Body    Node
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if " + ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	if _, ok := ma.Body.(*BlockStatement); ok {
+		out.WriteString("{ " + ma.Body.String() + " }")
+	} else {
+		out.WriteString(ma.Body.String())
+	}
+
+	return out.String()
+}
+
+// ComprehensionClause is the for part of a comprehension, as in
+// for x in xs if x > 0. The condition may be nil.
+type ComprehensionClause struct {
+	Token     token.Token // The for token
+	Target    Pattern
+	Iterable  Expression
+	Condition Expression
+}
+
+func (cc *ComprehensionClause) TokenLiteral() string { return cc.Token.Literal }
+func (cc *ComprehensionClause) String() string {
+	out := "for " + cc.Target.String() + " in " + cc.Iterable.String()
+	if cc.Condition != nil {
+		out += " if " + cc.Condition.String()
+	}
+
+	return out
+}
+
+// ArrayComprehension builds an array from an iterable, as in
+// [x * 2 for x in xs if x > 0].
+type ArrayComprehension struct {
+	Token   token.Token // The [ token
+	Element Expression
+	Clause  *ComprehensionClause
+}
+
+func (ac *ArrayComprehension) expressionNode()      {}
+func (ac *ArrayComprehension) TokenLiteral() string { return ac.Token.Literal }
+func (ac *ArrayComprehension) String() string {
+	return "[" + ac.Element.String() + " " + ac.Clause.String() + "]"
+}
+
+// HashComprehension builds a hash from an iterable, as in
+// {k: v for k, v in items(h)}.
+type HashComprehension struct {
+	Token  token.Token // The { token
+	Key    Expression
+	Value  Expression
+	Clause *ComprehensionClause
+}
+
+func (hc *HashComprehension) expressionNode()      {}
+func (hc *HashComprehension) TokenLiteral() string { return hc.Token.Literal }
+func (hc *HashComprehension) String() string {
+	return "{" + hc.Key.String() + ": " + hc.Value.String() + " " + hc.Clause.String() + "}"
+}
@@ -24,3 +24,34 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestLambdaString(t *testing.T) {
+	pipe := token.Token{Type: token.PIPE, Literal: "|"}
+	x := &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"}
+
+	tests := []struct {
+		lambda   *FunctionLiteral
+		expected string
+	}{
+		{
+			&FunctionLiteral{Token: pipe, Parameters: []*Identifier{x}, Body: &BlockStatement{
+				Statements: []Statement{&ReturnStatement{ReturnValue: x}},
+			}},
+			"|x| x",
+		},
+		{
+			&FunctionLiteral{Token: pipe, Parameters: []*Identifier{x}, Body: &BlockStatement{
+				Statements: []Statement{&ExpressionStatement{Expression: x}},
+			}},
+			"|x| x",
+		},
+		{&FunctionLiteral{Token: pipe, Body: &BlockStatement{}}, "|| "},
+		{&FunctionLiteral{Token: pipe}, "|| "},
+	}
+
+	for _, tt := range tests {
+		if tt.lambda.String() != tt.expected {
+			t.Errorf("lambda.String() wrong. expected=%q, got=%q", tt.expected, tt.lambda.String())
+		}
+	}
+}
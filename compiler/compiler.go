@@ -5,23 +5,81 @@ import (
 	"seville/ast"
 	"seville/object"
 	"seville/opcode"
+	"seville/token"
+	"sort"
+	"strings"
 )
 
 type Compiler struct {
+	scopes     []CompilationScope
+	scopeIndex int
+
+	symbolTable *SymbolTable
+
+	// exports holds the names exported by the program, which is a module
+	// when it is imported
+	exports []string
+}
+
+// CompilationScope holds the code of the function being compiled, which has
+// constants of its own.
+type CompilationScope struct {
 	instructions opcode.Instructions
 	constants    []object.Object
+	positions    []object.Position
+	callSites    []object.CallSite
+	handlers     []object.Handler
+
+	// depth counts the elements the code compiled so far leaves on the
+	// stack above the locals of the frame
+	depth int
+	// tries holds the handlers of the tries being compiled, innermost last
+	tries []*tryBlock
+	// chains holds the positions of the jumps out of each optional chain
+	// being compiled, innermost last
+	chains [][]int
+}
+
+// tryBlock is a handler of a try that is being compiled. It covers the
+// instructions compiled while it is in tries, except for the finally blocks
+// that a return runs on its way out of it.
+type tryBlock struct {
+	ranges [][2]int
+	start  int
+	// finally is set for the handler that runs the finally block of a try
+	// when an error propagates out of its try or catch block
+	finally *ast.BlockStatement
 }
 
 func New() *Compiler {
-	return &Compiler{
+	mainScope := CompilationScope{
 		instructions: opcode.Instructions{},
 		constants:    []object.Object{},
 	}
+
+	return &Compiler{
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+		symbolTable: NewSymbolTable(),
+	}
+}
+
+// NewWithState creates a compiler that keeps the globals of earlier
+// compilations, as the REPL does between lines.
+func NewWithState(s *SymbolTable) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	return compiler
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
 	switch node := node.(type) {
 	case *ast.Program:
+		err := c.hoistFunctions(node.Statements)
+		if err != nil {
+			return err
+		}
+
 		for _, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
@@ -33,59 +91,1433 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
+		c.emit(opcode.OpPop)
+	case *ast.BlockStatement:
+		err := c.hoistFunctions(node.Statements)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+	case *ast.LetStatement:
+		if node.Pattern != nil {
+			return c.compileDestructuringLet(node)
+		}
+
+		if symbol, ok := c.symbolTable.Declared(node.Name.Value); ok && symbol.Const {
+			return newError(node.Token, object.NameError, "cannot redeclare constant: %s", node.Name.Value)
+		}
+
+		// A function is declared before its body is compiled, so that it can
+		// call itself by name. Any other value may refer to an outer binding
+		// of the name it is about to shadow.
+		_, isFunction := node.Value.(*ast.FunctionLiteral)
+
+		var symbol Symbol
+		if isFunction {
+			symbol = c.define(node, node.Name)
+		}
+
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		if !isFunction {
+			symbol = c.define(node, node.Name)
+		}
+		c.setSymbol(symbol)
+	case *ast.FunctionStatement:
+		// Already bound by hoistFunctions at the start of the enclosing block
+	case *ast.StructStatement:
+		if symbol, ok := c.symbolTable.Declared(node.Name.Value); ok && symbol.Const {
+			return newError(node.Token, object.NameError, "cannot redeclare constant: %s", node.Name.Value)
+		}
+
+		fields := []string{}
+		for _, field := range node.Fields {
+			fields = append(fields, field.Value)
+		}
+
+		st := &object.StructType{Name: node.Name.Value, Fields: fields}
+		c.emit(opcode.OpStruct, c.addConstant(st))
+		c.setSymbol(c.symbolTable.Define(node.Name.Value))
+	case *ast.ImportStatement:
+		if symbol, ok := c.symbolTable.Declared(node.Alias.Value); ok && symbol.Const {
+			return newError(node.Token, object.NameError, "cannot redeclare constant: %s", node.Alias.Value)
+		}
+
+		path := &object.String{Value: node.Path.Value}
+		pos := c.emitAt(node.Token, opcode.OpImport, c.addConstant(path))
+
+		// Errors raised while running the module propagate out of it as out
+		// of a call
+		frame := object.StackFrame{
+			Function: "<module " + object.ModuleName(node.Path.Value) + ">",
+			Line:     node.Token.Line,
+			Column:   node.Token.Column,
+		}
+		scope := &c.scopes[c.scopeIndex]
+		scope.callSites = append(scope.callSites, object.CallSite{Offset: pos, Frame: frame})
+
+		c.setSymbol(c.symbolTable.Define(node.Alias.Value))
+	case *ast.ExportStatement:
+		err := c.Compile(node.Statement)
+		if err != nil {
+			return err
+		}
+
+		c.exports = append(c.exports, node.Names()...)
+	case *ast.ReturnStatement:
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+
+		err = c.compileReturn()
+		if err != nil {
+			return err
+		}
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		c.emitAt(node.Token, opcode.OpThrow)
+	case *ast.YieldExpression:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		c.emitAt(node.Token, opcode.OpYield)
+	case *ast.TryExpression:
+		err := c.compileTryExpression(node)
+		if err != nil {
+			return err
+		}
+	case *ast.MatchExpression:
+		err := c.compileMatchExpression(node)
+		if err != nil {
+			return err
+		}
+	case *ast.FunctionLiteral:
+		err := c.compileFunctionLiteral(node)
+		if err != nil {
+			return err
+		}
+	case *ast.CallExpression:
+		err := c.compileCallExpression(node)
+		if err != nil {
+			return err
+		}
+	case *ast.Identifier:
+		c.loadSymbol(c.resolve(node.Value), node.Token)
 	case *ast.InfixExpression:
 		err := c.Compile(node.Left)
 		if err != nil {
 			return err
 		}
 
+		// The right side of ?? is only evaluated when the left is null
+		if node.Operator == "??" {
+			jumpNotNullPos := c.emit(opcode.OpJumpNotNull, 9999)
+
+			err = c.Compile(node.Right)
+			if err != nil {
+				return err
+			}
+
+			c.changeOperand(jumpNotNullPos, len(c.currentInstructions()))
+			return nil
+		}
+
 		err = c.Compile(node.Right)
 		if err != nil {
 			return err
 		}
 
+		op, ok := infixOpcodes[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		c.emitAt(node.Token, op)
+	case *ast.ComparisonChain:
+		err := c.compileComparisonChain(node)
+		if err != nil {
+			return err
+		}
+	case *ast.PrefixExpression:
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
 		switch node.Operator {
-		case "+":
-			c.emit(opcode.OpAdd)
+		case "~":
+			c.emitAt(node.Token, opcode.OpBitNot)
 		case "-":
-			c.emit(opcode.OpSubtract)
+			c.emitAt(node.Token, opcode.OpMinus)
+		case "!":
+			c.emitAt(node.Token, opcode.OpBang)
 		default:
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
+	case *ast.IfExpression:
+		err := c.compileIfExpression(node)
+		if err != nil {
+			return err
+		}
+	case *ast.ConditionalExpression:
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		// Emit the jumps with a bogus target and patch it once the branch
+		// they skip has been compiled
+		jumpNotTruthyPos := c.emit(opcode.OpJumpNotTruthy, 9999)
+		depth := c.scopes[c.scopeIndex].depth
+
+		err = c.Compile(node.Consequence)
+		if err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(opcode.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		c.scopes[c.scopeIndex].depth = depth
+
+		err = c.Compile(node.Alternative)
+		if err != nil {
+			return err
+		}
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
 		c.emit(opcode.OpConstant, c.addConstant(integer))
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(opcode.OpConstant, c.addConstant(str))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(opcode.OpTrue)
+		} else {
+			c.emit(opcode.OpFalse)
+		}
+	case *ast.NullLiteral:
+		c.emit(opcode.OpNull)
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(opcode.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		keys := []ast.Expression{}
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+		// Go randomizes map iteration, sort the keys so that the emitted
+		// instructions are deterministic
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, k := range keys {
+			err := c.Compile(k)
+			if err != nil {
+				return err
+			}
+			err = c.Compile(node.Pairs[k])
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emitAt(node.Token, opcode.OpHash, len(node.Pairs)*2)
+	case *ast.ArrayComprehension:
+		c.emit(opcode.OpArray, 0)
+
+		err := c.compileComprehension(node.Token, node.Clause, func() error {
+			err := c.Compile(node.Element)
+			if err != nil {
+				return err
+			}
+
+			c.emit(opcode.OpAppend, 1)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	case *ast.HashComprehension:
+		c.emit(opcode.OpHash, 0)
+
+		err := c.compileComprehension(node.Token, node.Clause, func() error {
+			err := c.Compile(node.Key)
+			if err != nil {
+				return err
+			}
+			err = c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+
+			c.emitAt(node.Token, opcode.OpInsert, 1)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	case *ast.RangeExpression:
+		for _, bound := range []ast.Expression{node.Start, node.End, node.Step} {
+			if bound == nil {
+				c.emit(opcode.OpNull)
+				continue
+			}
+
+			err := c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+
+		inclusive := 0
+		if node.Inclusive {
+			inclusive = 1
+		}
+		c.emitAt(node.Token, opcode.OpRange, inclusive)
+	case *ast.OptionalChain:
+		err := c.compileOptionalChain(node)
+		if err != nil {
+			return err
+		}
+	case *ast.IndexExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		if node.Optional {
+			err = c.jumpOutOfChain(opcode.OpJumpNull)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = c.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+
+		if node.Optional {
+			err = c.jumpOutOfChain(opcode.OpJumpMissingIndex)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emitAt(node.Token, opcode.OpIndex)
+	case *ast.MemberExpression:
+		err := c.Compile(node.Object)
+		if err != nil {
+			return err
+		}
+
+		name := c.addConstant(&object.String{Value: node.Property.Value})
+		if node.Optional {
+			err = c.jumpOutOfChain(opcode.OpJumpMissingMember, name)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emitAt(node.Property.Token, opcode.OpGetMember, name)
+	case *ast.AssignmentExpression:
+		err := c.compileAssignmentExpression(node)
+		if err != nil {
+			return err
+		}
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		if node.Optional {
+			err = c.jumpOutOfChain(opcode.OpJumpNull)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, bound := range []ast.Expression{node.Start, node.End, node.Step} {
+			if bound == nil {
+				c.emit(opcode.OpNull)
+				continue
+			}
+
+			err := c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emitAt(node.Token, opcode.OpSlice)
+	default:
+		return fmt.Errorf("%T is not supported by the compiler yet", node)
 	}
 
 	return nil
 }
 
-func (c *Compiler) emit(op opcode.Opcode, operands ...int) int {
-	ins := opcode.Make(op, operands...)
-	pos := c.addInstruction(ins)
-	// starting position of the just-emitted instruction
-	return pos
+var infixOpcodes = map[string]opcode.Opcode{
+	"+":  opcode.OpAdd,
+	"-":  opcode.OpSubtract,
+	"*":  opcode.OpMultiply,
+	"/":  opcode.OpDivide,
+	"%":  opcode.OpModulo,
+	"**": opcode.OpPower,
+	"&":  opcode.OpBitAnd,
+	"|":  opcode.OpBitOr,
+	"^":  opcode.OpBitXor,
+	"<<": opcode.OpShiftLeft,
+	">>": opcode.OpShiftRight,
+	"in": opcode.OpIn,
+	"==": opcode.OpEqual,
+	"!=": opcode.OpNotEqual,
+	"<":  opcode.OpLessThan,
+	"<=": opcode.OpLessThanOrEqual,
+	">":  opcode.OpGreaterThan,
+	">=": opcode.OpGreaterThanOrEqual,
 }
 
-func (c *Compiler) addInstruction(ins []byte) int {
-	posNewInstruction := len(c.instructions)
-	c.instructions = append(c.instructions, ins...)
-	return posNewInstruction
-}
+// compileComparisonChain compiles a < b < c so that b is evaluated once and
+// c only if a < b holds. Every comparison but the last keeps a copy of its
+// right operand underneath its result, to be the left operand of the next.
+// A failing comparison jumps to code that drops that copy and pushes false.
+func (c *Compiler) compileComparisonChain(node *ast.ComparisonChain) error {
+	err := c.Compile(node.Operands[0])
+	if err != nil {
+		return err
+	}
 
-func (c *Compiler) addConstant(obj object.Object) int {
-	c.constants = append(c.constants, obj)
-	return len(c.constants) - 1
+	jumpToFalsePositions := []int{}
+	for i, operator := range node.Operators {
+		err := c.Compile(node.Operands[i+1])
+		if err != nil {
+			return err
+		}
+
+		last := i == len(node.Operators)-1
+		if !last {
+			// [a, b] becomes [b, a, b]
+			c.emit(opcode.OpDup)
+			c.emit(opcode.OpRotThree)
+		}
+
+		op, ok := infixOpcodes[operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", operator)
+		}
+		c.emitAt(node.Token, op)
+
+		if !last {
+			jumpToFalsePositions = append(jumpToFalsePositions, c.emit(opcode.OpJumpNotTruthy, 9999))
+		}
+	}
+
+	jumpPos := c.emit(opcode.OpJump, 9999)
+
+	for _, pos := range jumpToFalsePositions {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.emit(opcode.OpPop)
+	c.emit(opcode.OpFalse)
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
 }
 
-func (c *Compiler) Bytecode() *Bytecode {
-	return &Bytecode{
-		Instructions: c.instructions,
-		Constants:    c.constants,
+// compileIfExpression compiles each condition to jump over its block when it
+// does not hold, and each block to jump to the end once it has run. An if
+// without an else evaluates to null when no condition holds.
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	branches := []*ast.ElifExpression{{Condition: node.Condition, Consequence: node.Consequence}}
+	branches = append(branches, node.Alternatives...)
+
+	jumpToEndPositions := []int{}
+	for _, branch := range branches {
+		err := c.Compile(branch.Condition)
+		if err != nil {
+			return err
+		}
+
+		jumpNotTruthyPos := c.emit(opcode.OpJumpNotTruthy, 9999)
+		depth := c.scopes[c.scopeIndex].depth
+
+		err = c.compileBlockScope(branch.Consequence)
+		if err != nil {
+			return err
+		}
+
+		jumpToEndPositions = append(jumpToEndPositions, c.emit(opcode.OpJump, 9999))
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		c.scopes[c.scopeIndex].depth = depth
+	}
+
+	if node.Alternative != nil {
+		err := c.compileBlockScope(node.Alternative)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.emit(opcode.OpNull)
+	}
+
+	for _, pos := range jumpToEndPositions {
+		c.changeOperand(pos, len(c.currentInstructions()))
 	}
+
+	return nil
 }
 
-type Bytecode struct {
-	Instructions opcode.Instructions
-	Constants    []object.Object
+// compileMatchExpression keeps the subject on the stack while it tries each
+// arm in turn. An arm matches a copy of the subject against its pattern,
+// binding the names in the pattern in a block scope of its own, then checks
+// its guard. The arm that succeeds pops the subject before its body runs.
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	err := c.Compile(node.Subject)
+	if err != nil {
+		return err
+	}
+	depth := c.scopes[c.scopeIndex].depth
+
+	jumpToEndPositions := []int{}
+	for _, arm := range node.Arms {
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+		err := c.compileMatchArm(arm, &jumpToEndPositions)
+		c.symbolTable = c.symbolTable.Outer
+		if err != nil {
+			return err
+		}
+		c.scopes[c.scopeIndex].depth = depth
+	}
+
+	c.emitAt(node.Token, opcode.OpNoMatch)
+
+	for _, pos := range jumpToEndPositions {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.scopes[c.scopeIndex].depth = depth
+
+	return nil
+}
+
+// compileMatchArm compiles an arm of a match expression, with the subject on
+// top of the stack. The jumps to the next arm are pointed at the end of the
+// arm, and the jump to the end of the match is added to jumpToEndPositions.
+func (c *Compiler) compileMatchArm(arm *ast.MatchArm, jumpToEndPositions *[]int) error {
+	c.emit(opcode.OpDup)
+
+	bindings := ast.PatternBindings(arm.Pattern)
+	pattern := c.addConstant(&object.Pattern{Pattern: arm.Pattern})
+	matchPos := c.emit(opcode.OpMatch, pattern, len(bindings), 9999)
+	symbols := []Symbol{}
+	for _, name := range bindings {
+		symbols = append(symbols, c.symbolTable.Define(name.Value))
+	}
+	for i := len(symbols) - 1; i >= 0; i-- {
+		c.setSymbol(symbols[i])
+	}
+
+	jumpNotTruthyPos := -1
+	if arm.Guard != nil {
+		err := c.Compile(arm.Guard)
+		if err != nil {
+			return err
+		}
+		jumpNotTruthyPos = c.emit(opcode.OpJumpNotTruthy, 9999)
+	}
+
+	c.emit(opcode.OpPop)
+
+	var err error
+	if block, ok := arm.Body.(*ast.BlockStatement); ok {
+		err = c.compileBlockValue(block)
+	} else {
+		err = c.Compile(arm.Body)
+	}
+	if err != nil {
+		return err
+	}
+
+	*jumpToEndPositions = append(*jumpToEndPositions, c.emit(opcode.OpJump, 9999))
+
+	next := len(c.currentInstructions())
+	c.changeOperand(matchPos, pattern, len(bindings), next)
+	if jumpNotTruthyPos != -1 {
+		c.changeOperand(jumpNotTruthyPos, next)
+	}
+
+	return nil
+}
+
+// compileTryExpression compiles the try block, then the catch block as the
+// handler of errors raised in it, then the finally block as the handler of
+// errors raised in either, which runs before raising the error again. The
+// try and catch blocks are followed by a copy of the finally block, that
+// runs when they complete, and whose value is discarded. Returns run the
+// finally blocks they leave as well, see compileReturn.
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	depth := c.scopes[c.scopeIndex].depth
+
+	var finally, catch *tryBlock
+	if node.Finally != nil {
+		finally = c.enterTry(node.Finally)
+	}
+	if node.Catch != nil {
+		catch = c.enterTry(nil)
+	}
+
+	err := c.compileBlockScope(node.Body)
+	if err != nil {
+		return err
+	}
+
+	if catch != nil {
+		c.leaveTry(catch)
+	}
+	if finally != nil {
+		c.leaveTry(finally)
+	}
+
+	jumpToEndPositions := []int{}
+
+	err = c.compileFinally(node.Finally)
+	if err != nil {
+		return err
+	}
+	jumpToEndPositions = append(jumpToEndPositions, c.emit(opcode.OpJump, 9999))
+
+	if catch != nil {
+		// The handler starts with the caught exception on the stack
+		c.addHandlers(catch, depth)
+		c.scopes[c.scopeIndex].depth = depth + 1
+
+		if finally != nil {
+			c.resumeTry(finally)
+		}
+
+		c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+		if node.CatchParameter != nil {
+			c.setSymbol(c.symbolTable.Define(node.CatchParameter.Value))
+		} else {
+			c.emit(opcode.OpPop)
+		}
+		err := c.compileBlockValue(node.Catch)
+		c.symbolTable = c.symbolTable.Outer
+		if err != nil {
+			return err
+		}
+
+		if finally != nil {
+			c.leaveTry(finally)
+
+			err = c.compileFinally(node.Finally)
+			if err != nil {
+				return err
+			}
+			jumpToEndPositions = append(jumpToEndPositions, c.emit(opcode.OpJump, 9999))
+		}
+	}
+
+	if finally != nil {
+		c.addHandlers(finally, depth)
+		c.scopes[c.scopeIndex].depth = depth + 1
+
+		err := c.compileFinally(node.Finally)
+		if err != nil {
+			return err
+		}
+		c.emit(opcode.OpThrow)
+	}
+
+	for _, pos := range jumpToEndPositions {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.scopes[c.scopeIndex].depth = depth + 1
+
+	return nil
+}
+
+// compileFinally compiles a finally block, if there is one, discarding its
+// value.
+func (c *Compiler) compileFinally(block *ast.BlockStatement) error {
+	if block == nil {
+		return nil
+	}
+
+	err := c.compileBlockScope(block)
+	if err != nil {
+		return err
+	}
+	c.emit(opcode.OpPop)
+
+	return nil
+}
+
+// compileReturn returns the value on top of the stack, after running the
+// finally blocks of the tries the return leaves, innermost first. Each
+// finally block runs outside the handlers of the tries it belongs to, so
+// that an error it raises is not caught by its own try.
+func (c *Compiler) compileReturn() error {
+	tries := c.scopes[c.scopeIndex].tries
+
+	for i := len(tries) - 1; i >= 0; i-- {
+		tries[i].suspend(len(c.currentInstructions()))
+
+		c.scopes[c.scopeIndex].tries = tries[:i]
+		err := c.compileFinally(tries[i].finally)
+		c.scopes[c.scopeIndex].tries = tries
+		if err != nil {
+			return err
+		}
+	}
+
+	c.emit(opcode.OpReturnValue)
+
+	for _, t := range tries {
+		t.start = len(c.currentInstructions())
+	}
+
+	return nil
+}
+
+// enterTry starts a handler covering the instructions compiled from now on.
+func (c *Compiler) enterTry(finally *ast.BlockStatement) *tryBlock {
+	t := &tryBlock{finally: finally}
+	c.resumeTry(t)
+	return t
+}
+
+// resumeTry makes a handler that was left cover the instructions compiled
+// from now on again.
+func (c *Compiler) resumeTry(t *tryBlock) {
+	t.start = len(c.currentInstructions())
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, t)
+}
+
+// leaveTry stops the innermost handler from covering the instructions
+// compiled from now on.
+func (c *Compiler) leaveTry(t *tryBlock) {
+	t.suspend(len(c.currentInstructions()))
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+}
+
+// suspend ends the range of instructions the handler covers at pos.
+func (t *tryBlock) suspend(pos int) {
+	if t.start < pos {
+		t.ranges = append(t.ranges, [2]int{t.start, pos})
+	}
+	t.start = pos
+}
+
+// addHandlers adds the ranges covered by t to the exception table, with the
+// current position as their target, where depth elements are on the stack.
+func (c *Compiler) addHandlers(t *tryBlock, depth int) {
+	scope := &c.scopes[c.scopeIndex]
+	for _, r := range t.ranges {
+		handler := object.Handler{Start: r[0], End: r[1], Target: len(scope.instructions), Depth: depth}
+		scope.handlers = append(scope.handlers, handler)
+	}
+}
+
+// compileBlockValue compiles a block whose value is used, leaving the value
+// of its last statement on the stack, or null if that is not an expression.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	err := c.hoistFunctions(block.Statements)
+	if err != nil {
+		return err
+	}
+
+	for i, s := range block.Statements {
+		if exp, ok := s.(*ast.ExpressionStatement); ok && i == len(block.Statements)-1 {
+			return c.Compile(exp.Expression)
+		}
+
+		err := c.Compile(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.emit(opcode.OpNull)
+	return nil
+}
+
+// hoistFunctions binds every function declared directly in stmts before any
+// of them run, so that declarations can call each other in any order. All
+// of the names are declared before any of the functions is compiled.
+func (c *Compiler) hoistFunctions(stmts []ast.Statement) error {
+	decls := []*ast.FunctionStatement{}
+	symbols := []Symbol{}
+	for _, statement := range stmts {
+		if export, ok := statement.(*ast.ExportStatement); ok {
+			statement = export.Statement
+		}
+
+		decl, ok := statement.(*ast.FunctionStatement)
+		if !ok {
+			continue
+		}
+
+		if symbol, ok := c.symbolTable.Declared(decl.Name.Value); ok && symbol.Const {
+			return newError(decl.Name.Token, object.NameError, "cannot redeclare constant: %s", decl.Name.Value)
+		}
+
+		decls = append(decls, decl)
+		symbols = append(symbols, c.symbolTable.Define(decl.Name.Value))
+	}
+
+	// The functions run after the rest of the block has started, so in a
+	// function they see the names the block declares, which are withdrawn
+	// again once the functions are compiled.
+	declared := []string{}
+	if len(decls) > 0 && c.symbolTable.Outer != nil {
+		declared = c.predeclare(stmts)
+	}
+
+	for i, decl := range decls {
+		err := c.compileFunctionLiteral(decl.Function)
+		if err != nil {
+			return err
+		}
+		c.setSymbol(symbols[i])
+	}
+
+	for _, name := range declared {
+		c.symbolTable.Withdraw(name)
+	}
+
+	return nil
+}
+
+// predeclare declares the names bound by the let, const and struct
+// statements in stmts that are not declared in the block yet, and returns
+// them.
+func (c *Compiler) predeclare(stmts []ast.Statement) []string {
+	declared := []string{}
+	declare := func(name *ast.Identifier, constant bool) {
+		if _, ok := c.symbolTable.Declared(name.Value); ok {
+			return
+		}
+
+		if constant {
+			c.symbolTable.DefineConst(name.Value)
+		} else {
+			c.symbolTable.Define(name.Value)
+		}
+		declared = append(declared, name.Value)
+	}
+
+	for _, statement := range stmts {
+		switch statement := statement.(type) {
+		case *ast.LetStatement:
+			for _, name := range statement.Bindings() {
+				declare(name, statement.IsConst())
+			}
+		case *ast.StructStatement:
+			declare(statement.Name, false)
+		}
+	}
+
+	return declared
+}
+
+// define declares a name bound by a let or const statement.
+func (c *Compiler) define(node *ast.LetStatement, name *ast.Identifier) Symbol {
+	if node.IsConst() {
+		return c.symbolTable.DefineConst(name.Value)
+	}
+
+	return c.symbolTable.Define(name.Value)
+}
+
+// compileDestructuringLet matches the value against the pattern of the
+// statement, which pushes the values of the names it binds or raises an
+// error, and then pops them into the names in reverse. None of the names is
+// declared before the value is evaluated, so it sees the outer bindings of
+// the names.
+func (c *Compiler) compileDestructuringLet(node *ast.LetStatement) error {
+	bindings := node.Bindings()
+	for _, name := range bindings {
+		if symbol, ok := c.symbolTable.Declared(name.Value); ok && symbol.Const {
+			return newError(name.Token, object.NameError, "cannot redeclare constant: %s", name.Value)
+		}
+	}
+
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+
+	c.destructure(node.Pattern, node.Token, func(name *ast.Identifier) Symbol {
+		return c.define(node, name)
+	})
+
+	return nil
+}
+
+// destructure matches the value on top of the stack against pattern and pops
+// the parts of it into the names it binds, which define declares. A mismatch
+// raises an error at tok.
+func (c *Compiler) destructure(pattern ast.Pattern, tok token.Token, define func(name *ast.Identifier) Symbol) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		c.setSymbol(define(pattern))
+		return
+	case *ast.WildcardPattern:
+		c.emit(opcode.OpPop)
+		return
+	}
+
+	bindings := ast.PatternBindings(pattern)
+	c.emitAt(tok, opcode.OpDestructure, c.addConstant(&object.Pattern{Pattern: pattern}), len(bindings))
+
+	symbols := []Symbol{}
+	for _, name := range bindings {
+		symbols = append(symbols, define(name))
+	}
+	for i := len(symbols) - 1; i >= 0; i-- {
+		c.setSymbol(symbols[i])
+	}
+}
+
+// compileComprehension compiles the loop of a comprehension whose result is
+// on top of the stack. The iterator sits above it while the loop runs, and
+// body adds an element to the result. The targets of the clause are bound
+// in a block scope, and the closures created in an iteration keep the
+// targets of that iteration, as in the interpreter.
+func (c *Compiler) compileComprehension(tok token.Token, clause *ast.ComprehensionClause, body func() error) error {
+	err := c.Compile(clause.Iterable)
+	if err != nil {
+		return err
+	}
+	c.emitAt(tok, opcode.OpIter)
+	depth := c.scopes[c.scopeIndex].depth
+
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	defer func() { c.symbolTable = c.symbolTable.Outer }()
+
+	loop := c.emit(opcode.OpCloseUpvalues, c.symbolTable.NumLocals())
+	iterNextPos := c.emitAt(tok, opcode.OpIterNext, 9999)
+
+	c.destructure(clause.Target, clause.Token, func(name *ast.Identifier) Symbol {
+		return c.symbolTable.Define(name.Value)
+	})
+
+	if clause.Condition != nil {
+		err := c.Compile(clause.Condition)
+		if err != nil {
+			return err
+		}
+		c.emit(opcode.OpJumpNotTruthy, loop)
+	}
+
+	err = body()
+	if err != nil {
+		return err
+	}
+	c.emit(opcode.OpJump, loop)
+
+	c.changeOperand(iterNextPos, len(c.currentInstructions()))
+	c.scopes[c.scopeIndex].depth = depth - 1
+
+	return nil
+}
+
+// compileFunctionLiteral compiles the function into a constant of its own and
+// emits the instruction creating a closure of it. The parameters take the
+// first local slots, followed by the rest parameter. The VM binds the
+// arguments of a call to them, and the function starts by evaluating the
+// default value of each parameter that was not passed an argument, in
+// order. Each default sees the parameters before it, as in the interpreter,
+// but the slots of all of them are set aside first, apart from the slots of
+// the blocks in the defaults. The body of a generator starts after its
+// defaults, so that a call evaluates them before it returns the iterator.
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	numParams := len(node.Parameters)
+	if node.Rest != nil {
+		numParams++
+	}
+	c.symbolTable.ReserveLocals(numParams)
+
+	params := []string{}
+	hasDefault := []bool{}
+	for i, param := range node.Parameters {
+		def, ok := node.Defaults[param.Value]
+		if ok {
+			jumpIfBoundPos := c.emit(opcode.OpJumpIfBound, i, 9999)
+
+			err := c.Compile(def)
+			if err != nil {
+				return err
+			}
+
+			c.emit(opcode.OpSetLocal, i)
+			c.changeOperand(jumpIfBoundPos, i, len(c.currentInstructions()))
+		}
+
+		c.symbolTable.DefineLocal(param.Value, i)
+		params = append(params, param.Value)
+		hasDefault = append(hasDefault, ok)
+	}
+
+	rest := ""
+	if node.Rest != nil {
+		rest = node.Rest.Value
+		c.symbolTable.DefineLocal(rest, len(node.Parameters))
+	}
+
+	if node.Generator {
+		c.emit(opcode.OpGenerator)
+	}
+
+	err := c.compileBlockValue(node.Body)
+	if err != nil {
+		return err
+	}
+	c.emit(opcode.OpReturnValue)
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.NumLocals()
+	scope := c.leaveScope()
+
+	captures := []object.Capture{}
+	for _, s := range freeSymbols {
+		captures = append(captures, object.Capture{Name: s.Name, Local: s.Scope == LocalScope, Index: s.Index})
+	}
+
+	fn := &object.CompiledFunction{
+		Instructions: scope.instructions,
+		Constants:    scope.constants,
+		Positions:    scope.positions,
+		CallSites:    scope.callSites,
+		Handlers:     scope.handlers,
+		NumLocals:    numLocals,
+		Name:         node.Name,
+		Parameters:   params,
+		HasDefault:   hasDefault,
+		Rest:         rest,
+		Captures:     captures,
+	}
+	c.emit(opcode.OpClosure, c.addConstant(fn))
+
+	return nil
+}
+
+// compileOptionalChain compiles the links of an optional chain, whose
+// optional links jump to the end of the chain when they short-circuit,
+// leaving null as the value of the chain.
+func (c *Compiler) compileOptionalChain(node *ast.OptionalChain) error {
+	scope := &c.scopes[c.scopeIndex]
+	scope.chains = append(scope.chains, []int{})
+
+	err := c.Compile(node.Expression)
+	if err != nil {
+		return err
+	}
+
+	scope = &c.scopes[c.scopeIndex]
+	jumps := scope.chains[len(scope.chains)-1]
+	scope.chains = scope.chains[:len(scope.chains)-1]
+
+	for _, pos := range jumps {
+		ins := c.currentInstructions()
+		def, err := opcode.Lookup(ins[pos])
+		if err != nil {
+			return err
+		}
+
+		operands, _ := opcode.ReadOperands(def, ins[pos+1:])
+		operands[len(operands)-1] = len(ins)
+		c.changeOperand(pos, operands...)
+	}
+
+	return nil
+}
+
+// jumpOutOfChain emits a jump out of the innermost optional chain, whose
+// target is filled in once the end of the chain is known.
+func (c *Compiler) jumpOutOfChain(op opcode.Opcode, operands ...int) error {
+	scope := &c.scopes[c.scopeIndex]
+	if len(scope.chains) == 0 {
+		return fmt.Errorf("optional link outside of an optional chain")
+	}
+
+	pos := c.emit(op, append(operands, 9999)...)
+	scope.chains[len(scope.chains)-1] = append(scope.chains[len(scope.chains)-1], pos)
+
+	return nil
+}
+
+// compileCallExpression compiles the function and then its arguments, left
+// to right. A call with spread or keyword arguments records which arguments
+// are which in a constant for the VM.
+func (c *Compiler) compileCallExpression(node *ast.CallExpression) error {
+	err := c.Compile(node.Function)
+	if err != nil {
+		return err
+	}
+
+	if node.Optional {
+		err = c.jumpOutOfChain(opcode.OpJumpNull)
+		if err != nil {
+			return err
+		}
+	}
+
+	kinds := []object.Object{}
+	positional := true
+	for _, arg := range node.Arguments {
+		kind := ""
+		switch arg := arg.(type) {
+		case *ast.SpreadExpression:
+			kind = "..."
+			err = c.Compile(arg.Value)
+			if err == nil {
+				c.emitAt(arg.Token, opcode.OpSpread)
+			}
+		case *ast.KeywordArgument:
+			kind = arg.Name.Value
+			err = c.Compile(arg.Value)
+		default:
+			err = c.Compile(arg)
+		}
+		if err != nil {
+			return err
+		}
+
+		positional = positional && kind == ""
+		kinds = append(kinds, &object.String{Value: kind})
+	}
+
+	var pos int
+	if positional {
+		pos = c.emitAt(node.Token, opcode.OpCall, len(node.Arguments))
+	} else {
+		pos = c.emitAt(node.Token, opcode.OpApply, len(node.Arguments), c.addConstant(&object.Array{Elements: kinds}))
+	}
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.callSites = append(scope.callSites, object.CallSite{Offset: pos, Frame: callSiteFrame(node)})
+
+	return nil
+}
+
+// callSiteFrame describes a call by the name it was made through, as in f(1)
+// or m.f(1), or as <anonymous> when it was made some other way, e.g. f(1)(2).
+// The frame points at that name if there is one, else the opening
+// parenthesis. The VM names the frame after the function instead if it was
+// declared with a name.
+func callSiteFrame(node *ast.CallExpression) object.StackFrame {
+	switch callee := node.Function.(type) {
+	case *ast.Identifier:
+		return object.StackFrame{Function: callee.Value, Line: callee.Token.Line, Column: callee.Token.Column}
+	case *ast.MemberExpression:
+		prop := callee.Property
+		return object.StackFrame{Function: prop.Value, Line: prop.Token.Line, Column: prop.Token.Column}
+	}
+
+	return object.StackFrame{Function: "<anonymous>", Line: node.Token.Line, Column: node.Token.Column}
+}
+
+// compileBlockScope compiles the value of a block in a scope of its own, so
+// that the names it declares are not visible after it.
+func (c *Compiler) compileBlockScope(block *ast.BlockStatement) error {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	err := c.compileBlockValue(block)
+	c.symbolTable = c.symbolTable.Outer
+
+	return err
+}
+
+// compileAssignmentExpression evaluates the parts of the target and the
+// value in the same order as the interpreter. The assignment opcode stores
+// the value, combining it with the current one first for a compound
+// assignment, and leaves the stored value as the value of the expression.
+func (c *Compiler) compileAssignmentExpression(node *ast.AssignmentExpression) error {
+	operator := 0
+	if node.AssignmentType.Type != token.ASSIGN {
+		op, ok := infixOpcodes[strings.TrimSuffix(node.AssignmentType.Literal, "=")]
+		if !ok {
+			return fmt.Errorf("unknown assignment operator %s", node.AssignmentType.Literal)
+		}
+		operator = int(op)
+	}
+
+	switch left := node.Left.(type) {
+	case *ast.Identifier:
+		symbol := c.resolve(left.Value)
+		if symbol.Scope == BuiltinScope {
+			// Builtins cannot be assigned to, so let the VM report the name
+			// as undeclared
+			symbol = c.symbolTable.DefineGlobal(left.Value)
+		}
+		if symbol.Const {
+			return newError(node.Token, object.TypeError, "cannot assign to constant: %s", left.Value)
+		}
+
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch symbol.Scope {
+		case GlobalScope:
+			c.emitAt(node.Token, opcode.OpAssignGlobal, symbol.Index, operator)
+		case LocalScope:
+			c.emitAt(node.Token, opcode.OpAssignLocal, symbol.Index, operator)
+		case FreeScope:
+			c.emitAt(node.Token, opcode.OpAssignFree, symbol.Index, operator)
+		}
+	case *ast.IndexExpression:
+		err := c.Compile(left.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(left.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emitAt(node.Token, opcode.OpSetIndex, operator)
+	case *ast.MemberExpression:
+		err := c.Compile(left.Object)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		name := &object.String{Value: left.Property.Value}
+		c.emitAt(node.Token, opcode.OpSetMember, c.addConstant(name), operator)
+	default:
+		return fmt.Errorf("cannot compile assignment to %T", node.Left)
+	}
+
+	return nil
+}
+
+// resolve looks up the symbol of an identifier. Names that are not declared
+// yet are given a global slot, in case they are declared by the time the code
+// runs, as in a function that refers to a later global. Reading the slot
+// before then is an error.
+func (c *Compiler) resolve(name string) Symbol {
+	symbol, ok := c.symbolTable.Resolve(name)
+	if ok {
+		return symbol
+	}
+
+	for i, def := range object.Builtins {
+		if def.Name == name {
+			return Symbol{Name: name, Scope: BuiltinScope, Index: i}
+		}
+	}
+
+	return c.symbolTable.DefineGlobal(name)
+}
+
+// loadSymbol emits the instruction pushing the value of s, where tok is the
+// identifier that names it.
+func (c *Compiler) loadSymbol(s Symbol, tok token.Token) {
+	switch s.Scope {
+	case GlobalScope:
+		// Fails for a global that is not defined yet
+		c.emitAt(tok, opcode.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(opcode.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(opcode.OpGetBuiltin, s.Index)
+	case FreeScope:
+		// Fails for a variable of a block that a function declared in the
+		// block reads before the block binds it
+		c.emitAt(tok, opcode.OpGetFree, s.Index)
+	}
+}
+
+func (c *Compiler) setSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(opcode.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(opcode.OpSetLocal, s.Index)
+	}
+}
+
+func (c *Compiler) emit(op opcode.Opcode, operands ...int) int {
+	ins := opcode.Make(op, operands...)
+	pos := c.addInstruction(ins)
+	c.scopes[c.scopeIndex].depth += stackEffect(op, operands)
+	// starting position of the just-emitted instruction
+	return pos
+}
+
+// stackEffect returns the number of elements an instruction leaves on the
+// stack, less the number it takes off. Jumps leave the stack as it is, the
+// code after a jump that is not taken is compiled with the depth it had.
+func stackEffect(op opcode.Opcode, operands []int) int {
+	switch op {
+	case opcode.OpConstant, opcode.OpTrue, opcode.OpFalse, opcode.OpNull, opcode.OpDup,
+		opcode.OpGetGlobal, opcode.OpGetLocal, opcode.OpGetBuiltin, opcode.OpGetFree, opcode.OpClosure,
+		opcode.OpImport, opcode.OpStruct, opcode.OpIterNext:
+		return 1
+	case opcode.OpAdd, opcode.OpSubtract, opcode.OpMultiply, opcode.OpDivide,
+		opcode.OpModulo, opcode.OpPower, opcode.OpBitAnd, opcode.OpBitOr,
+		opcode.OpBitXor, opcode.OpShiftLeft, opcode.OpShiftRight, opcode.OpIn,
+		opcode.OpEqual, opcode.OpNotEqual, opcode.OpLessThan, opcode.OpLessThanOrEqual,
+		opcode.OpGreaterThan, opcode.OpGreaterThanOrEqual, opcode.OpIndex,
+		opcode.OpPop, opcode.OpJumpNotTruthy, opcode.OpSetGlobal, opcode.OpSetLocal,
+		opcode.OpReturnValue, opcode.OpThrow, opcode.OpSetMember, opcode.OpNoMatch,
+		opcode.OpAppend, opcode.OpJumpNotNull:
+		return -1
+	case opcode.OpSetIndex, opcode.OpInsert:
+		return -2
+	case opcode.OpSlice:
+		return -3
+	case opcode.OpRange:
+		return -2
+	case opcode.OpArray, opcode.OpHash:
+		return 1 - operands[0]
+	case opcode.OpCall, opcode.OpApply:
+		return -operands[0]
+	case opcode.OpMatch, opcode.OpDestructure:
+		return operands[1] - 1
+	}
+
+	return 0
+}
+
+// emitAt emits an instruction that can raise an error, recording tok as its
+// position, which is where the interpreter reports the same error.
+func (c *Compiler) emitAt(tok token.Token, op opcode.Opcode, operands ...int) int {
+	pos := c.emit(op, operands...)
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.positions = append(scope.positions, object.Position{Offset: pos, Line: tok.Line, Column: tok.Column})
+
+	return pos
+}
+
+func (c *Compiler) currentInstructions() opcode.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return posNewInstruction
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	copy(c.currentInstructions()[pos:], newInstruction)
+}
+
+// changeOperand replaces the operands of the instruction at opPos, such as
+// the target of a jump that was emitted before its target was known.
+func (c *Compiler) changeOperand(opPos int, operands ...int) {
+	op := opcode.Opcode(c.currentInstructions()[opPos])
+	newInstruction := opcode.Make(op, operands...)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	scope := &c.scopes[c.scopeIndex]
+	scope.constants = append(scope.constants, obj)
+	return len(scope.constants) - 1
+}
+
+// enterScope starts compiling a function, whose names live in a symbol table
+// enclosed by the current one.
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions: opcode.Instructions{},
+		constants:    []object.Object{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() CompilationScope {
+	scope := c.scopes[c.scopeIndex]
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return scope
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.scopes[c.scopeIndex].constants,
+		Positions:    c.scopes[c.scopeIndex].positions,
+		CallSites:    c.scopes[c.scopeIndex].callSites,
+		Handlers:     c.scopes[c.scopeIndex].handlers,
+		GlobalNames:  c.symbolTable.GlobalNames(),
+		Exports:      c.exports,
+		NumLocals:    c.symbolTable.NumLocals(),
+	}
+}
+
+type Bytecode struct {
+	Instructions opcode.Instructions
+	Constants    []object.Object
+	GlobalNames  []string // The name of each global slot, by index
+	NumLocals    int      // The number of local slots used by blocks in the program
+	Exports      []string // The names the program exports as a module
+	Positions    []object.Position
+	CallSites    []object.CallSite
+	Handlers     []object.Handler
+}
+
+// newError creates an error the compiler finds in the program, positioned
+// at tok as the interpreter would position it at run time.
+func newError(tok token.Token, kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	err := object.NewError(kind, format, a...)
+	err.Line, err.Column = tok.Line, tok.Column
+	return err
 }
@@ -2,6 +2,7 @@ package compiler
 
 import (
 	"fmt"
+	"reflect"
 	"seville/ast"
 	"seville/lexer"
 	"seville/object"
@@ -16,6 +17,17 @@ type compilerTestCase struct {
 	expectedInstructions []opcode.Instructions
 }
 
+// compiledFunction is the expected value of a function constant, which has
+// constants of its own.
+type compiledFunction struct {
+	constants    []interface{}
+	instructions []opcode.Instructions
+	captures     []object.Capture // Not checked if nil
+}
+
+// pattern is the expected value of a pattern constant, as it is printed
+type pattern string
+
 func TestIntegerArithmetic(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -25,6 +37,7 @@ func TestIntegerArithmetic(t *testing.T) {
 				opcode.Make(opcode.OpConstant, 0),
 				opcode.Make(opcode.OpConstant, 1),
 				opcode.Make(opcode.OpAdd),
+				opcode.Make(opcode.OpPop),
 			},
 		},
 		{
@@ -34,6 +47,410 @@ func TestIntegerArithmetic(t *testing.T) {
 				opcode.Make(opcode.OpConstant, 0),
 				opcode.Make(opcode.OpConstant, 1),
 				opcode.Make(opcode.OpSubtract),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "12 & 10 | 1",
+			expectedConstants: []interface{}{12, 10, 1},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpBitAnd),
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpBitOr),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "1 << 4 ^ 0xff >> 2",
+			expectedConstants: []interface{}{1, 4, 255, 2},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpShiftLeft),
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpConstant, 3),
+				opcode.Make(opcode.OpShiftRight),
+				opcode.Make(opcode.OpBitXor),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "~5",
+			expectedConstants: []interface{}{5},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpBitNot),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpTrue),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpFalse),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestComparisons(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 > 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpGreaterThan),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "1 <= 2 == true",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpLessThanOrEqual),
+				opcode.Make(opcode.OpTrue),
+				opcode.Make(opcode.OpEqual),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "1 < 2 >= 3",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpConstant, 0),
+				// 0003
+				opcode.Make(opcode.OpConstant, 1),
+				// 0006
+				opcode.Make(opcode.OpDup),
+				// 0007
+				opcode.Make(opcode.OpRotThree),
+				// 0008
+				opcode.Make(opcode.OpLessThan),
+				// 0009
+				opcode.Make(opcode.OpJumpNotTruthy, 19),
+				// 0012
+				opcode.Make(opcode.OpConstant, 2),
+				// 0015
+				opcode.Make(opcode.OpGreaterThanOrEqual),
+				// 0016
+				opcode.Make(opcode.OpJump, 21),
+				// 0019
+				opcode.Make(opcode.OpPop),
+				// 0020
+				opcode.Make(opcode.OpFalse),
+				// 0021
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true ? 10 : 20",
+			expectedConstants: []interface{}{10, 20},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpTrue),
+				// 0001
+				opcode.Make(opcode.OpJumpNotTruthy, 10),
+				// 0004
+				opcode.Make(opcode.OpConstant, 0),
+				// 0007
+				opcode.Make(opcode.OpJump, 13),
+				// 0010
+				opcode.Make(opcode.OpConstant, 1),
+				// 0013
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "false ? 1 : true ? 2 : 3",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpFalse),
+				// 0001
+				opcode.Make(opcode.OpJumpNotTruthy, 10),
+				// 0004
+				opcode.Make(opcode.OpConstant, 0),
+				// 0007
+				opcode.Make(opcode.OpJump, 23),
+				// 0010
+				opcode.Make(opcode.OpTrue),
+				// 0011
+				opcode.Make(opcode.OpJumpNotTruthy, 20),
+				// 0014
+				opcode.Make(opcode.OpConstant, 1),
+				// 0017
+				opcode.Make(opcode.OpJump, 23),
+				// 0020
+				opcode.Make(opcode.OpConstant, 2),
+				// 0023
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestPrefixExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "-1 * 2 ** 3",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpMinus),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpPower),
+				opcode.Make(opcode.OpMultiply),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "!null",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpNull),
+				opcode.Make(opcode.OpBang),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestIfExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpTrue),
+				// 0001
+				opcode.Make(opcode.OpJumpNotTruthy, 10),
+				// 0004
+				opcode.Make(opcode.OpConstant, 0),
+				// 0007
+				opcode.Make(opcode.OpJump, 11),
+				// 0010
+				opcode.Make(opcode.OpNull),
+				// 0011
+				opcode.Make(opcode.OpPop),
+				// 0012
+				opcode.Make(opcode.OpConstant, 1),
+				// 0015
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "if (false) { 10 } elif (true) { 20 } else { 30 }",
+			expectedConstants: []interface{}{10, 20, 30},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpFalse),
+				// 0001
+				opcode.Make(opcode.OpJumpNotTruthy, 10),
+				// 0004
+				opcode.Make(opcode.OpConstant, 0),
+				// 0007
+				opcode.Make(opcode.OpJump, 23),
+				// 0010
+				opcode.Make(opcode.OpTrue),
+				// 0011
+				opcode.Make(opcode.OpJumpNotTruthy, 20),
+				// 0014
+				opcode.Make(opcode.OpConstant, 1),
+				// 0017
+				opcode.Make(opcode.OpJump, 23),
+				// 0020
+				opcode.Make(opcode.OpConstant, 2),
+				// 0023
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let one = 1;
+			let two = one;
+			two;
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpSetGlobal, 1),
+				opcode.Make(opcode.OpGetGlobal, 1),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			// A name used before it is declared gets the slot it is
+			// declared with later, and a second let reuses the slot
+			input: `
+			later;
+			let later = 1;
+			let later = 2;
+			`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"sev" + "ille"`,
+			expectedConstants: []interface{}{"sev", "ille"},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpAdd),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestArrayAndHashLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[]",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpArray, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "[1 + 2, 3]",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpAdd),
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpArray, 2),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "{2: 3, 1: 4 * 5}",
+			expectedConstants: []interface{}{1, 4, 5, 2, 3},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpMultiply),
+				opcode.Make(opcode.OpConstant, 3),
+				opcode.Make(opcode.OpConstant, 4),
+				opcode.Make(opcode.OpHash, 4),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestIndexAndSliceExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1, 2][-1]",
+			expectedConstants: []interface{}{1, 2, 1},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpArray, 2),
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpMinus),
+				opcode.Make(opcode.OpIndex),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             `"seville"[1:]`,
+			expectedConstants: []interface{}{"seville", 1},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpNull),
+				opcode.Make(opcode.OpNull),
+				opcode.Make(opcode.OpSlice),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "[][::-2]",
+			expectedConstants: []interface{}{2},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpArray, 0),
+				opcode.Make(opcode.OpNull),
+				opcode.Make(opcode.OpNull),
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpMinus),
+				opcode.Make(opcode.OpSlice),
+				opcode.Make(opcode.OpPop),
 			},
 		},
 	}
@@ -112,6 +529,52 @@ func testConstants(t *testing.T, expected []interface{}, actual []object.Object)
 			if err != nil {
 				return fmt.Errorf("constant %d - testIntegerObject failed: %s", i, err)
 			}
+		case string:
+			err := testStringObject(constant, actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testStringObject failed: %s", i, err)
+			}
+		case []string:
+			array, ok := actual[i].(*object.Array)
+			if !ok || len(array.Elements) != len(constant) {
+				return fmt.Errorf("constant %d - not an Array of %d elements: %T (%+v)", i, len(constant), actual[i], actual[i])
+			}
+
+			for j, el := range constant {
+				err := testStringObject(el, array.Elements[j])
+				if err != nil {
+					return fmt.Errorf("constant %d - element %d - testStringObject failed: %s", i, j, err)
+				}
+			}
+		case compiledFunction:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+			}
+
+			err := testInstructions(constant.instructions, fn.Instructions)
+			if err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
+			}
+
+			err = testConstants(t, constant.constants, fn.Constants)
+			if err != nil {
+				return fmt.Errorf("constant %d - %s", i, err)
+			}
+
+			if constant.captures != nil && fmt.Sprint(constant.captures) != fmt.Sprint(fn.Captures) {
+				return fmt.Errorf("constant %d - wrong captures. want=%v, got=%v", i, constant.captures, fn.Captures)
+			}
+		case pattern:
+			p, ok := actual[i].(*object.Pattern)
+			if !ok || p.Inspect() != string(constant) {
+				return fmt.Errorf("constant %d - wrong pattern. want=%s, got=%T (%+v)", i, constant, actual[i], actual[i])
+			}
+		case *object.StructType:
+			st, ok := actual[i].(*object.StructType)
+			if !ok || st.Name != constant.Name || !reflect.DeepEqual(st.Fields, constant.Fields) {
+				return fmt.Errorf("constant %d - wrong struct type. want=%+v, got=%T (%+v)", i, constant, actual[i], actual[i])
+			}
 		}
 	}
 
@@ -130,3 +593,1183 @@ func testIntegerObject(expected int64, actual object.Object) error {
 
 	return nil
 }
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+	}
+
+	return nil
+}
+
+func TestAssignmentExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let x = 1;
+			x = 2;
+			x += 3;
+			`,
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpAssignGlobal, 0, 0),
+				opcode.Make(opcode.OpPop),
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpAssignGlobal, 0, int(opcode.OpAdd)),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			// The collection is evaluated before the value, and the value
+			// before the index, as in the interpreter
+			input: `
+			let arr = [1];
+			arr[0] **= 2;
+			`,
+			expectedConstants: []interface{}{1, 2, 0},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpArray, 1),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpSetIndex, int(opcode.OpPower)),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			const x = 1;
+			x;
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConstErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const x = 1; x = 2", "TypeError: cannot assign to constant: x"},
+		{"const x = 1; x += 2", "TypeError: cannot assign to constant: x"},
+		{"const x = 1; let x = 2", "NameError: cannot redeclare constant: x"},
+		{"const x = 1; const x = 2", "NameError: cannot redeclare constant: x"},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("expected an error compiling %q", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error compiling %q. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// The x declared in the block gets a local slot of its own, and
+			// the x after the block is the global one again
+			input: `
+			let x = 1;
+			if (true) { let x = 2; x } else { let y = 3; x += y };
+			x;
+			`,
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpConstant, 0),
+				// 0003
+				opcode.Make(opcode.OpSetGlobal, 0),
+				// 0006
+				opcode.Make(opcode.OpTrue),
+				// 0007
+				opcode.Make(opcode.OpJumpNotTruthy, 22),
+				// 0010
+				opcode.Make(opcode.OpConstant, 1),
+				// 0013
+				opcode.Make(opcode.OpSetLocal, 0),
+				// 0016
+				opcode.Make(opcode.OpGetLocal, 0),
+				// 0019
+				opcode.Make(opcode.OpJump, 35),
+				// 0022
+				opcode.Make(opcode.OpConstant, 2),
+				// 0025
+				opcode.Make(opcode.OpSetLocal, 1),
+				// 0028
+				opcode.Make(opcode.OpGetLocal, 1),
+				// 0031
+				opcode.Make(opcode.OpAssignGlobal, 0, int(opcode.OpAdd)),
+				// 0035
+				opcode.Make(opcode.OpPop),
+				// 0036
+				opcode.Make(opcode.OpGetGlobal, 0),
+				// 0039
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn() { return 5 + 10 }`,
+			expectedConstants: []interface{}{
+				compiledFunction{
+					constants: []interface{}{5, 10},
+					instructions: []opcode.Instructions{
+						opcode.Make(opcode.OpConstant, 0),
+						opcode.Make(opcode.OpConstant, 1),
+						opcode.Make(opcode.OpAdd),
+						opcode.Make(opcode.OpReturnValue),
+						// The body has no value of its own after the return
+						opcode.Make(opcode.OpNull),
+						opcode.Make(opcode.OpReturnValue),
+					},
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			// The value of the last expression is returned
+			input: `fn(a) { let b = a; b }`,
+			expectedConstants: []interface{}{
+				compiledFunction{
+					instructions: []opcode.Instructions{
+						opcode.Make(opcode.OpGetLocal, 0),
+						opcode.Make(opcode.OpSetLocal, 1),
+						opcode.Make(opcode.OpGetLocal, 1),
+						opcode.Make(opcode.OpReturnValue),
+					},
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input: `fn() { }`,
+			expectedConstants: []interface{}{
+				compiledFunction{
+					instructions: []opcode.Instructions{
+						opcode.Make(opcode.OpNull),
+						opcode.Make(opcode.OpReturnValue),
+					},
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDefaultParameters(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// Each default is skipped when its parameter was passed an
+			// argument, and sees the parameters before it
+			input: `fn(a, b = a, c = 2) { c }`,
+			expectedConstants: []interface{}{
+				compiledFunction{
+					constants: []interface{}{2},
+					instructions: []opcode.Instructions{
+						// 0000
+						opcode.Make(opcode.OpJumpIfBound, 1, 11),
+						// 0005
+						opcode.Make(opcode.OpGetLocal, 0),
+						// 0008
+						opcode.Make(opcode.OpSetLocal, 1),
+						// 0011
+						opcode.Make(opcode.OpJumpIfBound, 2, 22),
+						// 0016
+						opcode.Make(opcode.OpConstant, 0),
+						// 0019
+						opcode.Make(opcode.OpSetLocal, 2),
+						// 0022
+						opcode.Make(opcode.OpGetLocal, 2),
+						// 0025
+						opcode.Make(opcode.OpReturnValue),
+					},
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCallExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `let f = fn(a, ...rest) { a }; f(1, 2);`,
+			expectedConstants: []interface{}{
+				compiledFunction{
+					instructions: []opcode.Instructions{
+						opcode.Make(opcode.OpGetLocal, 0),
+						opcode.Make(opcode.OpReturnValue),
+					},
+				},
+				1,
+				2,
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpCall, 2),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             `f(1, ...[2], b = 3)`,
+			expectedConstants: []interface{}{1, 2, 3, []string{"", "...", "b"}},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpArray, 1),
+				opcode.Make(opcode.OpSpread),
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpApply, 3, 3),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             `len([])`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpGetBuiltin, 0),
+				opcode.Make(opcode.OpArray, 0),
+				opcode.Make(opcode.OpCall, 1),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// The innermost function captures a from a local of the
+			// outermost, by way of a free variable of the one between them
+			input: `
+			fn(a) {
+				fn(b) {
+					fn(c) { a = b + c }
+				}
+			}
+			`,
+			expectedConstants: []interface{}{
+				compiledFunction{
+					constants: []interface{}{
+						compiledFunction{
+							constants: []interface{}{
+								compiledFunction{
+									instructions: []opcode.Instructions{
+										opcode.Make(opcode.OpGetFree, 1),
+										opcode.Make(opcode.OpGetLocal, 0),
+										opcode.Make(opcode.OpAdd),
+										opcode.Make(opcode.OpAssignFree, 0, 0),
+										opcode.Make(opcode.OpReturnValue),
+									},
+									captures: []object.Capture{{Name: "a", Local: false, Index: 0}, {Name: "b", Local: true, Index: 0}},
+								},
+							},
+							instructions: []opcode.Instructions{
+								opcode.Make(opcode.OpClosure, 0),
+								opcode.Make(opcode.OpReturnValue),
+							},
+							captures: []object.Capture{{Name: "a", Local: true, Index: 0}},
+						},
+					},
+					instructions: []opcode.Instructions{
+						opcode.Make(opcode.OpClosure, 0),
+						opcode.Make(opcode.OpReturnValue),
+					},
+					captures: []object.Capture{},
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			// A function bound by let can call itself through its binding
+			input: `
+			if (true) {
+				let countdown = fn(n) { countdown(n - 1) }
+			}
+			`,
+			expectedConstants: []interface{}{
+				compiledFunction{
+					constants: []interface{}{1},
+					instructions: []opcode.Instructions{
+						opcode.Make(opcode.OpGetFree, 0),
+						opcode.Make(opcode.OpGetLocal, 0),
+						opcode.Make(opcode.OpConstant, 0),
+						opcode.Make(opcode.OpSubtract),
+						opcode.Make(opcode.OpCall, 1),
+						opcode.Make(opcode.OpReturnValue),
+					},
+					captures: []object.Capture{{Name: "countdown", Local: true, Index: 0}},
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpTrue),
+				// 0001
+				opcode.Make(opcode.OpJumpNotTruthy, 14),
+				// 0004
+				opcode.Make(opcode.OpClosure, 0),
+				// 0007
+				opcode.Make(opcode.OpSetLocal, 0),
+				// 0010
+				opcode.Make(opcode.OpNull),
+				// 0011
+				opcode.Make(opcode.OpJump, 15),
+				// 0014
+				opcode.Make(opcode.OpNull),
+				// 0015
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctionDeclarations(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// Both functions are bound before the call that precedes them
+			input: `
+			ping();
+			fn ping() { pong() }
+			fn pong() { ping() }
+			`,
+			expectedConstants: []interface{}{
+				compiledFunction{
+					instructions: []opcode.Instructions{
+						opcode.Make(opcode.OpGetGlobal, 1),
+						opcode.Make(opcode.OpCall, 0),
+						opcode.Make(opcode.OpReturnValue),
+					},
+				},
+				compiledFunction{
+					instructions: []opcode.Instructions{
+						opcode.Make(opcode.OpGetGlobal, 0),
+						opcode.Make(opcode.OpCall, 0),
+						opcode.Make(opcode.OpReturnValue),
+					},
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				opcode.Make(opcode.OpClosure, 1),
+				opcode.Make(opcode.OpSetGlobal, 1),
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpCall, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			// A declaration captures the locals of its block, which get their
+			// slots before it is compiled
+			input: `
+			fn outer() {
+				let n = 5;
+				fn get() { n }
+				get()
+			}
+			`,
+			expectedConstants: []interface{}{
+				compiledFunction{
+					constants: []interface{}{
+						compiledFunction{
+							instructions: []opcode.Instructions{
+								opcode.Make(opcode.OpGetFree, 0),
+								opcode.Make(opcode.OpReturnValue),
+							},
+							captures: []object.Capture{{Name: "n", Local: true, Index: 1}},
+						},
+						5,
+					},
+					instructions: []opcode.Instructions{
+						opcode.Make(opcode.OpClosure, 0),
+						opcode.Make(opcode.OpSetLocal, 0),
+						opcode.Make(opcode.OpConstant, 1),
+						opcode.Make(opcode.OpSetLocal, 1),
+						opcode.Make(opcode.OpGetLocal, 0),
+						opcode.Make(opcode.OpCall, 0),
+						opcode.Make(opcode.OpReturnValue),
+					},
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0),
+				opcode.Make(opcode.OpSetGlobal, 0),
+			},
+		},
+		{
+			// A let that shadows an outer name still reads the outer one in
+			// its value
+			input: `
+			fn outer(n) {
+				if (true) {
+					let n = n + 1;
+					fn get() { n }
+				}
+			}
+			`,
+			expectedConstants: []interface{}{
+				compiledFunction{
+					constants: []interface{}{
+						compiledFunction{
+							instructions: []opcode.Instructions{
+								opcode.Make(opcode.OpGetFree, 0),
+								opcode.Make(opcode.OpReturnValue),
+							},
+							captures: []object.Capture{{Name: "n", Local: true, Index: 2}},
+						},
+						1,
+					},
+					instructions: []opcode.Instructions{
+						// 0000
+						opcode.Make(opcode.OpTrue),
+						// 0001
+						opcode.Make(opcode.OpJumpNotTruthy, 24),
+						// 0004
+						opcode.Make(opcode.OpClosure, 0),
+						opcode.Make(opcode.OpSetLocal, 1),
+						// 0010
+						opcode.Make(opcode.OpGetLocal, 0),
+						opcode.Make(opcode.OpConstant, 1),
+						opcode.Make(opcode.OpAdd),
+						opcode.Make(opcode.OpSetLocal, 2),
+						// 0020
+						opcode.Make(opcode.OpNull),
+						opcode.Make(opcode.OpJump, 25),
+						// 0024
+						opcode.Make(opcode.OpNull),
+						// 0025
+						opcode.Make(opcode.OpReturnValue),
+					},
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0),
+				opcode.Make(opcode.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLambdas(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// The expression of a lambda is returned from its body
+			input: `|x| x * 2`,
+			expectedConstants: []interface{}{
+				compiledFunction{
+					constants: []interface{}{2},
+					instructions: []opcode.Instructions{
+						opcode.Make(opcode.OpGetLocal, 0),
+						opcode.Make(opcode.OpConstant, 0),
+						opcode.Make(opcode.OpMultiply),
+						opcode.Make(opcode.OpReturnValue),
+						opcode.Make(opcode.OpNull),
+						opcode.Make(opcode.OpReturnValue),
+					},
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input: `|x| |y| x + y`,
+			expectedConstants: []interface{}{
+				compiledFunction{
+					constants: []interface{}{
+						compiledFunction{
+							instructions: []opcode.Instructions{
+								opcode.Make(opcode.OpGetFree, 0),
+								opcode.Make(opcode.OpGetLocal, 0),
+								opcode.Make(opcode.OpAdd),
+								opcode.Make(opcode.OpReturnValue),
+								opcode.Make(opcode.OpNull),
+								opcode.Make(opcode.OpReturnValue),
+							},
+							captures: []object.Capture{{Name: "x", Local: true, Index: 0}},
+						},
+					},
+					instructions: []opcode.Instructions{
+						opcode.Make(opcode.OpClosure, 0),
+						opcode.Make(opcode.OpReturnValue),
+						opcode.Make(opcode.OpNull),
+						opcode.Make(opcode.OpReturnValue),
+					},
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestPositionsAndCallSites(t *testing.T) {
+	input := "1 + true\nlen(1)"
+
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	expectedPositions := []object.Position{
+		{Offset: 4, Line: 1, Column: 3},
+		{Offset: 11, Line: 2, Column: 4},
+	}
+	if !reflect.DeepEqual(bytecode.Positions, expectedPositions) {
+		t.Errorf("wrong positions. expected=%+v, got=%+v", expectedPositions, bytecode.Positions)
+	}
+
+	expectedCallSites := []object.CallSite{
+		{Offset: 11, Frame: object.StackFrame{Function: "len", Line: 2, Column: 1}},
+	}
+	if !reflect.DeepEqual(bytecode.CallSites, expectedCallSites) {
+		t.Errorf("wrong call sites. expected=%+v, got=%+v", expectedCallSites, bytecode.CallSites)
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `try { 1 } catch (e) { e }`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpConstant, 0),
+				// 0003
+				opcode.Make(opcode.OpJump, 12),
+				// 0006, the handler binds the exception to e
+				opcode.Make(opcode.OpSetLocal, 0),
+				// 0009
+				opcode.Make(opcode.OpGetLocal, 0),
+				// 0012
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             `try { 1 } finally { 2 }`,
+			expectedConstants: []interface{}{1, 2, 2},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpConstant, 0),
+				// 0003, the finally block runs after the try block
+				opcode.Make(opcode.OpConstant, 1),
+				// 0006
+				opcode.Make(opcode.OpPop),
+				// 0007
+				opcode.Make(opcode.OpJump, 15),
+				// 0010, and before an error raised in it propagates
+				opcode.Make(opcode.OpConstant, 2),
+				// 0013
+				opcode.Make(opcode.OpPop),
+				// 0014
+				opcode.Make(opcode.OpThrow),
+				// 0015
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             `throw 1`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpThrow),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestExceptionTables(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedHandlers []object.Handler
+	}{
+		{
+			input:            `try { 1 } catch (e) { e }`,
+			expectedHandlers: []object.Handler{{Start: 0, End: 3, Target: 6, Depth: 0}},
+		},
+		{
+			// The catch block is covered by the finally handler only, and
+			// the finally blocks that follow the try and catch blocks by
+			// neither
+			input: `try { 1 } catch (e) { 2 } finally { 3 }`,
+			expectedHandlers: []object.Handler{
+				{Start: 0, End: 3, Target: 10, Depth: 0},
+				{Start: 0, End: 3, Target: 23, Depth: 0},
+				{Start: 10, End: 16, Target: 23, Depth: 0},
+			},
+		},
+		{
+			// The handler of an inner try comes first
+			input: `try { try { 1 } catch (e) { 2 } } catch (e) { 3 }`,
+			expectedHandlers: []object.Handler{
+				{Start: 0, End: 3, Target: 6, Depth: 0},
+				{Start: 0, End: 12, Target: 15, Depth: 0},
+			},
+		},
+		{
+			// The handler drops whatever the try was evaluated on top of
+			input:            `1 + try { 2 } catch (e) { 3 }`,
+			expectedHandlers: []object.Handler{{Start: 3, End: 6, Target: 9, Depth: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		handlers := compiler.Bytecode().Handlers
+		if !reflect.DeepEqual(handlers, tt.expectedHandlers) {
+			t.Errorf("wrong handlers for %q. expected=%+v, got=%+v", tt.input, tt.expectedHandlers, handlers)
+		}
+	}
+}
+
+func TestReturnsFromTries(t *testing.T) {
+	// The return runs the finally block outside the handler of its try
+	input := `fn() { try { return 1 } finally { 2 } }`
+
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	fn, ok := compiler.Bytecode().Constants[0].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant is not CompiledFunction. got=%T", compiler.Bytecode().Constants[0])
+	}
+
+	expected := []opcode.Instructions{
+		// 0000
+		opcode.Make(opcode.OpConstant, 0),
+		// 0003
+		opcode.Make(opcode.OpConstant, 1),
+		// 0006
+		opcode.Make(opcode.OpPop),
+		// 0007
+		opcode.Make(opcode.OpReturnValue),
+		// 0008
+		opcode.Make(opcode.OpNull),
+		// 0009
+		opcode.Make(opcode.OpConstant, 2),
+		// 0012
+		opcode.Make(opcode.OpPop),
+		// 0013
+		opcode.Make(opcode.OpJump, 21),
+		// 0016
+		opcode.Make(opcode.OpConstant, 3),
+		// 0019
+		opcode.Make(opcode.OpPop),
+		// 0020
+		opcode.Make(opcode.OpThrow),
+		// 0021
+		opcode.Make(opcode.OpReturnValue),
+	}
+	if err := testInstructions(expected, fn.Instructions); err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	expectedHandlers := []object.Handler{
+		{Start: 0, End: 3, Target: 16, Depth: 0},
+		{Start: 8, End: 9, Target: 16, Depth: 0},
+	}
+	if !reflect.DeepEqual(fn.Handlers, expectedHandlers) {
+		t.Errorf("wrong handlers. expected=%+v, got=%+v", expectedHandlers, fn.Handlers)
+	}
+}
+
+func TestImportStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `import "lib.sv" as lib; lib.x`,
+			expectedConstants: []interface{}{"lib.sv", "x"},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpImport, 0),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpGetMember, 1),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	compiler := New()
+	err := compiler.Compile(parse(`const lib = 1; import "lib.sv" as lib`))
+	if err == nil || err.Error() != "NameError: cannot redeclare constant: lib" {
+		t.Errorf("wrong error. expected=%q, got=%v", "NameError: cannot redeclare constant: lib", err)
+	}
+}
+
+func TestExportStatements(t *testing.T) {
+	compiler := New()
+	err := compiler.Compile(parse(`export let x = 1; export fn f() { x }; let hidden = 2`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := []string{"x", "f"}
+	if !reflect.DeepEqual(compiler.Bytecode().Exports, expected) {
+		t.Errorf("wrong exports. expected=%v, got=%v", expected, compiler.Bytecode().Exports)
+	}
+}
+
+func TestMemberExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let h = {}; h.a.b`,
+			expectedConstants: []interface{}{"a", "b"},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpHash, 0),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpGetMember, 0),
+				opcode.Make(opcode.OpGetMember, 1),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             `let h = {}; h.a += 1`,
+			expectedConstants: []interface{}{1, "a"},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpHash, 0),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpSetMember, 1, int(opcode.OpAdd)),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestNullCoalescing(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// The right side is skipped unless the left is null
+			input:             "null ?? 5",
+			expectedConstants: []interface{}{5},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpNull),
+				// 0001
+				opcode.Make(opcode.OpJumpNotNull, 7),
+				// 0004
+				opcode.Make(opcode.OpConstant, 0),
+				// 0007
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestOptionalChaining(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// A link that short-circuits skips the rest of the chain
+			input:             "let h = null; h?.a.b",
+			expectedConstants: []interface{}{"a", "b"},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpNull),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				// 0004
+				opcode.Make(opcode.OpGetGlobal, 0),
+				// 0007
+				opcode.Make(opcode.OpJumpMissingMember, 0, 18),
+				// 0012
+				opcode.Make(opcode.OpGetMember, 0),
+				opcode.Make(opcode.OpGetMember, 1),
+				// 0018
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "let a = [1]; a?.[0]",
+			expectedConstants: []interface{}{1, 0},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpArray, 1),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				// 0009
+				opcode.Make(opcode.OpGetGlobal, 0),
+				// 0012
+				opcode.Make(opcode.OpJumpNull, 22),
+				// 0015
+				opcode.Make(opcode.OpConstant, 1),
+				// 0018
+				opcode.Make(opcode.OpJumpMissingIndex, 22),
+				// 0021
+				opcode.Make(opcode.OpIndex),
+				// 0022
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "let f = null; f?.(1)",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpNull),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				// 0004
+				opcode.Make(opcode.OpGetGlobal, 0),
+				// 0007
+				opcode.Make(opcode.OpJumpNull, 15),
+				// 0010
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpCall, 1),
+				// 0015
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestRangeExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// An omitted step is pushed as null
+			input:             "0..10",
+			expectedConstants: []interface{}{0, 10},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpNull),
+				opcode.Make(opcode.OpRange, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             "1..=9 by 2",
+			expectedConstants: []interface{}{1, 9, 2},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpRange, 1),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStructStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `struct Point { x, y }; Point(1, 2).x`,
+			expectedConstants: []interface{}{
+				&object.StructType{Name: "Point", Fields: []string{"x", "y"}},
+				1,
+				2,
+				"x",
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpStruct, 0),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				opcode.Make(opcode.OpGetGlobal, 0),
+				opcode.Make(opcode.OpConstant, 1),
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpCall, 2),
+				opcode.Make(opcode.OpGetMember, 3),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"a,b".split(",")`,
+			expectedConstants: []interface{}{"a,b", "split", ","},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpGetMember, 1),
+				opcode.Make(opcode.OpConstant, 2),
+				opcode.Make(opcode.OpCall, 1),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let x = [1]; match (x) { [a] if a => a, _ => 0 }`,
+			expectedConstants: []interface{}{1, pattern("[a]"), pattern("_"), 0},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpConstant, 0),
+				// 0003
+				opcode.Make(opcode.OpArray, 1),
+				// 0006
+				opcode.Make(opcode.OpSetGlobal, 0),
+				// 0009
+				opcode.Make(opcode.OpGetGlobal, 0),
+				// 0012
+				opcode.Make(opcode.OpDup),
+				// 0013
+				opcode.Make(opcode.OpMatch, 1, 1, 36),
+				// 0020
+				opcode.Make(opcode.OpSetLocal, 0),
+				// 0023
+				opcode.Make(opcode.OpGetLocal, 0),
+				// 0026
+				opcode.Make(opcode.OpJumpNotTruthy, 36),
+				// 0029
+				opcode.Make(opcode.OpPop),
+				// 0030
+				opcode.Make(opcode.OpGetLocal, 0),
+				// 0033
+				opcode.Make(opcode.OpJump, 52),
+				// 0036
+				opcode.Make(opcode.OpDup),
+				// 0037
+				opcode.Make(opcode.OpMatch, 2, 0, 51),
+				// 0044
+				opcode.Make(opcode.OpPop),
+				// 0045
+				opcode.Make(opcode.OpConstant, 3),
+				// 0048
+				opcode.Make(opcode.OpJump, 52),
+				// 0051
+				opcode.Make(opcode.OpNoMatch),
+				// 0052
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let [a, ...b] = [1]; b`,
+			expectedConstants: []interface{}{1, pattern("[a, ...b]")},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpConstant, 0),
+				opcode.Make(opcode.OpArray, 1),
+				opcode.Make(opcode.OpDestructure, 1, 2),
+				opcode.Make(opcode.OpSetGlobal, 1),
+				opcode.Make(opcode.OpSetGlobal, 0),
+				opcode.Make(opcode.OpGetGlobal, 1),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input: `fn() { let {"k": v} = {}; v }`,
+			expectedConstants: []interface{}{
+				compiledFunction{
+					constants: []interface{}{pattern("{k: v}")},
+					instructions: []opcode.Instructions{
+						opcode.Make(opcode.OpHash, 0),
+						opcode.Make(opcode.OpDestructure, 0, 1),
+						opcode.Make(opcode.OpSetLocal, 0),
+						opcode.Make(opcode.OpGetLocal, 0),
+						opcode.Make(opcode.OpReturnValue),
+					},
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestComprehensions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `[x * 2 for x in [1] if x]`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpArray, 0),
+				// 0003
+				opcode.Make(opcode.OpConstant, 0),
+				// 0006
+				opcode.Make(opcode.OpArray, 1),
+				// 0009
+				opcode.Make(opcode.OpIter),
+				// 0010
+				opcode.Make(opcode.OpCloseUpvalues, 0),
+				// 0013
+				opcode.Make(opcode.OpIterNext, 37),
+				// 0016
+				opcode.Make(opcode.OpSetLocal, 0),
+				// 0019
+				opcode.Make(opcode.OpGetLocal, 0),
+				// 0022
+				opcode.Make(opcode.OpJumpNotTruthy, 10),
+				// 0025
+				opcode.Make(opcode.OpGetLocal, 0),
+				// 0028
+				opcode.Make(opcode.OpConstant, 1),
+				// 0031
+				opcode.Make(opcode.OpMultiply),
+				// 0032
+				opcode.Make(opcode.OpAppend, 1),
+				// 0034
+				opcode.Make(opcode.OpJump, 10),
+				// 0037
+				opcode.Make(opcode.OpPop),
+			},
+		},
+		{
+			input:             `{k: 1 for k in []}`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []opcode.Instructions{
+				// 0000
+				opcode.Make(opcode.OpHash, 0),
+				// 0003
+				opcode.Make(opcode.OpArray, 0),
+				// 0006
+				opcode.Make(opcode.OpIter),
+				// 0007
+				opcode.Make(opcode.OpCloseUpvalues, 0),
+				// 0010
+				opcode.Make(opcode.OpIterNext, 27),
+				// 0013
+				opcode.Make(opcode.OpSetLocal, 0),
+				// 0016
+				opcode.Make(opcode.OpGetLocal, 0),
+				// 0019
+				opcode.Make(opcode.OpConstant, 0),
+				// 0022
+				opcode.Make(opcode.OpInsert, 1),
+				// 0024
+				opcode.Make(opcode.OpJump, 7),
+				// 0027
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a = 1) { yield a }`,
+			expectedConstants: []interface{}{
+				compiledFunction{
+					constants: []interface{}{1},
+					instructions: []opcode.Instructions{
+						opcode.Make(opcode.OpJumpIfBound, 0, 11),
+						opcode.Make(opcode.OpConstant, 0),
+						opcode.Make(opcode.OpSetLocal, 0),
+						opcode.Make(opcode.OpGenerator),
+						opcode.Make(opcode.OpGetLocal, 0),
+						opcode.Make(opcode.OpYield),
+						opcode.Make(opcode.OpReturnValue),
+					},
+				},
+			},
+			expectedInstructions: []opcode.Instructions{
+				opcode.Make(opcode.OpClosure, 0),
+				opcode.Make(opcode.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
@@ -0,0 +1,205 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	FreeScope    SymbolScope = "FREE"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	// Const is set for names declared with const, which the compiler
+	// refuses to assign to or declare again
+	Const bool
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+	// block is set for the table of a block, whose names live in local slots
+	// of the frame the block runs in
+	block bool
+	// numLocals counts the local slots the frame needs, including the slots
+	// of the blocks in it
+	numLocals int
+	// withdrawn holds the names taken back out of the table by Withdraw,
+	// which keep their slots when they are declared again
+	withdrawn map[string]Symbol
+
+	// FreeSymbols holds the symbols of enclosing functions that the function
+	// of the table captures, by the index of the free symbol for each
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	return &SymbolTable{store: s}
+}
+
+// NewEnclosedSymbolTable creates the table of a function declared in the
+// scope of outer.
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NewBlockSymbolTable creates the table of a block nested in outer. Names
+// declared in the block are not visible after it, and shadow the names of
+// enclosing scopes while it runs.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	s.block = true
+	return s
+}
+
+// Define declares name in the table. Declaring a name that is already in the
+// table reuses its slot, just as a second let replaces the binding in the
+// interpreter. Every name declared in a block gets a slot of its own, so
+// that values in the slots of a block never need clearing.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.Declared(name); ok {
+		return symbol
+	}
+	if symbol, ok := s.withdrawn[name]; ok {
+		delete(s.withdrawn, name)
+		symbol.Const = false
+		s.store[name] = symbol
+		return symbol
+	}
+
+	var symbol Symbol
+	if s.Outer == nil {
+		symbol = Symbol{Name: name, Index: s.numDefinitions, Scope: GlobalScope}
+		s.numDefinitions++
+	} else {
+		frame := s.frame()
+		symbol = Symbol{Name: name, Index: frame.numLocals, Scope: LocalScope}
+		frame.numLocals++
+	}
+
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineConst declares name in the table as a constant.
+func (s *SymbolTable) DefineConst(name string) Symbol {
+	symbol := s.Define(name)
+	symbol.Const = true
+	s.store[name] = symbol
+	return symbol
+}
+
+// ReserveLocals sets aside the next n local slots of the frame of the table,
+// for names that are declared later with DefineLocal.
+func (s *SymbolTable) ReserveLocals(n int) {
+	s.frame().numLocals += n
+}
+
+// DefineLocal declares name in the table in a slot set aside by
+// ReserveLocals.
+func (s *SymbolTable) DefineLocal(name string, index int) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: LocalScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// Withdraw takes name back out of the table, so that it resolves to the
+// enclosing scopes again until it is declared once more. The name keeps its
+// slot, for the functions compiled while it was declared to find its value.
+func (s *SymbolTable) Withdraw(name string) {
+	symbol, ok := s.Declared(name)
+	if !ok {
+		return
+	}
+
+	if s.withdrawn == nil {
+		s.withdrawn = make(map[string]Symbol)
+	}
+	s.withdrawn[name] = symbol
+	delete(s.store, name)
+}
+
+// DefineGlobal declares name in the global table at the root of s, for names
+// that are used before any declaration of them has been compiled.
+func (s *SymbolTable) DefineGlobal(name string) Symbol {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+
+	return s.Define(name)
+}
+
+// Resolve looks up name in the table and then in the enclosing ones, so the
+// innermost declaration of a name wins. A local of an enclosing function
+// becomes a free symbol of each function between it and the table.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok || s.block || symbol.Scope == GlobalScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+// Declared looks up name among the names declared in this table, ignoring
+// enclosing scopes and the names it captures from them.
+func (s *SymbolTable) Declared(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok && symbol.Scope == FreeScope {
+		return Symbol{}, false
+	}
+
+	return symbol, ok
+}
+
+// NumLocals returns the number of local slots the frame of the table needs.
+func (s *SymbolTable) NumLocals() int {
+	return s.frame().numLocals
+}
+
+// GlobalNames returns the name of each global slot, by index, for the VM to
+// report identifiers that are used before they are defined.
+func (s *SymbolTable) GlobalNames() []string {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+
+	names := make([]string, s.numDefinitions)
+	for name, symbol := range s.store {
+		names[symbol.Index] = name
+	}
+
+	return names
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope, Const: original.Const}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// frame returns the table whose frame holds the slots of s, skipping over
+// the tables of blocks.
+func (s *SymbolTable) frame() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+
+	return s
+}
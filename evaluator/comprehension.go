@@ -0,0 +1,99 @@
+package evaluator
+
+import (
+	"seville/ast"
+	"seville/object"
+)
+
+func evalArrayComprehension(node *ast.ArrayComprehension, env *object.Environment) object.Object {
+	elements := []object.Object{}
+
+	err := evalComprehensionClause(node.Clause, env, func(scope *object.Environment) object.Object {
+		el := Eval(node.Element, scope)
+		if isError(el) {
+			return el
+		}
+		if el == nil {
+			el = NULL
+		}
+
+		elements = append(elements, el)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func evalHashComprehension(node *ast.HashComprehension, env *object.Environment) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	err := evalComprehensionClause(node.Clause, env, func(scope *object.Environment) object.Object {
+		key := Eval(node.Key, scope)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError(object.TypeError, "unusable as hash key: %s", key.Type())
+		}
+
+		value := Eval(node.Value, scope)
+		if isError(value) {
+			return value
+		}
+		if value == nil {
+			value = NULL
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+// evalComprehensionClause calls body once for each element of the clause's
+// iterable that passes its condition. Each call gets a fresh scope holding
+// the targets, so closures created by the body see their own element and the
+// targets never leak into env.
+func evalComprehensionClause(
+	clause *ast.ComprehensionClause,
+	env *object.Environment,
+	body func(scope *object.Environment) object.Object,
+) object.Object {
+	iterable := Eval(clause.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	return iterate(iterable, func(el object.Object) object.Object {
+		scope := object.NewEnclosedEnvironment(env)
+		bind := func(name string, val object.Object) object.Object {
+			scope.Set(name, val)
+			return val
+		}
+
+		if err := matchPattern(clause.Target, el, env, bind); err != nil {
+			return withPosition(err, clause.Token)
+		}
+
+		if clause.Condition != nil {
+			condition := Eval(clause.Condition, scope)
+			if isError(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return nil
+			}
+		}
+
+		return body(scope)
+	})
+}
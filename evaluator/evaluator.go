@@ -5,67 +5,37 @@ import (
 	"math"
 	"seville/ast"
 	"seville/object"
-	"unicode/utf8"
+	"seville/token"
+	"strings"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+	NULL  = object.NULL
 )
 
-var builtins = map[string]*object.Builtin{
-	"len": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
-			switch arg := args[0].(type) {
-			case *object.String:
-				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
-			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
-			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
-			}
-		},
-	},
-	"push": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2", len(args))
-			}
-
-			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
-			}
+// shortCircuited is what an optional link evaluates to when it
+// short-circuits. The links after it in the chain pass it on without
+// evaluating anything, and the OptionalChain around them turns it into null.
+// Its type is distinct from *object.Null so that it never equals NULL.
+var shortCircuited object.Object = &shortCircuit{}
 
-			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
+type shortCircuit struct{ object.Null }
 
-			newElements := make([]object.Object, length+1)
-			copy(newElements, arr.Elements)
-			newElements[length] = args[1]
+// builtins holds the builtin functions by name.
+var builtins = map[string]*object.Builtin{}
 
-			return &object.Array{Elements: newElements}
-		},
-	},
-	"print": {
-		Fn: func(args ...object.Object) object.Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
-			}
-
-			return NULL
-		},
-	},
+func init() {
+	for _, def := range object.Builtins {
+		builtins[def.Name] = def.Builtin
+	}
 }
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return withPosition(evalIdentifier(node, env), node.Token)
 	case *ast.Program:
 		return evalProgram(node.Statements, env)
 	case *ast.ExpressionStatement:
@@ -80,82 +50,168 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		} else {
 			return FALSE
 		}
+	case *ast.NullLiteral:
+		return NULL
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return withPosition(evalPrefixExpression(node.Operator, right), node.Token)
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
+		// The right side of ?? is only evaluated when it is needed
+		if node.Operator == "??" {
+			if left != NULL {
+				return left
+			}
+			return Eval(node.Right, env)
+		}
+
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return withPosition(evalInfixExpression(node.Operator, left, right), node.Token)
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
+	case *ast.ComparisonChain:
+		return withPosition(evalComparisonChain(node, env), node.Token)
+	case *ast.RangeExpression:
+		return withPosition(evalRangeExpression(node, env), node.Token)
+	case *ast.YieldExpression:
+		return withPosition(evalYieldExpression(node, env), node.Token)
+	case *ast.ConditionalExpression:
+		condition := Eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if isTruthy(condition) {
+			return Eval(node.Consequence, env)
+		}
+		return Eval(node.Alternative, env)
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.ThrowStatement:
+		return evalThrowStatement(node, env)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+	case *ast.MatchExpression:
+		return withPosition(evalMatchExpression(node, env), node.Token)
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
-			return val
-		}
-		env.Set(node.Name.Value, val)
+		return withPosition(evalLetStatement(node, env), node.Token)
+	case *ast.FunctionStatement:
+		// Already bound by hoistFunctions when the enclosing block started
+		return nil
+	case *ast.StructStatement:
+		return withPosition(evalStructStatement(node, env), node.Token)
+	case *ast.ImportStatement:
+		return withPosition(evalImportStatement(node, env), node.Token)
+	case *ast.ExportStatement:
+		return evalExportStatement(node, env)
 	case *ast.FunctionLiteral:
-		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+		return &object.Function{
+			Name:       node.Name,
+			Parameters: node.Parameters,
+			Defaults:   node.Defaults,
+			Rest:       node.Rest,
+			Body:       node.Body,
+			Env:        env,
+			Generator:  node.Generator,
+		}
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
 
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		if function == shortCircuited {
+			return function
+		}
+		if node.Optional && function == NULL {
+			return shortCircuited
+		}
+
+		args, kwargs, err := evalCallArguments(node.Arguments, env)
+		if err != nil {
+			return err
 		}
 
-		return applyFunction(function, args)
+		result := withPosition(applyFunction(function, args, kwargs), node.Token)
+		if err, ok := result.(*object.Error); ok {
+			return withStackFrame(err, newStackFrame(node, function))
+		}
+
+		return result
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
+	case *ast.ArrayComprehension:
+		return withPosition(evalArrayComprehension(node, env), node.Token)
+	case *ast.HashComprehension:
+		return withPosition(evalHashComprehension(node, env), node.Token)
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
+		if left == shortCircuited {
+			return left
+		}
+		if node.Optional && left == NULL {
+			return shortCircuited
+		}
+
 		index := Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
 
-		return evalIndexExpression(left, index)
+		if node.Optional && object.IsMissingIndex(left, index) {
+			return shortCircuited
+		}
+
+		return withPosition(evalIndexExpression(left, index), node.Token)
+	case *ast.SliceExpression:
+		return withPosition(evalSliceExpression(node, env), node.Token)
+	case *ast.MemberExpression:
+		return withPosition(evalMemberExpression(node, env), node.Property.Token)
+	case *ast.OptionalChain:
+		val := Eval(node.Expression, env)
+		if val == shortCircuited {
+			return NULL
+		}
+		return val
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return withPosition(evalHashLiteral(node, env), node.Token)
 	case *ast.AssignmentExpression:
-		return evalAssignmentExpression(node, env)
+		return withPosition(evalAssignmentExpression(node, env), node.Token)
 	}
 
 	return nil
 }
 
 func evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
+	if err := hoistFunctions(stmts, env); err != nil {
+		return err
+	}
+
 	var result object.Object
 
 	for _, statement := range stmts {
@@ -178,8 +234,14 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		integer, ok := right.(*object.Integer)
+		if !ok {
+			return newError(object.TypeError, "unknown operator: ~%s", right.Type())
+		}
+		return &object.Integer{Value: ^integer.Value}
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -197,6 +259,8 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 		return FALSE
 	case FALSE:
 		return TRUE
+	case NULL:
+		return TRUE
 	default:
 		return FALSE
 	}
@@ -205,7 +269,7 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	integer, ok := right.(*object.Integer)
 	if !ok {
-		return newError("unknown operator: -%s", right.Type())
+		return newError(object.TypeError, "unknown operator: -%s", right.Type())
 	}
 
 	return &object.Integer{Value: -integer.Value}
@@ -217,6 +281,11 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 		return evalIntegerInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
+	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ && operator != "in":
+		return evalArrayInfixExpression(operator, left, right)
+	case left.Type() == object.STRUCT_OBJ && right.Type() == object.STRUCT_OBJ,
+		left.Type() == object.RANGE_OBJ && right.Type() == object.RANGE_OBJ:
+		return evalValueInfixExpression(operator, left, right)
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
@@ -233,17 +302,23 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 		case *object.Hash:
 			key, ok := left.(object.Hashable)
 			if !ok {
-				return newError("unusable as hash key: %s", left.Type())
+				return newError(object.TypeError, "unusable as hash key: %s", left.Type())
 			}
 			_, ok = iter.Pairs[key.HashKey()]
 			return nativeBoolToBooleanObject(ok)
+		case *object.Range:
+			n, ok := left.(*object.Integer)
+			if !ok {
+				return FALSE
+			}
+			return nativeBoolToBooleanObject(iter.Contains(n.Value))
 		default:
-			return newError("The `in` keyword is not supported for type %s", right.Type())
+			return newError(object.TypeError, "The `in` keyword is not supported for type %s", right.Type())
 		}
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -259,9 +334,31 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError(object.ZeroDivisionError, "division by zero: %d / 0", leftVal)
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError(object.ZeroDivisionError, "modulo by zero: %d %% 0", leftVal)
+		}
+		return &object.Integer{Value: leftVal % rightVal}
 	case "**":
 		return &object.Integer{Value: int64(math.Pow(float64(leftVal), float64(rightVal)))}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<", ">>":
+		if rightVal < 0 {
+			return newError(object.ArgumentError, "negative shift count: %d %s %d", leftVal, operator, rightVal)
+		}
+		if operator == "<<" {
+			return &object.Integer{Value: leftVal << rightVal}
+		}
+		return &object.Integer{Value: leftVal >> rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
@@ -275,7 +372,7 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -290,8 +387,80 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
+	case "<", ">", "<=", ">=":
+		return evalOrderingComparison(operator, left, right)
+	default:
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// Arrays are equal when their elements are, and ordered lexicographically
+func evalArrayInfixExpression(operator string, left, right object.Object) object.Object {
+	switch operator {
+	case "==":
+		return nativeBoolToBooleanObject(left.Equals(right))
+	case "!=":
+		return nativeBoolToBooleanObject(!left.Equals(right))
+	case "<", ">", "<=", ">=":
+		return evalOrderingComparison(operator, left, right)
+	default:
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalOrderingComparison(operator string, left, right object.Object) object.Object {
+	c, ok := object.Compare(left, right)
+	if !ok {
+		return newError(object.TypeError, "cannot compare %s %s %s", left.Inspect(), operator, right.Inspect())
+	}
+
+	switch operator {
+	case "<":
+		return nativeBoolToBooleanObject(c < 0)
+	case ">":
+		return nativeBoolToBooleanObject(c > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(c <= 0)
+	default:
+		return nativeBoolToBooleanObject(c >= 0)
+	}
+}
+
+// evalComparisonChain evaluates a < b < c as a < b and b < c, evaluating b
+// only once and c only if a < b holds.
+func evalComparisonChain(node *ast.ComparisonChain, env *object.Environment) object.Object {
+	left := Eval(node.Operands[0], env)
+	if isError(left) {
+		return left
+	}
+
+	for i, operator := range node.Operators {
+		right := Eval(node.Operands[i+1], env)
+		if isError(right) {
+			return right
+		}
+
+		result := evalInfixExpression(operator, left, right)
+		if isError(result) || !isTruthy(result) {
+			return result
+		}
+
+		left = right
+	}
+
+	return TRUE
+}
+
+// evalValueInfixExpression compares structs and ranges by value rather than
+// by identity.
+func evalValueInfixExpression(operator string, left, right object.Object) object.Object {
+	switch operator {
+	case "==":
+		return nativeBoolToBooleanObject(left.Equals(right))
+	case "!=":
+		return nativeBoolToBooleanObject(!left.Equals(right))
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -301,13 +470,28 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 		return condition
 	}
 
+	// Each branch gets its own scope, so bindings declared inside it are not
+	// visible once the if expression is done
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
-	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
-	} else {
-		return NULL
+		return Eval(ie.Consequence, object.NewEnclosedEnvironment(env))
 	}
+
+	for _, elif := range ie.Alternatives {
+		condition := Eval(elif.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if isTruthy(condition) {
+			return Eval(elif.Consequence, object.NewEnclosedEnvironment(env))
+		}
+	}
+
+	if ie.Alternative != nil {
+		return Eval(ie.Alternative, object.NewEnclosedEnvironment(env))
+	}
+
+	return NULL
 }
 
 func isTruthy(obj object.Object) bool {
@@ -324,6 +508,10 @@ func isTruthy(obj object.Object) bool {
 }
 
 func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	if err := hoistFunctions(block.Statements, env); err != nil {
+		return err
+	}
+
 	var result object.Object
 
 	for _, statement := range block.Statements {
@@ -338,8 +526,53 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+// hoistFunctions binds every function declared directly in stmts before any
+// of them run, so that declarations can call each other in any order.
+func hoistFunctions(stmts []ast.Statement, env *object.Environment) object.Object {
+	for _, statement := range stmts {
+		if export, ok := statement.(*ast.ExportStatement); ok {
+			statement = export.Statement
+		}
+
+		decl, ok := statement.(*ast.FunctionStatement)
+		if !ok {
+			continue
+		}
+
+		if env.DeclaresConst(decl.Name.Value) {
+			err := newError(object.NameError, "cannot redeclare constant: %s", decl.Name.Value)
+			return withPosition(err, decl.Name.Token)
+		}
+
+		env.Set(decl.Name.Value, Eval(decl.Function, env))
+	}
+
+	return nil
+}
+
+func newError(kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
+// withPosition records the position of tok on obj if it is an error that
+// does not have a position yet. Errors propagate outwards, so the innermost
+// expression that can raise an error is the one that gets recorded.
+func withPosition(obj object.Object, tok token.Token) object.Object {
+	if err, ok := obj.(*object.Error); ok && err.Line == 0 {
+		err = err.Copy()
+		err.Line, err.Column = tok.Line, tok.Column
+		return err
+	}
+
+	return obj
+}
+
+// withStackFrame returns a copy of err with frame added to its stack, leaving
+// err itself untouched in case it is held by a caught exception.
+func withStackFrame(err *object.Error, frame object.StackFrame) *object.Error {
+	err = err.Copy()
+	err.Stack = append(err.Stack, frame)
+	return err
 }
 
 func isError(obj object.Object) bool {
@@ -357,7 +590,7 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newError(object.NameError, "identifier not found: %s", node.Value)
 }
 
 func evalExpressions(
@@ -376,28 +609,176 @@ func evalExpressions(
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// evalCallArguments evaluates the arguments of a call, expanding spread
+// arguments into the positional ones.
+func evalCallArguments(
+	exps []ast.Expression,
+	env *object.Environment,
+) ([]object.Object, []object.KeywordArgument, object.Object) {
+	args := []object.Object{}
+	kwargs := []object.KeywordArgument{}
+
+	for _, exp := range exps {
+		switch exp := exp.(type) {
+		case *ast.SpreadExpression:
+			evaluated := Eval(exp.Value, env)
+			if isError(evaluated) {
+				return nil, nil, evaluated
+			}
+
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				return nil, nil, withPosition(newError(object.TypeError, "cannot spread %s as arguments", evaluated.Type()), exp.Token)
+			}
+			args = append(args, array.Elements...)
+		case *ast.KeywordArgument:
+			evaluated := Eval(exp.Value, env)
+			if isError(evaluated) {
+				return nil, nil, evaluated
+			}
+			kwargs = append(kwargs, object.KeywordArgument{Name: exp.Name.Value, Value: evaluated})
+		default:
+			evaluated := Eval(exp, env)
+			if isError(evaluated) {
+				return nil, nil, evaluated
+			}
+			args = append(args, evaluated)
+		}
+	}
+
+	return args, kwargs, nil
+}
+
+func applyFunction(fn object.Object, args []object.Object, kwargs []object.KeywordArgument) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
+		extendedEnv, err := extendFunctionEnv(fn, args, kwargs)
+		if err != nil {
+			return err
+		}
+		if fn.Generator {
+			return newGenerator(fn, extendedEnv)
+		}
 		evaluated := Eval(fn.Body, extendedEnv)
 		return unWrapReturnValue(evaluated)
+	case *object.StructType:
+		instance, err := fn.Construct(args, kwargs)
+		if err != nil {
+			return err
+		}
+		return instance
 	case *object.Builtin:
+		if len(kwargs) > 0 {
+			return newError(object.ArgumentError, "builtin functions do not accept keyword arguments, got %s", kwargs[0].Name)
+		}
 		// We don't need to unwrapReturnValue here because built-in functions
 		// never return an *object.ReturnValue
+		if fn.CallFn != nil {
+			return fn.CallFn(callFunction, args...)
+		}
 		return fn.Fn(args...)
 	}
 
-	return newError("not a function: %s", fn.Type())
+	return newError(object.TypeError, "not a function: %s", fn.Type())
+}
+
+// callFunction calls fn for the builtins that are passed a function.
+func callFunction(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(fn, args, nil)
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// extendFunctionEnv binds the arguments of a call to the parameters of fn.
+// Positional arguments are bound in order, with any extras collected by the
+// rest parameter, then keyword arguments by name. Parameters that are still
+// unbound take their default value, which may refer to earlier parameters.
+func extendFunctionEnv(
+	fn *object.Function,
+	args []object.Object,
+	kwargs []object.KeywordArgument,
+) (*object.Environment, *object.Error) {
 	extendedEnv := object.NewEnclosedEnvironment(fn.Env)
-	for i, param := range fn.Parameters {
-		extendedEnv.Set(param.Value, args[i])
+
+	if len(args) > len(fn.Parameters) && fn.Rest == nil {
+		return nil, newError(object.ArgumentError, "too many arguments. got=%d, want at most %d", len(args), len(fn.Parameters))
+	}
+
+	bound := map[string]object.Object{}
+	for i, arg := range args {
+		if i >= len(fn.Parameters) {
+			break
+		}
+		bound[fn.Parameters[i].Value] = arg
+	}
+
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		extendedEnv.Set(fn.Rest.Value, &object.Array{Elements: rest})
+	}
+
+	for _, kwarg := range kwargs {
+		if !hasParameter(fn, kwarg.Name) {
+			return nil, newError(object.ArgumentError, "unexpected keyword argument %s", kwarg.Name)
+		}
+		if _, ok := bound[kwarg.Name]; ok {
+			return nil, newError(object.ArgumentError, "multiple values for parameter %s", kwarg.Name)
+		}
+		bound[kwarg.Name] = kwarg.Value
+	}
+
+	for _, param := range fn.Parameters {
+		if val, ok := bound[param.Value]; ok {
+			extendedEnv.Set(param.Value, val)
+			continue
+		}
+
+		def, ok := fn.Defaults[param.Value]
+		if !ok {
+			return nil, newError(object.ArgumentError, "missing argument for parameter %s", param.Value)
+		}
+
+		val := Eval(def, extendedEnv)
+		if isError(val) {
+			return nil, val.(*object.Error)
+		}
+		extendedEnv.Set(param.Value, val)
 	}
 
-	return extendedEnv
+	return extendedEnv, nil
+}
+
+func hasParameter(fn *object.Function, name string) bool {
+	for _, param := range fn.Parameters {
+		if param.Value == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newStackFrame describes a call by the name the function was declared with,
+// falling back to the name it was called through, as in f(1) or m.f(1), or to
+// <anonymous> when it was called some other way, e.g. f(1)(2). The frame
+// points at that name if there is one, else the opening parenthesis.
+func newStackFrame(node *ast.CallExpression, function object.Object) object.StackFrame {
+	frame := object.StackFrame{Function: "<anonymous>", Line: node.Token.Line, Column: node.Token.Column}
+
+	switch callee := node.Function.(type) {
+	case *ast.Identifier:
+		frame = object.StackFrame{Function: callee.Value, Line: callee.Token.Line, Column: callee.Token.Column}
+	case *ast.MemberExpression:
+		prop := callee.Property
+		frame = object.StackFrame{Function: prop.Value, Line: prop.Token.Line, Column: prop.Token.Column}
+	}
+
+	if fn, ok := function.(*object.Function); ok && fn.Name != "" {
+		frame.Function = fn.Name
+	}
+
+	return frame
 }
 
 func unWrapReturnValue(obj object.Object) object.Object {
@@ -408,35 +789,154 @@ func unWrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
+func evalRangeExpression(node *ast.RangeExpression, env *object.Environment) object.Object {
+	bounds := []object.Object{}
+	for _, exp := range []ast.Expression{node.Start, node.End, node.Step} {
+		if exp == nil {
+			bounds = append(bounds, nil)
+			continue
+		}
+
+		val := Eval(exp, env)
+		if isError(val) {
+			return val
+		}
+		bounds = append(bounds, val)
+	}
+
+	rng, err := object.NewRange(bounds[0], bounds[1], bounds[2], node.Inclusive)
+	if err != nil {
+		return err
+	}
+
+	return rng
+}
+
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
+	case left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalRangeIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.EXCEPTION_OBJ:
+		val, err := left.(*object.Exception).Index(index)
+		if err != nil {
+			return err
+		}
+		return val
 	default:
 		// TODO: Imporve the error message here with invalid index type
-		return newError("index operator not supported: %s", left.Type())
+		return newError(object.TypeError, "index operator not supported: %s", left.Type())
 	}
 }
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
 	rawIdx := index.(*object.Integer).Value
-	maxIdx := int64(len(arrayObject.Elements) - 1)
+	length := int64(len(arrayObject.Elements))
 
-	var adjIdx int64
-	if rawIdx < 0 {
-		adjIdx = int64(len(arrayObject.Elements) + int(rawIdx))
-	} else {
-		adjIdx = rawIdx
+	adjIdx, ok := object.NormalizeIndex(rawIdx, length)
+	if !ok {
+		return newError(object.IndexError, "array index out of bounds: given index %d, array length is: %d", rawIdx, length)
 	}
 
-	if adjIdx > maxIdx || adjIdx < 0 {
-		return newError("array index out of bounds: given index %d, array length is: %d", rawIdx, maxIdx+1)
+	return arrayObject.Elements[adjIdx]
+}
+
+func evalRangeIndexExpression(rng, index object.Object) object.Object {
+	rangeObject := rng.(*object.Range)
+	rawIdx := index.(*object.Integer).Value
+	length := rangeObject.Len()
+
+	adjIdx, ok := object.NormalizeIndex(rawIdx, length)
+	if !ok {
+		return newError(object.IndexError, "range index out of bounds: given index %d, range length is: %d", rawIdx, length)
 	}
 
-	return arrayObject.Elements[adjIdx]
+	return &object.Integer{Value: rangeObject.At(adjIdx)}
+}
+
+// Strings are indexed by rune rather than by byte, consistent with len
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	runes := []rune(str.(*object.String).Value)
+	rawIdx := index.(*object.Integer).Value
+	length := int64(len(runes))
+
+	adjIdx, ok := object.NormalizeIndex(rawIdx, length)
+	if !ok {
+		return newError(object.IndexError, "string index out of bounds: given index %d, string length is: %d", rawIdx, length)
+	}
+
+	return &object.String{Value: string(runes[adjIdx])}
+}
+
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if left == shortCircuited {
+		return left
+	}
+	if node.Optional && left == NULL {
+		return shortCircuited
+	}
+
+	// Omitted and null bounds are left nil
+	bounds := []*int64{}
+	for _, exp := range []ast.Expression{node.Start, node.End, node.Step} {
+		if exp == nil {
+			bounds = append(bounds, nil)
+			continue
+		}
+
+		bound := Eval(exp, env)
+		if isError(bound) {
+			return bound
+		}
+
+		switch bound := bound.(type) {
+		case *object.Integer:
+			bounds = append(bounds, &bound.Value)
+		case *object.Null:
+			bounds = append(bounds, nil)
+		default:
+			return newError(object.TypeError, "slice indices must be integers, got %s", bound.Type())
+		}
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		indices, err := object.SliceIndices(int64(len(left.Elements)), bounds[0], bounds[1], bounds[2])
+		if err != nil {
+			return err
+		}
+
+		elements := make([]object.Object, 0, len(indices))
+		for _, i := range indices {
+			elements = append(elements, left.Elements[i])
+		}
+		return &object.Array{Elements: elements}
+	case *object.String:
+		runes := []rune(left.Value)
+		indices, err := object.SliceIndices(int64(len(runes)), bounds[0], bounds[1], bounds[2])
+		if err != nil {
+			return err
+		}
+
+		sliced := make([]rune, 0, len(indices))
+		for _, i := range indices {
+			sliced = append(sliced, runes[i])
+		}
+		return &object.String{Value: string(sliced)}
+	default:
+		return newError(object.TypeError, "slice operator not supported: %s", left.Type())
+	}
 }
 
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
@@ -450,7 +950,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			return newError(object.TypeError, "unusable as hash key: %s", key.Type())
 		}
 
 		value := Eval(valueNode, env)
@@ -470,22 +970,104 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return newError(object.TypeError, "unusable as hash key: %s", index.Type())
 	}
 
 	pair, ok := hashObject.Pairs[key.HashKey()]
 	if !ok {
-		return newError("key %s not found in hash map", index.Inspect())
+		return newError(object.KeyError, "key %s not found in hash map", index.Inspect())
 	}
 
 	return pair.Value
 }
 
+func evalMemberExpression(node *ast.MemberExpression, env *object.Environment) object.Object {
+	left := Eval(node.Object, env)
+	if isError(left) {
+		return left
+	}
+
+	if left == shortCircuited {
+		return left
+	}
+	if node.Optional && (left == NULL || object.IsMissingMember(left, node.Property.Value)) {
+		return shortCircuited
+	}
+
+	val, err := object.GetMember(left, node.Property.Value)
+	if err != nil {
+		return err
+	}
+	return val
+}
+
+func evalStructStatement(node *ast.StructStatement, env *object.Environment) object.Object {
+	if env.DeclaresConst(node.Name.Value) {
+		return newError(object.NameError, "cannot redeclare constant: %s", node.Name.Value)
+	}
+
+	fields := []string{}
+	for _, field := range node.Fields {
+		fields = append(fields, field.Value)
+	}
+
+	env.Set(node.Name.Value, &object.StructType{Name: node.Name.Value, Fields: fields})
+
+	return nil
+}
+
+func evalLetStatement(node *ast.LetStatement, env *object.Environment) object.Object {
+	for _, name := range node.Bindings() {
+		if env.DeclaresConst(name.Value) {
+			return newError(object.NameError, "cannot redeclare constant: %s", name.Value)
+		}
+	}
+
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	if node.Pattern != nil {
+		return evalDestructuringLet(node, val, env)
+	}
+
+	if node.IsConst() {
+		env.SetConst(node.Name.Value, val)
+	} else {
+		env.Set(node.Name.Value, val)
+	}
+
+	return nil
+}
+
 func evalAssignmentExpression(node *ast.AssignmentExpression, env *object.Environment) object.Object {
 	switch left := node.Left.(type) {
 	case *ast.Identifier:
+		if env.IsConst(left.Value) {
+			return newError(object.TypeError, "cannot assign to constant: %s", left.Value)
+		}
+
 		rightVal := Eval(node.Right, env)
-		env.Set(left.Value, rightVal)
+		if isError(rightVal) {
+			return rightVal
+		}
+
+		if operator, ok := compoundAssignmentOperator(node); ok {
+			currentVal := evalIdentifier(left, env)
+			if isError(currentVal) {
+				return currentVal
+			}
+
+			rightVal = evalInfixExpression(operator, currentVal, rightVal)
+			if isError(rightVal) {
+				return rightVal
+			}
+		}
+
+		if _, ok := env.Assign(left.Value, rightVal); !ok {
+			return newError(object.NameError, "cannot assign to undeclared identifier: %s", left.Value)
+		}
 		return rightVal
 	case *ast.IndexExpression:
 		collection := Eval(left.Left, env)
@@ -503,32 +1085,89 @@ func evalAssignmentExpression(node *ast.AssignmentExpression, env *object.Enviro
 			return index
 		}
 
+		// The collection and index are reused here rather than re-evaluating
+		// left, so that side effects in either only happen once
+		if operator, ok := compoundAssignmentOperator(node); ok {
+			currentVal := evalIndexExpression(collection, index)
+			if isError(currentVal) {
+				return currentVal
+			}
+
+			rightVal = evalInfixExpression(operator, currentVal, rightVal)
+			if isError(rightVal) {
+				return rightVal
+			}
+		}
+
 		return assignCollectionElementValue(collection, index, rightVal)
+	case *ast.MemberExpression:
+		obj := Eval(left.Object, env)
+		if isError(obj) {
+			return obj
+		}
+
+		name := left.Property.Value
+		if err := object.CheckSetMember(obj, name); err != nil {
+			return err
+		}
+
+		rightVal := Eval(node.Right, env)
+		if isError(rightVal) {
+			return rightVal
+		}
+
+		if operator, ok := compoundAssignmentOperator(node); ok {
+			currentVal, err := object.GetMember(obj, name)
+			if err != nil {
+				return err
+			}
+
+			rightVal = evalInfixExpression(operator, currentVal, rightVal)
+			if isError(rightVal) {
+				return rightVal
+			}
+		}
+
+		if err := object.SetMember(obj, name, rightVal); err != nil {
+			return err
+		}
+		return rightVal
 	default:
-		return newError("Invalid assignment: left is of type %T", left)
+		return newError(object.TypeError, "Invalid assignment: left is of type %T", left)
 	}
 }
 
+// compoundAssignmentOperator returns the infix operator applied by a compound
+// assignment such as += or **=, and false for a plain assignment.
+func compoundAssignmentOperator(node *ast.AssignmentExpression) (string, bool) {
+	if node.AssignmentType.Type == token.ASSIGN {
+		return "", false
+	}
+
+	return strings.TrimSuffix(node.AssignmentType.Literal, "="), true
+}
+
 func assignCollectionElementValue(collection object.Object, index object.Object, value object.Object) object.Object {
 	switch collection := collection.(type) {
 	case *object.Array:
 		index, ok := index.(*object.Integer)
 		if !ok {
-			return newError("Array indices must be integers. got=%T", index)
+			return newError(object.TypeError, "Array indices must be integers. got=%T", index)
 		}
 
 		arrayLength := int64(len(collection.Elements))
-		if index.Value >= arrayLength {
-			return newError("Array index out of bounds: given index %d, array length is %d", index.Value, arrayLength)
+		adjIdx, inBounds := object.NormalizeIndex(index.Value, arrayLength)
+		if !inBounds {
+			return newError(object.IndexError, "Array index out of bounds: given index %d, array length is %d", index.Value, arrayLength)
 		}
 
-		collection.Elements[index.Value] = value
+		collection.Elements[adjIdx] = value
 		return value
 
 	case *object.Hash:
 		key, ok := index.(object.Hashable)
 		if !ok {
-			return newError("Hashmap index must be a hashable type, got type %T", index)
+			return newError(object.TypeError, "Hashmap index must be a hashable type, got type %T", index)
 		}
 
 		keyHash := key.HashKey()
@@ -536,6 +1175,62 @@ func assignCollectionElementValue(collection object.Object, index object.Object,
 		return value
 
 	default:
-		return newError("cannot index type of %T", collection)
+		return newError(object.TypeError, "cannot index type of %T", collection)
+	}
+}
+
+func evalThrowStatement(node *ast.ThrowStatement, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	// Throwing a caught exception rethrows a copy of the original error,
+	// keeping its message, position and stack. The exception keeps the
+	// original, unchanged by the frames the copy picks up on its way out
+	if exception, ok := val.(*object.Exception); ok {
+		return exception.Error.Copy()
+	}
+
+	message := val.Inspect()
+	if str, ok := val.(*object.String); ok {
+		message = str.Value
+	}
+
+	return &object.Error{
+		Kind:    object.GenericError,
+		Message: message,
+		Value:   val,
+		Line:    node.Token.Line,
+		Column:  node.Token.Column,
+	}
+}
+
+func evalTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(node.Body, object.NewEnclosedEnvironment(env))
+
+	if err, ok := result.(*object.Error); ok && node.Catch != nil {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		if node.CatchParameter != nil {
+			catchEnv.Set(node.CatchParameter.Value, &object.Exception{Error: err})
+		}
+
+		result = Eval(node.Catch, catchEnv)
+	}
+
+	if node.Finally != nil {
+		// A return or error in the finally block replaces the result of the
+		// try and catch blocks, otherwise the value of finally is discarded
+		finally := Eval(node.Finally, object.NewEnclosedEnvironment(env))
+		switch finally.(type) {
+		case *object.ReturnValue, *object.Error:
+			return finally
+		}
 	}
+
+	if result == nil {
+		return NULL
+	}
+
+	return result
 }
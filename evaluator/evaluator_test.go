@@ -1,9 +1,11 @@
 package evaluator
 
 import (
+	"seville/ast"
 	"seville/lexer"
 	"seville/object"
 	"seville/parser"
+	"strings"
 	"testing"
 )
 
@@ -36,6 +38,20 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"2 * (10 + 15)", 50},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"10 % 3", 1},
+		{"2 * 10 % 7", 6},
+		{"0xff + 0b1 + 0o10 + 1_000", 1264},
+		{"12 & 10", 8},
+		{"12 | 3", 15},
+		{"12 ^ 10", 6},
+		{"~5", -6},
+		{"~-1", 0},
+		{"1 << 10", 1024},
+		{"-16 >> 2", -4},
+		{"1 << 64", 0},
+		{"1 | 2 ^ 3 & 4", 3},
+		{"0xff & ~0x0f | 1 << 2", 244},
+		{"let flags = 0b0101; flags & 1 << 2", 4},
 	}
 
 	for _, tt := range tests {
@@ -44,6 +60,33 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestBitwiseOperatorErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"1 << -1", "negative shift count: 1 << -1"},
+		{"8 >> -2", "negative shift count: 8 >> -2"},
+		{"~true", "unknown operator: ~BOOLEAN"},
+		{"true & false", "unknown operator: BOOLEAN & BOOLEAN"},
+		{`1 | "a"`, "type mismatch: INTEGER | STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	result, ok := obj.(*object.Integer)
 	if !ok {
@@ -150,6 +193,10 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } elif (2 > 1) { 15 } else { 20 }", 15},
+		{"if (1 > 2) { 10 } elif (2 > 3) { 15 } elif (true) { 17 } else { 20 }", 17},
+		{"if (1 > 2) { 10 } elif (2 > 3) { 15 } else { 20 }", 20},
+		{"if (1 > 2) { 10 } elif (2 > 3) { 15 }", nil},
 	}
 
 	for _, tt := range tests {
@@ -163,6 +210,53 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
+func TestBlockScoping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; if (true) { let x = 2; x }", 2},
+		{"let x = 1; if (true) { let x = 2; }; x", 1},
+		{"let x = 1; if (false) { 0 } else { let x = 3; }; x", 1},
+		{"let x = 1; if (false) { 0 } elif (true) { let x = 4; }; x", 1},
+		{"let x = 1; if (true) { x = 2 }; x", 2},
+		{"let x = 1; if (true) { let x = 2; x = 3 }; x", 1},
+		{"let x = 1; if (true) { if (true) { let x = 5; x += 1; x } }", 6},
+		{"let x = 1; if (true) { let y = x + 1; if (true) { y + x } }", 3},
+		{"const x = 1; if (true) { let x = 2; x = 3; x }", 3},
+		{
+			`let f = fn(n) {
+				if (n > 0) {
+					let n = n * 10;
+				}
+				n
+			}
+			f(2)`,
+			2,
+		},
+		{"if (true) { let y = 1 }; y", errorMessage("identifier not found: y")},
+		{"if (false) { 0 } else { let y = 1 }; y", errorMessage("identifier not found: y")},
+		{"let f = fn() { if (true) { let y = 1 }; y }; f()", errorMessage("identifier not found: y")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func testNullObject(t *testing.T, obj object.Object) bool {
 	if obj != NULL {
 		t.Errorf("object is not NULL. got=%T (+%v)", obj, obj)
@@ -171,6 +265,181 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	return true
 }
 
+func TestNullLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"null", nil},
+		{"let x = null; x", nil},
+		{"null == null", true},
+		{"null != null", false},
+		{"1 == null", false},
+		{"!null", true},
+		{"if (null) { 1 } else { 2 }", 2},
+		{"let f = fn() { if (false) { 1 } }; f() == null", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestNullCoalescing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"null ?? 5", 5},
+		{"3 ?? 5", 3},
+		{"false ?? 5", false},
+		{"null ?? null ?? 7", 7},
+		{"null ?? null", nil},
+		{"let x = null; x ?? 1 + 1", 2},
+		// The right side is not evaluated when the left side is not null
+		{"1 ?? undefined_name", 1},
+		{"null ?? undefined_name", errorMessage("identifier not found: undefined_name")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestConditionalExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true ? 1 : 2", 1},
+		{"false ? 1 : 2", 2},
+		{"null ? 1 : 2", 2},
+		{"0 ? 1 : 2", 1},
+		{"1 > 2 ? 10 : 1 < 2 ? 20 : 30", 20},
+		{"let x = 5; x > 3 ? x * 2 : x", 10},
+		{"let x = true ? 1 : 2; x + 1", 2},
+		{"true ? null : 1", nil},
+		// Only the selected branch is evaluated
+		{"true ? 1 : undefined_name", 1},
+		{"false ? undefined_name : 2", 2},
+		{"let n = 0; true ? 1 : n = 5; n", 0},
+		{"let n = 0; false ? 1 : n = 5; n", 5},
+		{"undefined_name ? 1 : 2", errorMessage("identifier not found: undefined_name")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestOptionalChaining(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let h = {"a": 1}; h?.["a"]`, 1},
+		{`let h = {"a": 1}; h?.["b"]`, nil},
+		{`let h = {"a": 1}; h?.["b"] ?? 0`, 0},
+		{`let h = null; h?.["b"]`, nil},
+		{`let h = {"a": {"b": 2}}; h?.["a"]?.["b"]`, 2},
+		{`let h = {"a": {"b": 2}}; h?.["x"]?.["b"] ?? 3`, 3},
+		{`let counts = {}; counts["x"] = (counts?.["x"] ?? 0) + 1; counts["x"]`, 1},
+		{"[1, 2]?.[1]", 2},
+		{"[1, 2]?.[2]", nil},
+		{"[1, 2]?.[-3]", nil},
+		{`"ab"?.[5]`, nil},
+		{"let a = null; a?.[1:]", nil},
+		// The index is not evaluated when the collection is null
+		{"null?.[undefined_name]", nil},
+		{"let f = fn(x) { x * 2 }; f?.(4)", 8},
+		{"let f = null; f?.(4)", nil},
+		{"let f = null; f?.(undefined_name)", nil},
+		{`{}?.[fn() {}]`, errorMessage("unusable as hash key: FUNCTION")},
+		{`let h = null; h["a"]`, errorMessage("index operator not supported: NULL")},
+		{"let f = null; f(4)", errorMessage("not a function: NULL")},
+		// A short-circuit skips the rest of the chain
+		{`let h = {}; h?.["k"]["j"]`, nil},
+		{`let h = null; h?.["k"]["j"][0]`, nil},
+		{`let h = {"k": {"j": 1}}; h?.["k"]["j"]`, 1},
+		{`let h = {"k": {}}; h?.["k"]["j"]`, errorMessage("key j not found in hash map")},
+		{"let f = null; f?.(1)(2)", nil},
+		{"let a = null; a?.[1:][0]", nil},
+		{"let h = null; h?.k.upper()", nil},
+		{"let h = null; h?.[undefined_name][undefined_name]", nil},
+		{"let h = null; h?.k.j ?? 5", 5},
+		{"let h = null; (h?.k).j", errorMessage("cannot access member j of NULL")},
+		{"let h = null; h?.k == null ? 1 : 0", 1},
+		// ?.name
+		{`let h = {"a": {"b": 2}}; h?.a?.b`, 2},
+		{`let h = {"a": {"b": 2}}; h?.a.b`, 2},
+		{`let h = {"a": 1}; h?.b`, nil},
+		{`let h = {"a": 1}; len(h?.keys())`, 1},
+		{"let h = null; h?.a", nil},
+		{`"ab"?.upper() == "AB" ? 1 : 0`, 1},
+		{"struct P { x }; let p = P(1); p?.x", 1},
+		{"struct P { x }; let p = P(1); p?.y", errorMessage("P has no field y")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestReturnStatement(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -261,6 +530,53 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedKind object.ErrorKind
+	}{
+		{"5 + true", object.TypeError},
+		{"-true", object.TypeError},
+		{`"a" - "b"`, object.TypeError},
+		{"1 in 2", object.TypeError},
+		{"5(1)", object.TypeError},
+		{`len(1)`, object.TypeError},
+		{`push(1, 2)`, object.TypeError},
+		{`{}[fn() {}]`, object.TypeError},
+		{`[1][:"a"]`, object.TypeError},
+		{`1[0]`, object.TypeError},
+		{"const x = 1; x = 2", object.TypeError},
+		{`{"a": 1}["b"]`, object.KeyError},
+		{`[1, 2][2]`, object.IndexError},
+		{`"ab"[-3]`, object.IndexError},
+		{"let arr = [1]; arr[3] = 1", object.IndexError},
+		{"foobar", object.NameError},
+		{"foobar = 1", object.NameError},
+		{"const x = 1; let x = 2", object.NameError},
+		{`len("a", "b")`, object.ArgumentError},
+		{`push([])`, object.ArgumentError},
+		{"[1][::0]", object.ArgumentError},
+		{"1 / 0", object.ZeroDivisionError},
+		{"let x = 5; x %= 0", object.ZeroDivisionError},
+		{"throw 1", object.GenericError},
+		{"let f = fn() { [][0] }; f()", object.IndexError},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Kind != tt.expectedKind {
+			t.Errorf("wrong error kind for %q. expected=%s, got=%s (%s)", tt.input, tt.expectedKind, errObj.Kind, errObj.Message)
+		}
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -278,6 +594,304 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"const a = 5; a;", 5},
+		{"const a = 5; let b = a * 2; b;", 10},
+		{"const a = 5; let f = fn() { let a = 1; a = 2; a }; f()", 2},
+		{"const a = 5; let f = fn(a) { a = 2; a }; f(1)", 2},
+		{"const a = 5; a = 6", errorMessage("cannot assign to constant: a")},
+		{"const a = 5; a += 1", errorMessage("cannot assign to constant: a")},
+		{"const a = 5; let a = 6", errorMessage("cannot redeclare constant: a")},
+		{
+			// The closure is parsed before the constant is declared, so this
+			// can only be caught at runtime
+			"let f = fn() { limit = 0 }; const limit = 10; f()",
+			errorMessage("cannot assign to constant: limit"),
+		},
+		{`const config = {"debug": false}; config["debug"] = true; config["debug"]`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestMemberExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let person = {"name": "ada", "age": 36}; person.name`, "ada"},
+		{`let p = {"inner": {"x": 5}}; p.inner.x`, 5},
+		{`let h = {"f": fn(x) { x * 2 }}; h.f(4)`, 8},
+		{`let h = {"xs": [1, 2, 3]}; h.xs[-1]`, 3},
+		{`let person = {"name": "ada"}; person.name = "grace"; person["name"]`, "grace"},
+		{`let person = {}; person.age = 1; person.age += 41; person.age`, 42},
+		{`let p = {"inner": {}}; p.inner.x = 7; p["inner"]["x"]`, 7},
+		{`let h = {"n": 1}; (h.n = 5) + 1`, 6},
+		{`try { throw "oops" } catch (e) { e.message }`, "oops"},
+		{`try { {}["k"] } catch (e) { e.type }`, "KeyError"},
+		{`let person = {"name": "ada"}; person.age`, errorMessage("key age not found in hash map")},
+		{`let person = {}; person.age += 1`, errorMessage("key age not found in hash map")},
+		{`let n = 1; n.length`, errorMessage("cannot access member length of INTEGER")},
+		{`let n = 1; n.x = 2`, errorMessage("cannot assign to member x of INTEGER")},
+		{`null.x`, errorMessage("cannot access member x of NULL")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"struct Point { x, y }; Point(1, 2)", "Point{x: 1, y: 2}"},
+		{"struct Point { x, y }; Point(y = 2, x = 1)", "Point{x: 1, y: 2}"},
+		{"struct Point { x, y }; Point", "<struct Point>"},
+		{"struct Point { x, y }; let p = Point(1, 2); p.x + p.y", 3},
+		{"struct Point { x, y }; let p = Point(1, 2); p.x = 10; p.x += 1; p", "Point{x: 11, y: 2}"},
+		{"struct Line { from, to }; struct P { x }; Line(P(1), P(2)).to.x", 2},
+		{"struct Point { x, y }; Point(1, 2) == Point(1, 2)", true},
+		{"struct Point { x, y }; Point(1, 2) != Point(1, 3)", true},
+		{"struct A { x }; struct B { x }; A(1) == B(1)", false},
+		{"struct Point { x, y }; let p = Point(1, 2); p == p", true},
+		{"struct Point { x, y }; Point(1, 2) in [Point(0, 0), Point(1, 2)]", true},
+		{"struct Point { x, y }; type(Point(1, 2))", "Point"},
+		{"struct Point { x, y }; type(Point)", "STRUCT_TYPE"},
+		{`type(1) + type("a") + type([])`, "INTEGERSTRINGARRAY"},
+		{"struct Point { x, y }; Point(1)", errorMessage("missing argument for field y")},
+		{"struct Point { x, y }; Point(1, 2, 3)", errorMessage("too many arguments. got=3, want at most 2")},
+		{"struct Point { x, y }; Point(1, 2, z = 3)", errorMessage("unexpected keyword argument z")},
+		{"struct Point { x, y }; Point(1, 2, x = 3)", errorMessage("multiple values for field x")},
+		{"struct Point { x, y }; Point(1, 2).z", errorMessage("Point has no field z")},
+		{"struct Point { x, y }; let p = Point(1, 2); p.z = 3", errorMessage("Point has no field z")},
+		{"struct Point { x, y }; Point(1, 2) + Point(1, 2)", errorMessage("unknown operator: STRUCT + STRUCT")},
+		{"type()", errorMessage("wrong number of arguments. got=0, want=1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if evaluated == nil || evaluated.Inspect() != expected {
+				t.Errorf("wrong value for %q. expected=%q, got=%+v", tt.input, expected, evaluated)
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{"let [head, ...tail] = [1, 2, 3]; head + len(tail)", 3},
+		{"let [head, ...tail] = [1]; len(tail)", 0},
+		{"let [_, second] = [1, 2]; second", 2},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", 6},
+		{`let {"name": n} = {"name": "ada", "age": 36}; n`, "ada"},
+		{`let {"pos": [x, y]} = {"pos": [3, 4]}; x * y`, 12},
+		{"let [a, b] = [1, 2]; let [a, b] = [b, a]; a * 10 + b", 21},
+		{"let f = fn(pair) { let [a, b] = pair; a - b }; f([5, 3])", 2},
+		{"const [a, b] = [1, 2]; a + b", 3},
+		{"let [a, b] = [1, 2, 3]", errorMessage("pattern [a, b] expects 2 elements, got 3")},
+		{"let [a, b, ...rest] = [1]", errorMessage("pattern [a, b, ...rest] expects at least 2 elements, got 1")},
+		{"let [a, b] = 5", errorMessage("pattern [a, b] expects an array, got INTEGER")},
+		{`let {"name": n} = {"age": 36}`, errorMessage("pattern {name: n} expects key name, which is missing")},
+		{`let {"name": n} = [1]`, errorMessage("pattern {name: n} expects a hash, got ARRAY")},
+		{"let [1, b] = [2, 3]", errorMessage("pattern 1 does not match 2")},
+		{"const a = 1; if (true) { let [a] = [2]; a }", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Kind != object.MatchError {
+				t.Errorf("wrong error kind. expected=%s, got=%s", object.MatchError, errObj.Kind)
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		}
+	}
+
+	// A failed destructuring binds none of its names
+	env := object.NewEnvironment()
+	program := parser.New(lexer.New("let a = 1; let [a, b] = [2]")).ParseProgram()
+	Eval(program, env)
+
+	a, _ := env.Get("a")
+	testIntegerObject(t, a, 1)
+	if b, ok := env.Get("b"); ok {
+		t.Errorf("b was bound by a failed destructuring. got=%+v", b)
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match (1) { 1 => "one", _ => "other" }`, "one"},
+		{`match (5) { 1 => "one", _ => "other" }`, "other"},
+		{`match (-1) { -1 => "minus one", _ => "other" }`, "minus one"},
+		{`match ("hi") { "hi" => 1, _ => 2 }`, 1},
+		{`match (null) { null => 1, _ => 2 }`, 1},
+		{`match (false) { true => 1, false => 2 }`, 2},
+		{`match (7) { n => n * 2 }`, 14},
+		{`match ([1, 2]) { [a, b] => a + b, _ => 0 }`, 3},
+		{`match ([1, 2, 3]) { [a, b] => a + b, _ => 0 }`, 0},
+		{`match ([1, 2, 3]) { [head, ...tail] => len(tail) }`, 2},
+		{`match ([1]) { [head, ...tail] => len(tail) }`, 0},
+		{`match ([]) { [head, ...tail] => 1, [] => 2 }`, 2},
+		{`match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }`, 6},
+		{`match ([1, 5]) { [1, x] => x, _ => 0 }`, 5},
+		{`match ([2, 5]) { [1, x] => x, _ => 0 }`, 0},
+		{`match ({"k": 4, "other": 1}) { {"k": v} => v, _ => 0 }`, 4},
+		{`match ({"other": 1}) { {"k": v} => v, _ => 0 }`, 0},
+		{`match ({"type": "circle", "r": 2}) { {"type": "square", "s": s} => s, {"type": "circle", "r": r} => r }`, 2},
+		{`match ("hi") { [a] => 1, {"k": v} => 2, _ => 3 }`, 3},
+		{`match (5) { n if n > 10 => "big", n if n > 0 => "small", _ => "neg" }`, "small"},
+		{`match (5) { n => { let doubled = n * 2; doubled + 1 } }`, 11},
+		{`let f = fn(x) { match (x) { 0 => { return "zero" }, _ => 1 }; "after" }; f(0)`, "zero"},
+		{`let n = 1; match (2) { n => n }; n`, 1},
+		{`match (1) { 1 => { } }`, nil},
+		{`match (3) { 1 => 1, 2 => 2 }`, errorMessage("non-exhaustive match: no pattern matched 3")},
+		{`match (3) { n if n < 0 => 1 }`, errorMessage("non-exhaustive match: no pattern matched 3")},
+		{`match (1) { n if n + true => 1 }`, errorMessage("type mismatch: INTEGER + BOOLEAN")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestMatchPatternEvaluatesInEnvironment(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("expected", &object.Integer{Value: 3})
+	env.Set("key", &object.String{Value: "k"})
+
+	ident := func(name string) *ast.Identifier { return &ast.Identifier{Value: name} }
+	pattern := &ast.HashPattern{
+		Keys:   []ast.Expression{ident("key")},
+		Values: []ast.Pattern{&ast.LiteralPattern{Value: ident("expected")}},
+	}
+
+	hash := testEval(`{"k": 3}`)
+	if err := matchPattern(pattern, hash, env, env.Set); err != nil {
+		t.Errorf("pattern did not match. got=%s", err.Message)
+	}
+
+	hash = testEval(`{"k": 4}`)
+	if err := matchPattern(pattern, hash, env, env.Set); err == nil || err.Kind != object.MatchError {
+		t.Errorf("expected a MatchError. got=%+v", err)
+	}
+
+	pattern.Keys[0] = ident("missing")
+	if err := matchPattern(pattern, hash, env, env.Set); err == nil || err.Message != "identifier not found: missing" {
+		t.Errorf("expected an error for the missing key. got=%+v", err)
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; }"
 	evaluated := testEval(input)
@@ -301,6 +915,87 @@ func TestFunctionObject(t *testing.T) {
 	}
 }
 
+func TestFunctionDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fn add(a, b) { a + b }; add(1, 2)", 3},
+		{"let x = twice(4); fn twice(n) { n * 2 }; x", 8},
+		{
+			`fn is_even(n) { if (n == 0) { return true } is_odd(n - 1) }
+			fn is_odd(n) { if (n == 0) { return false } is_even(n - 1) }
+			is_even(10)`,
+			true,
+		},
+		{"let f = fn() { return g() + 1; fn g() { 41 } }; f()", 42},
+		{"if (true) { fn h() { 1 } }; h()", errorMessage("identifier not found: h")},
+		{"fn f() { 1 }; fn f() { 2 }; f()", 2},
+		{"fn f() { 1 }; f = fn() { 3 }; f()", 3},
+		{"fn f() { 1 }", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		case nil:
+			if evaluated != nil {
+				t.Errorf("expected no value. got=%T (%+v)", evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestNamedFunctionInspect(t *testing.T) {
+	evaluated := testEval("fn add(x, y) { x + y }; add")
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if fn.Name != "add" {
+		t.Errorf("fn.Name is not %q. got=%q", "add", fn.Name)
+	}
+
+	expected := "fn add(x, y) {\n    (x + y)\n}"
+	if fn.Inspect() != expected {
+		t.Errorf("fn.Inspect() wrong. expected=%q, got=%q", expected, fn.Inspect())
+	}
+}
+
+func TestLambdas(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let double = |x| x * 2; double(4)", 8},
+		{"(|a, b| a + b)(2, 3)", 5},
+		{"let answer = || 42; answer()", 42},
+		{"let adder = |x| |y| x + y; adder(2)(3)", 5},
+		{"let n = 10; let add_n = |x| x + n; n = 20; add_n(1)", 21},
+		{"let apply = fn(f, x) { f(x) }; apply(|x| x - 1, 5)", 4},
+		{"let f = |a, b = 2, ...rest| a + b + len(rest); f(1, 2, 3, 4)", 5},
+		{"let f = |x| if (x > 0) { x } else { -x }; f(-3)", 3},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestFunctionCall(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -318,6 +1013,75 @@ func TestFunctionCall(t *testing.T) {
 	}
 }
 
+func TestFunctionArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(a, b = 2) { a + b }; f(1)", 3},
+		{"let f = fn(a, b = 2) { a + b }; f(1, 5)", 6},
+		{"let f = fn(a, b = a * 10) { a + b }; f(1)", 11},
+		{"let f = fn(a = 1, b = 2) { a - b }; f()", -1},
+		{"let f = fn(a = 1, b = 2) { a - b }; f(b = 5)", -4},
+		{"let f = fn(a, b) { a - b }; f(b = 1, a = 5)", 4},
+		{"let f = fn(a, b) { a - b }; f(5, b = 1)", 4},
+		// name = value in a call is a keyword argument, not an assignment,
+		// unless it is parenthesized
+		{"let x = 1; let f = fn(x) { x }; [f(x = 5), x]", []int64{5, 1}},
+		{"let x = 1; let f = fn(a) { a }; [f((x = 5)), x]", []int64{5, 5}},
+		{"let f = fn(first, ...rest) { rest }; f(1, 2, 3)", []int64{2, 3}},
+		{"let f = fn(first, ...rest) { rest }; f(1)", []int64{}},
+		{"let f = fn(...all) { all }; f()", []int64{}},
+		{"let f = fn(a, b = 2, ...rest) { [a, b, len(rest)] }; f(1, 5, 6, 7)", []int64{1, 5, 2}},
+		{"let f = fn(a, b, c) { [a, b, c] }; f(...[1, 2, 3])", []int64{1, 2, 3}},
+		{"let f = fn(a, b, c) { [a, b, c] }; let xs = [2, 3]; f(1, ...xs)", []int64{1, 2, 3}},
+		{"let f = fn(...xs) { xs }; f(...[1], 2, ...[3, 4])", []int64{1, 2, 3, 4}},
+		{"len(...[[1, 2, 3]])", 3},
+		{"let f = fn(a, b) { a + b }; f(1)", errorMessage("missing argument for parameter b")},
+		{"let f = fn(a) { a }; f(1, 2)", errorMessage("too many arguments. got=2, want at most 1")},
+		{"let f = fn() { 1 }; f(1)", errorMessage("too many arguments. got=1, want at most 0")},
+		{"let f = fn(a) { a }; f(b = 1)", errorMessage("unexpected keyword argument b")},
+		{"let f = fn(a) { a }; f(1, a = 2)", errorMessage("multiple values for parameter a")},
+		{"let f = fn(a, ...rest) { a }; f(1, rest = 2)", errorMessage("unexpected keyword argument rest")},
+		{"let f = fn(a) { a }; f(...1)", errorMessage("cannot spread INTEGER as arguments")},
+		{"let f = fn(a = b) { a }; f()", errorMessage("identifier not found: b")},
+		{`len(x = "a")`, errorMessage("builtin functions do not accept keyword arguments, got x")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("array has wrong num of elements. expected=%d, got=%d", len(expected), len(array.Elements))
+				continue
+			}
+			for i, el := range expected {
+				testIntegerObject(t, array.Elements[i], el)
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Kind != object.ArgumentError && errObj.Kind != object.TypeError && errObj.Kind != object.NameError {
+				t.Errorf("unexpected error kind %s", errObj.Kind)
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func TestClosures(t *testing.T) {
 	input := `
 	let newAdder = fn(x) {
@@ -400,26 +1164,160 @@ func TestStringConcatenation(t *testing.T) {
 		t.Fatalf("object is not String after string concatendation. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	if str.Value != "Hello World!" {
-		t.Errorf("String has the wrong value. got=%q", str.Value)
+	if str.Value != "Hello World!" {
+		t.Errorf("String has the wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringCodePoints(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("🇫🇷")`, 2},
+		{`"👩‍💻".len()`, 3},
+		{`len("é")`, 2},
+		{`"🇫🇷"[0]`, "🇫"},
+		{`"🇫🇷"[-1]`, "🇷"},
+		{`"a👩‍💻b"[1:4]`, "👩‍💻"},
+		{`"héllo"[::-1]`, "olléh"},
+		{`len([c for c in "a🇫🇷b"])`, 4},
+		{`[c for c in "é🍇"][1]`, "🍇"},
+		{`len("🍇🍇".split(""))`, 2},
+		{`let s = "👩‍💻"; [len(s), len(s[:]), len([c for c in s])] == [3, 3, 3]`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		}
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"chris" == "chris"`, true},
+		{`"chris" != "chris"`, false},
+		{`"chris" != "bob"`, true},
+		{`"chris" == "bob"`, false},
+		{`"apple" < "banana"`, true},
+		{`"apple" > "apple pie"`, false},
+		{`"b" >= "abc"`, true},
+		{`"Z" < "a"`, true},
+		{`"" <= ""`, true},
+		{`"é" > "z"`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !testBooleanObject(t, evaluated, tt.expected) {
+			return
+		}
+	}
+}
+
+func TestArrayComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2] == [1, 2]", true},
+		{"[1, [2, 3]] == [1, [2, 3]]", true},
+		{"[1, 2] != [1, 2, 3]", true},
+		{`[1, "a"] == [1, "b"]`, false},
+		{"[[1]] == [[1]]", true},
+		{"[1] in [[0], [1]]", true},
+		{"[1, 2] < [1, 3]", true},
+		{"[1, 2] < [1, 2, 0]", true},
+		{"[2] > [1, 9, 9]", true},
+		{"[] <= []", true},
+		{`["b"] >= ["a", "z"]`, true},
+		{"[true, 1] < [true, 2]", true},
+		{"[[1, 2], 3] < [[1, 3], 0]", true},
+		{"[true] < [false]", errorMessage("cannot compare [true] < [false]")},
+		{`[1] < ["a"]`, errorMessage("cannot compare [1] < [a]")},
+		{"[1] + [2]", errorMessage("unknown operator: ARRAY + ARRAY")},
+		{"let a = [1]; let b = [1]; a[0] = a; b[0] = b; a == b", false},
+		{"let a = [1]; a[0] = a; a == a", true},
+		{"let a = [1]; let b = [1]; a[0] = a; b[0] = b; [a] != [b]", true},
+		{"let a = [1]; let b = [1]; a[0] = a; b[0] = b; a < b", errorMessage("cannot compare [[...]] < [[...]]")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		}
 	}
 }
 
-func TestStringComparison(t *testing.T) {
+func TestChainedComparisons(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected bool
+		expected interface{}
 	}{
-		{`"chris" == "chris"`, true},
-		{`"chris" != "chris"`, false},
-		{`"chris" != "bob"`, true},
-		{`"chris" == "bob"`, false},
+		{"1 < 2 < 3", true},
+		{"1 < 3 < 2", false},
+		{"3 > 2 > 1", true},
+		{"1 <= 1 < 2 <= 2", true},
+		{"1 < 2 > 0", true},
+		{`"a" < "b" < "c"`, true},
+		{"5 > 4 == 3 < 4", true},
+		{"1 < 2 < 3 == true", true},
+		// The middle operand is evaluated once
+		{"let calls = []; fn f(x) { calls.append(x); x }; 1 < f(2) < 3; len(calls)", 1},
+		// Later operands are not evaluated once a comparison fails
+		{"let calls = []; fn f(x) { calls.append(x); x }; 3 < 1 < f(5); len(calls)", 0},
+		{"2 < 1 < undefined_name", false},
+		{"1 < 2 < undefined_name", errorMessage("identifier not found: undefined_name")},
+		{`1 < 2 < "a"`, errorMessage("type mismatch: INTEGER < STRING")},
 	}
 
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
-		if !testBooleanObject(t, evaluated, tt.expected) {
-			return
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
 		}
 	}
 }
@@ -440,6 +1338,9 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`let arr = [1, 2, 3, 4]; let arr = push(arr, "hello"); len(arr[4])`, 5},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len(items({"a": 1, "b": 2}))`, 2},
+		{`items({"a": 1})[0][1]`, 1},
+		{`items([1])`, "argument to `items` must be HASH, got ARRAY"},
 	}
 
 	for _, tt := range tests {
@@ -462,6 +1363,122 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestComprehensions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[x * 2 for x in [1, 2, 3]]", "[2, 4, 6]"},
+		{"[x for x in [3, -1, 0, 4] if x > 0]", "[3, 4]"},
+		{"[x for x in []]", "[]"},
+		{`[c + c for c in "ab🍇"]`, `[aa, bb, 🍇🍇]`},
+		{"[a + b for a, b in [[1, 2], [3, 4]]]", "[3, 7]"},
+		{"[h for [h, ...t] in [[1, 2], [3]] if len(t) > 0]", "[1]"},
+		{"let fs = [|| x for x in [1, 2]]; [f() for f in fs]", "[1, 2]"},
+		{`let h = {"a": 1, "b": 2}; let d = {k: v * 10 for k, v in items(h)}; d["a"] + d["b"]`, 30},
+		{`let d = {x: x * x for x in [1, 2, 3] if x != 2}; len(items(d)) + d[3]`, 11},
+		{`let h = {"a": 1}; len([k for k in h])`, 1},
+		// The loop variable does not leak into the enclosing scope
+		{"let x = 10; [x for x in [1, 2]]; x", 10},
+		{"[x for x in [1]]; x", errorMessage("identifier not found: x")},
+		{"[x for x in 5]", errorMessage("INTEGER is not iterable")},
+		{"[x for x in [1] if y]", errorMessage("identifier not found: y")},
+		{"[a for a, b in [[1]]]", errorMessage("pattern [a, b] expects 2 elements, got 1")},
+		{"{[x]: 1 for x in [1]}", errorMessage("unusable as hash key: ARRAY")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestRanges(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"0..5", "0..5"},
+		{"let n = 3; 1..=n * 2 by 2", "1..=6 by 2"},
+		{"type(0..5)", "RANGE"},
+		{"[x for x in 0..5]", "[0, 1, 2, 3, 4]"},
+		{"[x for x in 0..=5]", "[0, 1, 2, 3, 4, 5]"},
+		{"[x for x in 0..10 by 3]", "[0, 3, 6, 9]"},
+		{"[x for x in 5..0 by -2]", "[5, 3, 1]"},
+		{"[x for x in 5..0]", "[]"},
+		{"len(0..10)", 10},
+		{"len(0..=10 by 5)", 3},
+		{"(0..10 by 2).len()", 5},
+		{"(0..10 by 2)[3]", 6},
+		{"(0..10 by 2)[-1]", 8},
+		{"let r = 10..=0 by -5; r[2]", 0},
+		{"3 in 0..5", true},
+		{"5 in 0..5", false},
+		{"5 in 0..=5", true},
+		{"4 in 0..10 by 2", true},
+		{"5 in 0..10 by 2", false},
+		{"-1 in 0..5", false},
+		{`"a" in 0..5`, false},
+		// Membership is computed, so huge ranges cost nothing
+		{"999999999999 in 0..1000000000000", true},
+		{"len(0..1000000000000 by 7)", 142857142858},
+		{"0..3 == 0..=2", true},
+		{"0..3 != 0..3", false},
+		{"(0..5)?.[9]", nil},
+		{"(0..5)[5]", errorMessage("range index out of bounds: given index 5, range length is: 5")},
+		{"0..true", errorMessage("range bounds must be INTEGER, got BOOLEAN")},
+		{"0..5 by 0", errorMessage("range step cannot be zero")},
+		{"len(0..9223372036854775807)", 9223372036854775807},
+		{"(-9223372036854775807..=9223372036854775807 by 4)[-1]", 9223372036854775805},
+		{"9223372036854775806 in -9223372036854775806..9223372036854775807 by 2", true},
+		{"0..=9223372036854775807", errorMessage("range has too many elements: 0..=9223372036854775807")},
+		{"-9223372036854775807..9223372036854775807", errorMessage("range has too many elements: -9223372036854775807..9223372036854775807")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -541,6 +1558,14 @@ func TestArrayIndexExpressions(t *testing.T) {
 			"[1, 2, 3][-4]",
 			"array index out of bounds: given index -4, array length is: 3",
 		},
+		{
+			`"abc"[3]`,
+			"string index out of bounds: given index 3, string length is: 3",
+		},
+		{
+			`"abc"[-4]`,
+			"string index out of bounds: given index -4, string length is: 3",
+		},
 	}
 
 	for _, tt := range tests {
@@ -562,6 +1587,108 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"hello"[0]`, "h"},
+		{`"hello"[4]`, "o"},
+		{`"hello"[-1]`, "o"},
+		{`"hello"[-5]`, "h"},
+		{`"🍇🍇hi"[1]`, "🍇"},
+		{`"🍇🍇hi"[2]`, "h"},
+		{`let s = "seville"; s[len(s) - 1]`, "e"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. expected=%q, got=%q", tt.expected, str.Value)
+		}
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3, 4][1:3]", []int64{2, 3}},
+		{"[1, 2, 3, 4][:-1]", []int64{1, 2, 3}},
+		{"[1, 2, 3, 4][2:]", []int64{3, 4}},
+		{"[1, 2, 3, 4][:]", []int64{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][::2]", []int64{1, 3}},
+		{"[1, 2, 3, 4][::-1]", []int64{4, 3, 2, 1}},
+		{"[1, 2, 3, 4][-2::-1]", []int64{3, 2, 1}},
+		{"[1, 2, 3, 4][3:1:-1]", []int64{4, 3}},
+		{"[1, 2, 3, 4][1:100]", []int64{2, 3, 4}},
+		{"[1, 2, 3, 4][-100:2]", []int64{1, 2}},
+		{"[1, 2, 3, 4][3:1]", []int64{}},
+		{"let arr = [1, 2, 3]; let i = 1; arr[i:i + 1]", []int64{2}},
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[:-1]`, "hell"},
+		{`"hello"[::2]`, "hlo"},
+		{`"hello"[::-1]`, "olleh"},
+		{`"🍇🍇hi"[1:3]`, "🍇h"},
+		{`[1, 2, 3][::0]`, errorMessage("slice step cannot be zero")},
+		{`[1, 2, 3]["a":]`, errorMessage("slice indices must be integers, got STRING")},
+		{`{"a": 1}[1:2]`, errorMessage("slice operator not supported: HASH")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case []int64:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("array has wrong num of elements. expected=%d, got=%d", len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, el := range expected {
+				testIntegerObject(t, array.Elements[i], el)
+			}
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+// errorMessage distinguishes expected error messages from expected string
+// values in table driven tests
+type errorMessage string
+
 func TestHashLiterals(t *testing.T) {
 	input := `let two = "two";
 	{
@@ -659,16 +1786,34 @@ func TestAssignmentExpression(t *testing.T) {
 		input    string
 		expected interface{}
 	}{
-		{"x = 2", 2},
-		{"x = 2 * 2", 4},
+		{"x = 2", "cannot assign to undeclared identifier: x"},
+		{"x = 2 * 2", "cannot assign to undeclared identifier: x"},
+		{"let x = 1; let foo = fn() {y = 2}; foo()", "cannot assign to undeclared identifier: y"},
 		{"let x = 2; x = 3", 3},
 		{"let x = 2; x = 3; x", 3},
 		{"let x = 100; let foo = fn(x) {x = 2}; foo(5)", 2},
 		{"let x = 100; let foo = fn(x) {x = 2}; foo(5); x", 100},
+		{"let x = 100; let foo = fn() {x = 2}; foo(); x", 2},
+		{"let x = 100; let foo = fn() {let x = 1; x = 2}; foo(); x", 100},
+		{"let x = 1; let foo = fn() {fn() {x = x + 1}}; let inc = foo(); inc(); inc(); x", 3},
+		{
+			`let counter = fn() {
+				let count = 0;
+				fn() { count = count + 1; count }
+			}
+			let next = counter();
+			next();
+			next();
+			next()`,
+			3,
+		},
 		{"let arr = [1, 2, 3]; arr[0] = 5", 5},
 		{"let arr = [1, 2, 3]; arr[0] = 5; arr[0]", 5},
 		{"let arr = []; arr[0] = 1", "Array index out of bounds: given index 0, array length is 0"},
 		{"let arr = []; arr[2 * 2] = 1", "Array index out of bounds: given index 4, array length is 0"},
+		{"let arr = [1, 2, 3]; arr[-1] = 5; arr[2]", 5},
+		{"let arr = [1, 2, 3]; arr[-3] = 5; arr[0]", 5},
+		{"let arr = [1, 2, 3]; arr[-4] = 5", "Array index out of bounds: given index -4, array length is 3"},
 		{`let name_to_age = {}; name_to_age["Charlie"] = 99`, 99},
 		{`let name_to_age = {}; name_to_age["Charlie"] = 99; name_to_age["Charlie"]`, 99},
 		{`let foo = {"one": 1}; foo["two"] = 7 * 7 -47`, 2},
@@ -697,3 +1842,253 @@ func TestAssignmentExpression(t *testing.T) {
 		}
 	}
 }
+
+func TestCompoundAssignmentExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 2; x += 3", 5},
+		{"let x = 2; x += 3; x", 5},
+		{"let x = 2; x -= 3; x", -1},
+		{"let x = 2; x *= 3; x", 6},
+		{"let x = 7; x /= 2; x", 3},
+		{"let x = 7; x %= 4; x", 3},
+		{"let x = 2; x **= 3; x", 8},
+		{"let x = 2; x += 1 + 2 * 3; x", 9},
+		{`let s = "foo"; s += "bar"; s`, "foobar"},
+		{"let arr = [1, 2, 3]; arr[1] += 10; arr[1]", 12},
+		{"let arr = [1, 2, 3]; arr[-1] *= 3; arr[2]", 9},
+		{`let counts = {"a": 1}; counts["a"] += 1; counts["a"]`, 2},
+		{
+			`let calls = {"n": 0};
+			let idx = fn() { calls["n"] += 1; 0 };
+			let arr = [10];
+			arr[idx()] += 5;
+			[arr[0], calls["n"]]`,
+			[]int64{15, 1},
+		},
+		{"y += 1", errorMessage("identifier not found: y")},
+		{`let counts = {}; counts["a"] += 1`, errorMessage("key a not found in hash map")},
+		{`let x = 1; x += "a"`, errorMessage("type mismatch: INTEGER + STRING")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		case []int64:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			for i, el := range expected {
+				testIntegerObject(t, array.Elements[i], el)
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestErrorStackTraces(t *testing.T) {
+	input := `let inner = fn(x) {
+	x + true
+}
+let outer = fn(y) {
+	inner(y * 2)
+}
+outer(1)`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expectedStack := []object.StackFrame{
+		{Function: "inner", Line: 5, Column: 2},
+		{Function: "outer", Line: 7, Column: 1},
+	}
+
+	if len(errObj.Stack) != len(expectedStack) {
+		t.Fatalf("wrong stack length. expected=%d, got=%d (%+v)", len(expectedStack), len(errObj.Stack), errObj.Stack)
+	}
+
+	for i, frame := range expectedStack {
+		if errObj.Stack[i] != frame {
+			t.Errorf("wrong stack frame %d. expected=%+v, got=%+v", i, frame, errObj.Stack[i])
+		}
+	}
+
+	expectedTraceback := "Traceback (most recent call last):\n" +
+		"    at outer (line 7, column 1)\n" +
+		"    at inner (line 5, column 2)\n"
+
+	if errObj.Traceback() != expectedTraceback {
+		t.Errorf("wrong traceback. expected=%q, got=%q", expectedTraceback, errObj.Traceback())
+	}
+}
+
+func TestErrorStackTraceFrames(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStack []string
+	}{
+		{"1 + true", []string{}},
+		{"len(1)", []string{"len"}},
+		{"let f = fn() { len(1) }; f()", []string{"len", "f"}},
+		{"fn() { 1 + true }()", []string{"<anonymous>"}},
+		{"let f = fn() { fn() { -true } }; f()()", []string{"<anonymous>"}},
+		{"fn inner() { -true }; let g = inner; g()", []string{"inner"}},
+		{"let f = fn() { fn inner() { -true } inner }; f()()", []string{"inner"}},
+		{
+			"let f = fn(n) { if (n == 0) { return 1 + true } f(n - 1) }; f(2)",
+			[]string{"f", "f", "f"},
+		},
+		// Rethrowing a caught exception does not add to the stack it holds
+		{
+			"let saved = null; let f = fn(e) { throw e }; try { len(1) } catch (e) { saved = e }; try { f(saved) } catch (e) { 0 }; f(saved)",
+			[]string{"len", "f"},
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		names := []string{}
+		for _, frame := range errObj.Stack {
+			names = append(names, frame.Function)
+		}
+
+		if strings.Join(names, ",") != strings.Join(tt.expectedStack, ",") {
+			t.Errorf("wrong stack for %q. expected=%v, got=%v", tt.input, tt.expectedStack, names)
+		}
+	}
+}
+
+func TestTryCatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { 1 + true; 1 } catch (e) { 2 }", 2},
+		{"try { throw 5 } catch (e) { e[\"value\"] }", 5},
+		{"try { raise 5 } catch (e) { e[\"value\"] }", 5},
+		{`try { throw "oops" } catch (e) { e["message"] }`, "oops"},
+		{`try { throw {"code": 3} } catch (e) { e["value"]["code"] }`, 3},
+		{`try { throw [1, 2] } catch (e) { e["message"] }`, "[1, 2]"},
+		{`try { {"a": 1}["b"] } catch (e) { e["message"] }`, "key b not found in hash map"},
+		{`try { {"a": 1}["b"] } catch (e) { e["value"] }`, nil},
+		{`try { {"a": 1}["b"] } catch (e) { e["type"] }`, "KeyError"},
+		{`try { throw "a" } catch (e) { e["type"] }`, "Error"},
+		{`try { [1][5] } catch { -1 }`, -1},
+		{"try { 1 + true } catch (e) { 2 } finally { 3 }", 2},
+		{"try { 1 } finally { 3 }", 1},
+		{"let x = 0; try { 1 } finally { x = 3 }; x", 3},
+		{"let x = 0; try { throw 1 } catch (e) { x += 1 } finally { x += 10 }; x", 11},
+		{"try { try { throw 1 } finally { 2 } } catch (e) { e[\"value\"] + 10 }", 11},
+		{"try { try { throw 1 } catch (e) { throw e } } catch (e) { e[\"value\"] }", 1},
+		{"try { try { throw 1 } catch (e) { throw 2 } } catch (e) { e[\"value\"] }", 2},
+		{"try { 1 } catch (e) { 2 } finally { throw 3 }", errorMessage("3")},
+		{"try { 1 / 0 } catch (e) { e[\"type\"] }", "ZeroDivisionError"},
+		{"let f = fn() { try { return 1 } finally { 2 } }; f()", 1},
+		{"let f = fn() { try { return 1 } finally { return 2 } }; f()", 2},
+		{"let f = fn() { try { throw 1 } catch (e) { return 5 }; 6 }; f()", 5},
+		{"let f = fn(x) { if (x > 2) { throw x } x }; try { f(1) + f(5) } catch (e) { e[\"value\"] }", 5},
+		{"try { let y = 1; throw y } catch (e) { y }", errorMessage("identifier not found: y")},
+		{"try { 1 } catch (e) { 2 }; e", errorMessage("identifier not found: e")},
+		{"throw 5", errorMessage("5")},
+		{`throw "not caught"; 1`, errorMessage("not caught")},
+		{`try { throw 1 } catch (e) { e["nope"] }`, errorMessage("exception has no field nope")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"1 + true", 1, 3},
+		{"let x = 1;\n  x + [1][5]", 2, 10},
+		{"let f = fn() {\n    throw 1\n}\nf()", 2, 5},
+		{"foo", 1, 1},
+		{"len(1)", 1, 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Line != tt.expectedLine || errObj.Column != tt.expectedColumn {
+			t.Errorf("wrong error position for %q. expected=%d:%d, got=%d:%d",
+				tt.input, tt.expectedLine, tt.expectedColumn, errObj.Line, errObj.Column)
+		}
+	}
+
+	input := "try {\n  1 + true\n} catch (e) { [e[\"line\"], e[\"column\"]] }"
+	evaluated := testEval(input)
+	array, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+	testIntegerObject(t, array.Elements[0], 2)
+	testIntegerObject(t, array.Elements[1], 5)
+}
@@ -0,0 +1,155 @@
+package evaluator
+
+import (
+	"runtime"
+	"seville/ast"
+	"seville/object"
+)
+
+// iterate calls fn with each element of iterable in turn, stopping at the
+// first non-nil result of fn and returning it. An iterator that is abandoned
+// before it is exhausted, because fn stopped early or a generator around this
+// loop was closed, is closed in turn.
+func iterate(iterable object.Object, fn func(el object.Object) object.Object) object.Object {
+	iter, err := object.GetIterator(iterable)
+	if err != nil {
+		return err
+	}
+
+	exhausted := false
+	defer func() {
+		if !exhausted {
+			iter.Close()
+		}
+	}()
+
+	for {
+		el, ok := iter.Next()
+		if !ok {
+			exhausted = true
+			return nil
+		}
+		if isError(el) {
+			exhausted = true
+			return el
+		}
+
+		if result := fn(el); result != nil {
+			return result
+		}
+	}
+}
+
+// generatorClosed is panicked with by the yield of a closed generator, to
+// unwind its body without running any more of it.
+type generatorClosed struct{}
+
+// newGenerator returns the iterator for a call to the generator function fn,
+// whose arguments are already bound in env. The body starts running when the
+// first element is requested, on a goroutine of its own that hands control
+// back and forth with the consumer at each yield, so only one of the two
+// ever runs at a time. Closing the iterator makes the suspended yield unwind
+// the body, so the goroutine exits; the rest of the body never runs. An
+// iterator that becomes unreachable while its body is suspended is closed
+// by the garbage collector, unless the body can still reach it, as it can
+// through a global.
+func newGenerator(fn *object.Function, env *object.Environment) *object.FuncIterator {
+	resume := make(chan struct{})
+	yields := make(chan object.Object)
+	done := make(chan struct{})
+	started, running := false, false
+
+	env.SetYield(func(val object.Object) object.Object {
+		select {
+		case <-done:
+			panic(generatorClosed{})
+		case yields <- val:
+		}
+
+		select {
+		case <-done:
+			panic(generatorClosed{})
+		case <-resume:
+		}
+		return NULL
+	})
+
+	run := func() {
+		defer close(yields)
+		defer func() {
+			if r := recover(); r != nil {
+				if _, ok := r.(generatorClosed); !ok {
+					panic(r)
+				}
+			}
+		}()
+
+		<-resume
+		result := unWrapReturnValue(Eval(fn.Body, env))
+		if isError(result) {
+			yields <- result
+		}
+	}
+
+	name := "generator"
+	if fn.Name != "" {
+		name += " " + fn.Name
+	}
+
+	iter := &object.FuncIterator{Name: name}
+	iter.NextFn = func() (object.Object, bool) {
+		if running {
+			return newError(object.GenericError, "%s is already running", name), true
+		}
+		if !started {
+			started = true
+			go run()
+		}
+
+		running = true
+		defer func() { running = false }()
+
+		resume <- struct{}{}
+		val, ok := <-yields
+		return val, ok
+	}
+	iter.CloseFn = func() {
+		if !started {
+			return
+		}
+		close(done)
+
+		// A generator closed from inside its own body unwinds when it next
+		// yields. Otherwise it is suspended, so wait for it to unwind.
+		if !running {
+			for range yields {
+			}
+		}
+	}
+	// The goroutine does not refer to the iterator, only to the channels
+	runtime.SetFinalizer(iter, func(iter *object.FuncIterator) { iter.Close() })
+
+	return iter
+}
+
+func evalYieldExpression(node *ast.YieldExpression, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	yield := env.Yield()
+	if yield == nil {
+		return newError(object.GenericError, "yield outside of a generator")
+	}
+
+	return yield(val)
+}
+
+func checkArgumentCount(args []object.Object, want int) *object.Error {
+	if len(args) != want {
+		return newError(object.ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), want)
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package evaluator
+
+import (
+	"runtime"
+	"seville/object"
+	"testing"
+	"time"
+)
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fn gen() { yield 1; yield 2 }; [x for x in gen()]", "[1, 2]"},
+		{"fn gen(a, b) { yield a; yield b }; [x for x in gen(3, 4)]", "[3, 4]"},
+		{"let gen = |x| yield x * 2; [x for x in gen(5)]", "[10]"},
+		{"fn gen() { yield 1; return 5; yield 2 }; [x for x in gen()]", "[1]"},
+		{"fn gen() { if (true) { yield 1 } else { yield 2 } }; [x for x in gen()]", "[1]"},
+		{"fn gen() { yield 1 }; gen()", "<generator gen>"},
+		{"fn gen() { yield 1 }; type(gen())", "ITERATOR"},
+		{"fn gen() { yield 1 }; let it = gen(); [next(it), next(it), next(it)]", "[1, null, null]"},
+		// Generators are independent and resume where they left off
+		{"fn gen() { yield 1; yield 2 }; let a = gen(); let b = gen(); next(a); [next(a), next(b)]", "[2, 1]"},
+		{"fn gen() { yield 1; yield 2; yield 3 }; let it = gen(); next(it); [x for x in it]", "[2, 3]"},
+		// The body does not run until the first value is requested
+		{`let log = []; fn gen() { log.append("ran"); yield 1 }; let it = gen(); len(log)`, "0"},
+		{`let log = []; fn gen() { log.append("ran"); yield 1 }; let it = gen(); next(it); len(log)`, "1"},
+		// Infinite generators are fine as long as only a prefix is consumed
+		{"fn squares() { [yield x * x for x in 0..1000000000000] }; [x for x in take(squares(), 4)]", "[0, 1, 4, 9]"},
+		{"fn naturals(n) { yield n; [yield x for x in naturals(n + 1)] }; [x for x in take(skip(naturals(0), 3), 3)]", "[3, 4, 5]"},
+		{"fn gen() { yield 1; 1 + true }; [x for x in gen()]", errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{"fn gen() { yield 1 }; let it = gen(); next(it); next(it); next(it)", nil},
+		{"let it = null; fn gen() { yield next(it) }; it = gen(); next(it)", errorMessage("generator gen is already running")},
+	}
+
+	runIteratorTests(t, tests)
+}
+
+func TestAbandonedGeneratorsExit(t *testing.T) {
+	tests := []string{
+		"fn nat() { [yield x for x in 0..1000000000000] }; [x for x in take(nat(), 3)]",
+		"fn nat(n) { yield n; [yield x for x in nat(n + 1)] }; [x for x in take(nat(0), 5)]",
+		"fn nat() { [yield x for x in 0..1000000000000] }; [x for x in take(map(skip(nat(), 2), |x| x), 3)]",
+		"fn nat() { [yield x for x in 0..1000000000000] }; [1 / (x - 2) for x in nat()]",
+		"fn nat() { [yield x for x in 0..1000000000000] }; let it = nat(); next(it); [x for x in take(it, 0)]",
+		// Generators that are dropped while suspended are closed once they
+		// are collected
+		"fn nat() { [yield x for x in 0..1000000000000] }; next(nat())",
+		"fn nat() { [yield x for x in 0..1000000000000] }; fn first() { let it = nat(); next(it) }; first()",
+		// A global stays reachable from the body, so it is closed by hand
+		"fn nat() { [yield x for x in 0..1000000000000] }; let it = nat(); next(it); close(it)",
+	}
+
+	for _, input := range tests {
+		before := runtime.NumGoroutine()
+		testEval(input)
+
+		deadline := time.Now().Add(time.Second)
+		for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+			runtime.GC()
+			time.Sleep(time.Millisecond)
+		}
+		if after := runtime.NumGoroutine(); after > before {
+			t.Errorf("%d goroutines left running by %q", after-before, input)
+		}
+	}
+}
+
+func TestIteratorBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"iter([1, 2])", "<array iterator>"},
+		{`let it = iter("🍇a"); [next(it), next(it), next(it)]`, "[🍇, a, null]"},
+		{"let it = iter(0..=4 by 2); [x for x in it]", "[0, 2, 4]"},
+		{`let it = iter({"a": 1}); [next(it), next(it)]`, "[a, null]"},
+		{"let it = iter([1, 2, 3]); next(it); [x for x in it]", "[2, 3]"},
+		{"let it = iter([1]); iter(it) == it", "true"},
+		{"[x for x in take([1, 2, 3], 2)]", "[1, 2]"},
+		{"[x for x in take([1, 2, 3], 5)]", "[1, 2, 3]"},
+		{"[x for x in take([1, 2, 3], 0)]", "[]"},
+		// take closes what it takes from once it has enough
+		{"let it = iter([1, 2, 3]); [x for x in take(it, 2)]; next(it)", "null"},
+		{"let it = iter([1, 2]); close(it); next(it)", "null"},
+		{"fn gen() { yield 1; yield 2 }; let it = gen(); next(it); close(it); next(it)", "null"},
+		{"close([1])", errorMessage("argument to `close` must be ITERATOR, got ARRAY")},
+		{"[x for x in skip(0..5, 2)]", "[2, 3, 4]"},
+		{"[x for x in skip(0..5, 9)]", "[]"},
+		{"[x for x in map([1, 2, 3], |x| x * 10)]", "[10, 20, 30]"},
+		{`[x for x in map("ab", fn(c) { c + c })]`, "[aa, bb]"},
+		{"[x for x in take(map(skip(0..1000000000000, 5), |x| x * x), 2)]", "[25, 36]"},
+		// Only the elements that are consumed are ever produced
+		{"let seen = []; let it = map(0..100, fn(x) { seen.append(x); x }); [x for x in take(it, 3)]; len(seen)", "3"},
+		{"let seen = []; let it = map(0..100, fn(x) { seen.append(x); x }); take(it, 3); len(seen)", "0"},
+		{"[x for x in map([1, 0], |x| 1 / x)]", errorMessage("division by zero: 1 / 0")},
+		{"take(1, 2)", errorMessage("INTEGER is not iterable")},
+		{"take([1], true)", errorMessage("second argument to `take` must be INTEGER, got BOOLEAN")},
+		{"skip([1], -1)", errorMessage("second argument to `skip` must not be negative, got -1")},
+		{"next([1])", errorMessage("argument to `next` must be ITERATOR, got ARRAY")},
+		{"map([1])", errorMessage("wrong number of arguments. got=1, want=2")},
+	}
+
+	runIteratorTests(t, tests)
+}
+
+func runIteratorTests(t *testing.T, tests []struct {
+	input    string
+	expected interface{}
+}) {
+	t.Helper()
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			if evaluated == nil || evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. expected=%q, got=%v", tt.input, expected, evaluated)
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message for %q. expected=%q. got=%q", tt.input, expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package evaluator
+
+import (
+	"seville/ast"
+	"seville/object"
+)
+
+// evalMatchExpression evaluates the body of the first arm whose pattern
+// matches the subject and whose guard, if any, is truthy. The names bound by
+// the pattern are only visible to the guard and body of that arm.
+func evalMatchExpression(node *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(node.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range node.Arms {
+		armEnv := object.NewEnclosedEnvironment(env)
+
+		if err := matchPattern(arm.Pattern, subject, env, armEnv.Set); err != nil {
+			continue
+		}
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+
+		result := Eval(arm.Body, armEnv)
+		if result == nil {
+			return NULL
+		}
+		return result
+	}
+
+	return newError(object.MatchError, "non-exhaustive match: no pattern matched %s", subject.Inspect())
+}
+
+// evalDestructuringLet binds the names in a let pattern to the parts of val
+// they match, or binds none of them if val does not match.
+func evalDestructuringLet(node *ast.LetStatement, val object.Object, env *object.Environment) object.Object {
+	bindings := map[string]object.Object{}
+	bind := func(name string, val object.Object) object.Object {
+		bindings[name] = val
+		return val
+	}
+
+	if err := matchPattern(node.Pattern, val, env, bind); err != nil {
+		return err
+	}
+
+	for name, val := range bindings {
+		if node.IsConst() {
+			env.SetConst(name, val)
+		} else {
+			env.Set(name, val)
+		}
+	}
+
+	return nil
+}
+
+// matchPattern matches val against pattern with object.MatchPattern,
+// evaluating the literals and keys in pattern in env.
+func matchPattern(
+	pattern ast.Pattern,
+	val object.Object,
+	env *object.Environment,
+	bind func(name string, val object.Object) object.Object,
+) *object.Error {
+	literal := func(node ast.Expression) object.Object {
+		return Eval(node, env)
+	}
+
+	return object.MatchPattern(pattern, val, literal, bind)
+}
@@ -0,0 +1,109 @@
+package evaluator
+
+import (
+	"seville/object"
+	"testing"
+)
+
+func TestBuiltinMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"héllo".len()`, 5},
+		{`"Hello".upper()`, "HELLO"},
+		{`"Hello".lower()`, "hello"},
+		{`"  padded  ".trim()`, "padded"},
+		{`"a,b,c".split(",")`, []string{"a", "b", "c"}},
+		{`"a,b,c".split(",")[1]`, "b"},
+		{`"seville".contains("vil")`, true},
+		{`"seville".starts_with("sev")`, true},
+		{`"seville".ends_with("sev")`, false},
+		{`"a-b-c".replace("-", "+")`, "a+b+c"},
+		{`let s = "x"; let up = s.upper; up()`, "X"},
+		{`[1, 2, 3].len()`, 3},
+		{`let arr = [1, 2, 3]; arr.push(4)`, []string{"1", "2", "3", "4"}},
+		{`let arr = [1, 2, 3]; arr.push(4); arr`, []string{"1", "2", "3"}},
+		{`let arr = [1, 2, 3]; arr.append(4); arr`, []string{"1", "2", "3", "4"}},
+		{`let arr = [1, 2, 3]; arr.append(4)`, nil},
+		{`let arr = [1, 2, 3]; let last = arr.pop(); [last, len(arr)]`, []string{"3", "2"}},
+		{`[1, 2, 3].contains(2)`, true},
+		{`[1, 2, 3].contains(5)`, false},
+		{`[1, "a", true].join("-")`, "1-a-true"},
+		{`{"a": 1}.keys()`, []string{"a"}},
+		{`{"a": 1}.values()`, []string{"1"}},
+		{`{"a": 1, "b": 2}.len()`, 2},
+		{`{"a": 1}.get("a", 0)`, 1},
+		{`{"a": 1}.get("b", 0)`, 0},
+		{`let h = {"a": 1, "b": 2}; h.delete("a"); h.len()`, 1},
+		{`let h = {"keys": 1}; h.keys`, 1},
+		{`"abc".reverse()`, errorMessage("STRING has no method reverse")},
+		{`[].length()`, errorMessage("ARRAY has no method length")},
+		{`{}.missing()`, errorMessage("key missing not found in hash map")},
+		{`[].pop()`, errorMessage("pop from empty array")},
+		{`"a".split()`, errorMessage("wrong number of arguments. got=0, want=1")},
+		{`"a".split(1)`, errorMessage("argument to `split` must be STRING, got INTEGER")},
+		{`[].push(1, 2)`, errorMessage("wrong number of arguments. got=2, want=1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		case []string:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("array has wrong num of elements. expected=%d, got=%d", len(expected), len(array.Elements))
+				continue
+			}
+			for i, el := range expected {
+				if array.Elements[i].Inspect() != el {
+					t.Errorf("element %d wrong. expected=%q, got=%q", i, el, array.Elements[i].Inspect())
+				}
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestMethodErrorStackFrame(t *testing.T) {
+	evaluated := testEval(`let arr = []; arr.pop()`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Kind != object.IndexError {
+		t.Errorf("wrong error kind. expected=%s, got=%s", object.IndexError, errObj.Kind)
+	}
+
+	if len(errObj.Stack) != 1 || errObj.Stack[0].Function != "pop" {
+		t.Errorf("wrong stack. got=%v", errObj.Stack)
+	}
+}
@@ -0,0 +1,91 @@
+package evaluator
+
+import (
+	"os"
+	"seville/ast"
+	"seville/lexer"
+	"seville/object"
+	"seville/parser"
+	"strings"
+)
+
+// evalImportStatement binds the module at the imported path to its alias,
+// evaluating the module first if no other file has imported it yet.
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	importer := env.EnsureModule(object.SearchPath())
+
+	path, err := object.ResolveModulePath(node.Path.Value, importer)
+	if err != nil {
+		return err
+	}
+
+	module, err := loadModule(path, importer.Registry)
+	if err != nil {
+		frame := object.StackFrame{
+			Function: "<module " + object.ModuleName(path) + ">",
+			Line:     node.Token.Line,
+			Column:   node.Token.Column,
+		}
+		return withStackFrame(err, frame)
+	}
+
+	if env.DeclaresConst(node.Alias.Value) {
+		return newError(object.NameError, "cannot redeclare constant: %s", node.Alias.Value)
+	}
+
+	env.Set(node.Alias.Value, module)
+
+	return nil
+}
+
+// loadModule returns the module at path, which must be absolute, evaluating
+// it on its first import only.
+func loadModule(path string, registry *object.ModuleRegistry) (*object.Module, *object.Error) {
+	if module, ok := registry.Loaded[path]; ok {
+		return module, nil
+	}
+
+	if err := registry.CircularImport(path); err != nil {
+		return nil, err
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, newError(object.ImportError, "cannot read module %s: %s", path, err)
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, newError(object.ImportError, "cannot parse module %s: %s", path, strings.Join(p.Errors(), "; "))
+	}
+
+	module := object.NewModule(object.ModuleName(path), path, registry)
+
+	registry.Loading = append(registry.Loading, path)
+	result := Eval(program, module.Env)
+	registry.Loading = registry.Loading[:len(registry.Loading)-1]
+
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, errObj
+	}
+
+	registry.Loaded[path] = module
+
+	return module, nil
+}
+
+func evalExportStatement(node *ast.ExportStatement, env *object.Environment) object.Object {
+	result := Eval(node.Statement, env)
+	if isError(result) {
+		return result
+	}
+
+	if module := env.Module(); module != nil {
+		for _, name := range node.Names() {
+			module.Exports[name] = true
+		}
+	}
+
+	return nil
+}
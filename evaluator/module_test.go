@@ -0,0 +1,192 @@
+package evaluator
+
+import (
+	"os"
+	"path/filepath"
+	"seville/lexer"
+	"seville/object"
+	"seville/parser"
+	"testing"
+)
+
+// writeModules creates each file under a temporary directory and returns the
+// directory.
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+// testEvalModule evaluates input as if it were the file main.sv in dir.
+func testEvalModule(input, dir string, registry *object.ModuleRegistry) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	module := object.NewModule("main", filepath.Join(dir, "main.sv"), registry)
+
+	return Eval(program, module.Env)
+}
+
+func TestImportStatements(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib.sv": `
+			export let x = 1
+			export const y = 2
+			export fn double(n) { triple(n) - n }
+			fn triple(n) { n * 3 }
+			let hidden = 3
+			`,
+		"sub/a.sv":       `import "b.sv" as b; export let value = b.value + 1`,
+		"sub/b.sv":       `export let value = 10`,
+		"state.sv":       `export let counts = {"n": 0}`,
+		"cycle/a.sv":     `import "b.sv" as b; export let a = 1`,
+		"cycle/b.sv":     `import "a.sv" as a; export let b = 1`,
+		"bad.sv":         `export fn f() { 1 }; 1 + true`,
+		"closure.sv":     `let secret = 5; export fn reveal() { secret }`,
+		"paths/found.sv": `export let found = true`,
+	})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "lib.sv" as lib; lib.x + lib.y`, 3},
+		{`import "lib.sv" as lib; lib.double(5)`, 10},
+		{`import "./lib.sv" as lib; lib.x`, 1},
+		{`import "sub/a.sv" as a; a.value`, 11},
+		{`import "closure.sv" as c; c.reveal()`, 5},
+		{`import "state.sv" as a; import "state.sv" as b; a == b`, true},
+		{`fn f() { import "lib.sv" as lib; lib.x }; f()`, 1},
+		{`import "found.sv" as f; f.found`, true},
+		{`import "lib.sv" as lib; lib.hidden`, errorMessage("module lib has no export hidden")},
+		{`import "lib.sv" as lib; lib.triple`, errorMessage("module lib has no export triple")},
+		{`import "missing.sv" as m`, errorMessage("module not found: missing.sv")},
+		{`import "cycle/a.sv" as a`, errorMessage("circular import: a.sv -> b.sv -> a.sv")},
+		{`import "bad.sv" as bad`, errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{`const lib = 1; import "lib.sv" as lib`, errorMessage("cannot redeclare constant: lib")},
+		{`let a = 1; a.x`, errorMessage("cannot access member x of INTEGER")},
+		{`import "lib.sv" as lib; lib.x = 2`, errorMessage("cannot assign to member x of MODULE")},
+	}
+
+	for _, tt := range tests {
+		registry := object.NewModuleRegistry([]string{filepath.Join(dir, "paths")})
+		evaluated := testEvalModule(tt.input, dir, registry)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestImportedModulesAreCached(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"state.sv": `export let counts = {"loads": 0}`,
+		"a.sv":     `import "state.sv" as s; s.counts["loads"] = s.counts["loads"] + 1`,
+		"b.sv":     `import "state.sv" as s; import "a.sv" as a; s.counts["loads"] = s.counts["loads"] + 1`,
+	})
+
+	input := `
+	import "a.sv" as a
+	import "b.sv" as b
+	import "a.sv" as again
+	import "state.sv" as s
+	s.counts["loads"]
+	`
+
+	registry := object.NewModuleRegistry(nil)
+	testIntegerObject(t, testEvalModule(input, dir, registry), 2)
+
+	if len(registry.Loaded) != 3 {
+		t.Errorf("registry.Loaded has wrong number of modules. expected=3, got=%d", len(registry.Loaded))
+	}
+
+	if len(registry.Loading) != 0 {
+		t.Errorf("registry.Loading is not empty. got=%v", registry.Loading)
+	}
+}
+
+func TestImportErrorKindsAndStack(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"bad.sv": "let f = fn() { 1 + true }\nf()",
+	})
+
+	evaluated := testEvalModule(`import "bad.sv" as bad`, dir, object.NewModuleRegistry(nil))
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Kind != object.TypeError {
+		t.Errorf("wrong error kind. expected=%s, got=%s", object.TypeError, errObj.Kind)
+	}
+
+	if len(errObj.Stack) != 2 || errObj.Stack[0].Function != "f" || errObj.Stack[1].Function != "<module bad>" {
+		t.Errorf("wrong stack. got=%v", errObj.Stack)
+	}
+
+	evaluated = testEvalModule(`import "nope.sv" as nope`, dir, object.NewModuleRegistry(nil))
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Kind != object.ImportError {
+		t.Errorf("expected ImportError. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestImportsOutsideAModuleShareARegistry(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"state.sv":   `export let counts = {"loads": 0}; counts["loads"] = counts["loads"] + 1`,
+		"cycle/a.sv": `import "b.sv" as b; export let a = 1`,
+		"cycle/b.sv": `import "a.sv" as a; export let b = 1`,
+	})
+	t.Setenv("SEVILLE_PATH", dir)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`import "state.sv" as a; import "state.sv" as b; a == b`, true},
+		{`import "state.sv" as a; fn f() { import "state.sv" as b; b.counts["loads"] }; f() + a.counts["loads"]`, 2},
+		{`import "cycle/a.sv" as a`, errorMessage("circular import: a.sv -> b.sv -> a.sv")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("wrong error message. expected=%q. got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
@@ -2,7 +2,6 @@ package lexer
 
 import (
 	"fmt"
-	"regexp"
 	"seville/token"
 	"unicode"
 	"unicode/utf8"
@@ -13,11 +12,12 @@ type Lexer struct {
 	position     int  // current position in input
 	readPosition int  // current reading position in input (after current char)
 	ch           rune // current char under examination
-
+	line         int  // line of ch, starting from 1
+	column       int  // column of ch in runes, starting from 1
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
@@ -25,6 +25,12 @@ func New(input string) *Lexer {
 func (l *Lexer) readChar() {
 	var offset int
 
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 		offset = 1
@@ -38,15 +44,26 @@ func (l *Lexer) readChar() {
 }
 
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
-
 	l.skipWhitespace()
 
+	line, column := l.line, l.column
+	tok := l.readToken()
+	tok.Line, tok.Column = line, column
+
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
 			l.readChar()
 			tok = token.Token{Type: token.EQ, Literal: "=="}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: "=>"}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -61,6 +78,9 @@ func (l *Lexer) NextToken() token.Token {
 		if l.peekChar() == '=' {
 			l.readChar()
 			tok = token.Token{Type: token.LT_OR_EQ, Literal: "<="}
+		} else if l.peekChar() == '<' {
+			l.readChar()
+			tok = token.Token{Type: token.LSHIFT, Literal: "<<"}
 		} else {
 			tok = newToken(token.LT, l.ch)
 		}
@@ -68,20 +88,65 @@ func (l *Lexer) NextToken() token.Token {
 		if l.peekChar() == '=' {
 			l.readChar()
 			tok = token.Token{Type: token.GT_OR_EQ, Literal: ">="}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.RSHIFT, Literal: ">>"}
 		} else {
 			tok = newToken(token.GT, l.ch)
 		}
 	case '*':
 		if l.peekChar() == '*' {
 			l.readChar()
-			tok = token.Token{Type: token.EXP, Literal: "**"}
+			if l.peekChar() == '=' {
+				l.readChar()
+				tok = token.Token{Type: token.EXP_ASSIGN, Literal: "**="}
+			} else {
+				tok = token.Token{Type: token.EXP, Literal: "**"}
+			}
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.ASTERISK_ASSIGN, Literal: "*="}
 		} else {
 			tok = newToken(token.ASTERISK, l.ch)
 		}
+	case '?':
+		if l.peekChar() == '?' {
+			l.readChar()
+			tok = token.Token{Type: token.NULLISH, Literal: "??"}
+		} else if l.peekChar() == '.' {
+			l.readChar()
+			tok = token.Token{Type: token.OPTIONAL, Literal: "?."}
+		} else {
+			tok = newToken(token.QUESTION, l.ch)
+		}
+	case '.':
+		if l.peekChar() == '.' && l.peekSecondChar() == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else if l.peekChar() == '.' {
+			l.readChar()
+			if l.peekChar() == '=' {
+				l.readChar()
+				tok = token.Token{Type: token.RANGE_EQ, Literal: "..="}
+			} else {
+				tok = token.Token{Type: token.RANGE, Literal: ".."}
+			}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '|':
+		tok = newToken(token.PIPE, l.ch)
+	case '&':
+		tok = newToken(token.AMPERSAND, l.ch)
+	case '^':
+		tok = newToken(token.CARET, l.ch)
+	case '~':
+		tok = newToken(token.TILDE, l.ch)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -93,11 +158,33 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.PLUS_ASSIGN, Literal: "+="}
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.MINUS_ASSIGN, Literal: "-="}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.SLASH_ASSIGN, Literal: "/="}
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
+	case '%':
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.PERCENT_ASSIGN, Literal: "%="}
+		} else {
+			tok = newToken(token.PERCENT, l.ch)
+		}
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
@@ -114,7 +201,7 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default:
-		if isLetter(l.ch) {
+		if isIdentifierStart(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
 			return tok
@@ -139,20 +226,38 @@ func (l *Lexer) skipWhitespace() {
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isIdentifierContinue(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
+// readNumber reads a decimal integer, or a hexadecimal, octal or binary one
+// with a 0x, 0o or 0b prefix. Digits may be separated by underscores, as in
+// 1_000_000. Whether the digits are valid for the base is left to the parser.
 func (l *Lexer) readNumber() string {
 	position := l.position
-	for unicode.IsDigit(l.ch) {
+	isDigit := unicode.IsDigit
+
+	if l.ch == '0' {
+		switch l.peekChar() {
+		case 'x', 'X', 'o', 'O', 'b', 'B':
+			l.readChar()
+			l.readChar()
+			isDigit = isHexDigit
+		}
+	}
+
+	for isDigit(l.ch) || l.ch == '_' {
 		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
+func isHexDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
 func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
@@ -162,15 +267,91 @@ func (l *Lexer) peekChar() rune {
 	}
 }
 
-func isLetter(ch rune) bool {
-	return unicode.IsLetter(ch) || ch == '_' || isEmoji(ch)
+func (l *Lexer) peekSecondChar() rune {
+	if l.readPosition >= len(l.input) {
+		return 0
+	}
+
+	_, width := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	if l.readPosition+width >= len(l.input) {
+		return 0
+	}
+
+	r, _ := utf8.DecodeRuneInString(l.input[l.readPosition+width:])
+	return r
+}
+
+// Identifiers follow the Unicode XID_Start and XID_Continue properties, as
+// described in UAX #31, extended with '_' and emoji. Combining marks, digits
+// and the joiners and variation selectors of emoji sequences such as 👩‍💻 or
+// ❤️ may continue an identifier but not start one.
+func isIdentifierStart(ch rune) bool {
+	if ch == '_' || unicode.Is(emoji, ch) {
+		return true
+	}
+	return unicode.In(ch, idStart...) && !isPatternCharacter(ch) && !unicode.Is(notXIDStart, ch)
+}
+
+func isIdentifierContinue(ch rune) bool {
+	if ch == '_' || ch == zeroWidthJoiner || unicode.Is(emoji, ch) {
+		return true
+	}
+	return unicode.In(ch, idContinue...) && !isPatternCharacter(ch) && !unicode.Is(notXIDContinue, ch)
+}
+
+// isPatternCharacter reports whether ch is reserved for syntax, which UAX #31
+// keeps out of identifiers even when it is otherwise a letter or mark.
+func isPatternCharacter(ch rune) bool {
+	return unicode.In(ch, unicode.Pattern_Syntax, unicode.Pattern_White_Space)
+}
+
+const zeroWidthJoiner = '\u200D'
+
+var (
+	idStart    = []*unicode.RangeTable{unicode.L, unicode.Nl, unicode.Other_ID_Start}
+	idContinue = []*unicode.RangeTable{
+		unicode.L, unicode.Nl, unicode.Other_ID_Start,
+		unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue,
+	}
+)
+
+// notXIDStart and notXIDContinue hold the characters that ID_Start and
+// ID_Continue allow but the XID properties drop, because their NFKC forms are
+// not identifiers.
+var notXIDStart = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x037A, Hi: 0x037A, Stride: 1},
+		{Lo: 0x0E33, Hi: 0x0EB3, Stride: 0x80},
+		{Lo: 0x309B, Hi: 0x309C, Stride: 1},
+		{Lo: 0xFC5E, Hi: 0xFC63, Stride: 1},
+		{Lo: 0xFDFA, Hi: 0xFDFB, Stride: 1},
+		{Lo: 0xFE70, Hi: 0xFE7E, Stride: 2},
+		{Lo: 0xFF9E, Hi: 0xFF9F, Stride: 1},
+	},
+}
+
+var notXIDContinue = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x037A, Hi: 0x037A, Stride: 1},
+		{Lo: 0x309B, Hi: 0x309C, Stride: 1},
+		{Lo: 0xFC5E, Hi: 0xFC63, Stride: 1},
+		{Lo: 0xFDFA, Hi: 0xFDFB, Stride: 1},
+		{Lo: 0xFE70, Hi: 0xFE7E, Stride: 2},
+	},
 }
 
-func isEmoji(ch rune) bool {
-	emojisAndExtendedPictographicPattern := `
-	<a?:.+?:\d{18}>|[\x{1F300}-\x{1F9FF}\x{2600}-\x{26FF}\x{2700}-\x{27BF}\x{1F1E6}-\x{1F1FF}]`
-	emojiRegex := regexp.MustCompile(emojisAndExtendedPictographicPattern)
-	return emojiRegex.MatchString(string(ch))
+// emoji covers the symbol and pictograph blocks, including regional
+// indicators and skin tone modifiers, so flags and modified emoji lex as
+// one identifier.
+var emoji = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x2600, Hi: 0x27BF, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1F1E6, Hi: 0x1F1FF, Stride: 1},
+		{Lo: 0x1F300, Hi: 0x1F9FF, Stride: 1},
+		{Lo: 0x1FA70, Hi: 0x1FAFF, Stride: 1},
+	},
 }
 
 func newToken(tokenType token.TokenType, ch rune) token.Token {
@@ -39,6 +39,18 @@ func TestNextToken(t *testing.T) {
 	"foo if bar"
 	[1, "2"];
 	1 in [1, 2]
+	x += 1 -= 2 *= 3 /= 4 %= 5 **= 6 % 7
+	const y = 1;
+	null ?? a?.[0] ?.(
+	fn(...rest) m.name
+	import "lib.sv" as lib; export let
+	|x| x
+	match (x) { _ => 1 }
+	ok ? 1 : 2
+	[x for x in xs]
+	0..n 1..=2
+	yield x
+	0xFF & 0o17 | 0b1_0 ^ ~1_000 << 2 >> 1
 	`
 
 	tests := []struct {
@@ -169,6 +181,95 @@ func TestNextToken(t *testing.T) {
 		{token.COMMA, ","},
 		{token.INT, "2"},
 		{token.RBRACKET, "]"},
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.PERCENT_ASSIGN, "%="},
+		{token.INT, "5"},
+		{token.EXP_ASSIGN, "**="},
+		{token.INT, "6"},
+		{token.PERCENT, "%"},
+		{token.INT, "7"},
+		{token.CONST, "const"},
+		{token.IDENT, "y"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.NULL, "null"},
+		{token.NULLISH, "??"},
+		{token.IDENT, "a"},
+		{token.OPTIONAL, "?."},
+		{token.LBRACKET, "["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.OPTIONAL, "?."},
+		{token.LPAREN, "("},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RPAREN, ")"},
+		{token.IDENT, "m"},
+		{token.DOT, "."},
+		{token.IDENT, "name"},
+		{token.IMPORT, "import"},
+		{token.STRING, "lib.sv"},
+		{token.AS, "as"},
+		{token.IDENT, "lib"},
+		{token.SEMICOLON, ";"},
+		{token.EXPORT, "export"},
+		{token.LET, "let"},
+		{token.PIPE, "|"},
+		{token.IDENT, "x"},
+		{token.PIPE, "|"},
+		{token.IDENT, "x"},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.IDENT, "ok"},
+		{token.QUESTION, "?"},
+		{token.INT, "1"},
+		{token.COLON, ":"},
+		{token.INT, "2"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "x"},
+		{token.FOR, "for"},
+		{token.IDENT, "x"},
+		{token.IN, "in"},
+		{token.IDENT, "xs"},
+		{token.RBRACKET, "]"},
+		{token.INT, "0"},
+		{token.RANGE, ".."},
+		{token.IDENT, "n"},
+		{token.INT, "1"},
+		{token.RANGE_EQ, "..="},
+		{token.INT, "2"},
+		{token.YIELD, "yield"},
+		{token.IDENT, "x"},
+		{token.INT, "0xFF"},
+		{token.AMPERSAND, "&"},
+		{token.INT, "0o17"},
+		{token.PIPE, "|"},
+		{token.INT, "0b1_0"},
+		{token.CARET, "^"},
+		{token.TILDE, "~"},
+		{token.INT, "1_000"},
+		{token.LSHIFT, "<<"},
+		{token.INT, "2"},
+		{token.RSHIFT, ">>"},
+		{token.INT, "1"},
 		{token.EOF, ""},
 	}
 
@@ -186,3 +287,85 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let 🍇 = 5;\n  foo(🍇,\n\"a\nb\" )"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"🍇", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"foo", 2, 3},
+		{"(", 2, 6},
+		{"🍇", 2, 7},
+		{",", 2, 8},
+		{"a\nb", 3, 1},
+		{")", 4, 4},
+		{"", 4, 5},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tokenliteral wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position of %q wrong. expected=%d:%d, got=%d:%d",
+				i, tok.Literal, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := "café π2 变量 x_1 é 👩‍💻 🇫🇷 ❤️ x² ́a ゛a"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "café"},
+		{token.IDENT, "π2"},
+		{token.IDENT, "变量"},
+		{token.IDENT, "x_1"},
+		// A combining mark continues an identifier
+		{token.IDENT, "é"},
+		// Emoji sequences joined by ZWJ or a variation selector are one identifier
+		{token.IDENT, "👩‍💻"},
+		{token.IDENT, "🇫🇷"},
+		{token.IDENT, "❤️"},
+		// Superscripts are not XID_Continue
+		{token.IDENT, "x"},
+		{token.ILLEGAL, "²"},
+		// Nor may a combining mark start an identifier
+		{token.ILLEGAL, "́"},
+		{token.IDENT, "a"},
+		// ゛ is ID_Start but not XID_Start
+		{token.ILLEGAL, "゛"},
+		{token.IDENT, "a"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q (%q)", i, tt.expectedType, tok.Type, tok.Literal)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tokenliteral wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
@@ -11,6 +11,15 @@ func main() {
 	compiled := flag.Bool("compiled", false, "use the seville compiler and virtual machine")
 	flag.Parse()
 
+	if flag.NArg() > 0 {
+		err := repl.RunFile(flag.Arg(0), os.Stdout, *compiled)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	fmt.Printf("🍇 Seville v0.1.0-alpha 🍇\n")
 	repl.Start(os.Stdin, os.Stdout, *compiled)
 }
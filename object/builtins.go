@@ -0,0 +1,269 @@
+package object
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Builtins lists the builtin functions shared by the interpreter and the VM.
+// The VM refers to them by their index, so new ones go at the end.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{
+		"len",
+		&Builtin{Fn: func(args ...Object) Object {
+			if err := checkArgumentCount(args, 1); err != nil {
+				return err
+			}
+
+			switch arg := args[0].(type) {
+			case *String:
+				return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+			case *Array:
+				return &Integer{Value: int64(len(arg.Elements))}
+			case *Range:
+				return &Integer{Value: arg.Len()}
+			default:
+				return NewError(TypeError, "argument to `len` not supported, got %s", args[0].Type())
+			}
+		},
+		},
+	},
+	{"push", &Builtin{Fn: builtinPush}},
+	{
+		"type",
+		&Builtin{Fn: func(args ...Object) Object {
+			if err := checkArgumentCount(args, 1); err != nil {
+				return err
+			}
+
+			// Struct instances are named by their struct, so that type(p) == "Point"
+			if s, ok := args[0].(*Struct); ok {
+				return &String{Value: s.StructType.Name}
+			}
+
+			return &String{Value: string(args[0].Type())}
+		},
+		},
+	},
+	{
+		"items",
+		&Builtin{Fn: func(args ...Object) Object {
+			if err := checkArgumentCount(args, 1); err != nil {
+				return err
+			}
+
+			hash, ok := args[0].(*Hash)
+			if !ok {
+				return NewError(TypeError, "argument to `items` must be HASH, got %s", args[0].Type())
+			}
+
+			items := []Object{}
+			for _, pair := range hash.Pairs {
+				items = append(items, &Array{Elements: []Object{pair.Key, pair.Value}})
+			}
+			return &Array{Elements: items}
+		},
+		},
+	},
+	{
+		"print",
+		&Builtin{Fn: func(args ...Object) Object {
+			for _, arg := range args {
+				fmt.Println(arg.Inspect())
+			}
+
+			return NULL
+		},
+		},
+	},
+	{"iter", &Builtin{Fn: builtinIter}},
+	{"next", &Builtin{Fn: builtinNext}},
+	{"take", &Builtin{Fn: builtinTake}},
+	{"skip", &Builtin{Fn: builtinSkip}},
+	{"map", &Builtin{CallFn: builtinMap}},
+	{"close", &Builtin{Fn: builtinClose}},
+}
+
+// GetBuiltinByName returns the builtin function called name, or nil if there
+// is none.
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+
+	return nil
+}
+
+// builtinPush returns a new array with the elements of an array followed by
+// a value, leaving the array itself unchanged.
+func builtinPush(args ...Object) Object {
+	if err := checkArgumentCount(args, 2); err != nil {
+		return err
+	}
+
+	if args[0].Type() != ARRAY_OBJ {
+		return NewError(TypeError, "argument to `push` must be ARRAY, got %s", args[0].Type())
+	}
+
+	arr := args[0].(*Array)
+	length := len(arr.Elements)
+
+	newElements := make([]Object, length+1)
+	copy(newElements, arr.Elements)
+	newElements[length] = args[1]
+
+	return &Array{Elements: newElements}
+}
+
+func builtinIter(args ...Object) Object {
+	if err := checkArgumentCount(args, 1); err != nil {
+		return err
+	}
+
+	iter, err := GetIterator(args[0])
+	if err != nil {
+		return err
+	}
+
+	return iter
+}
+
+// builtinNext returns the next element of an iterator, or null once it is
+// exhausted.
+func builtinNext(args ...Object) Object {
+	if err := checkArgumentCount(args, 1); err != nil {
+		return err
+	}
+
+	iter, ok := args[0].(Iterator)
+	if !ok {
+		return NewError(TypeError, "argument to `next` must be ITERATOR, got %s", args[0].Type())
+	}
+
+	el, ok := iter.Next()
+	if !ok {
+		return NULL
+	}
+
+	return el
+}
+
+// builtinClose stops an iterator before the end of its sequence, which
+// unwinds a suspended generator without running the rest of its body.
+func builtinClose(args ...Object) Object {
+	if err := checkArgumentCount(args, 1); err != nil {
+		return err
+	}
+
+	iter, ok := args[0].(Iterator)
+	if !ok {
+		return NewError(TypeError, "argument to `close` must be ITERATOR, got %s", args[0].Type())
+	}
+
+	iter.Close()
+	return NULL
+}
+
+// builtinTake lazily yields the first n elements of an iterable, never
+// requesting more than n from it. The iterable is closed once n elements
+// have been taken, so an infinite generator does not stay suspended.
+func builtinTake(args ...Object) Object {
+	iter, n, err := iteratorAndCount("take", args)
+	if err != nil {
+		return err
+	}
+
+	taken := int64(0)
+	return &FuncIterator{Name: "take iterator", NextFn: func() (Object, bool) {
+		if taken >= n {
+			iter.Close()
+			return nil, false
+		}
+		taken++
+		return iter.Next()
+	}, CloseFn: iter.Close}
+}
+
+// builtinSkip lazily yields the elements of an iterable after the first n.
+func builtinSkip(args ...Object) Object {
+	iter, n, err := iteratorAndCount("skip", args)
+	if err != nil {
+		return err
+	}
+
+	return &FuncIterator{Name: "skip iterator", NextFn: func() (Object, bool) {
+		for ; n > 0; n-- {
+			el, ok := iter.Next()
+			if !ok {
+				return el, ok
+			}
+			if _, isError := el.(*Error); isError {
+				return el, ok
+			}
+		}
+		return iter.Next()
+	}, CloseFn: iter.Close}
+}
+
+// builtinMap lazily yields fn(el) for each element of an iterable.
+func builtinMap(call CallFunction, args ...Object) Object {
+	if err := checkArgumentCount(args, 2); err != nil {
+		return err
+	}
+
+	iter, err := GetIterator(args[0])
+	if err != nil {
+		return err
+	}
+	fn := args[1]
+
+	return &FuncIterator{Name: "map iterator", NextFn: func() (Object, bool) {
+		el, ok := iter.Next()
+		if !ok {
+			return el, ok
+		}
+		if _, isError := el.(*Error); isError {
+			return el, ok
+		}
+
+		result := call(fn, el)
+		if result == nil {
+			result = NULL
+		}
+		return result, true
+	}, CloseFn: iter.Close}
+}
+
+func iteratorAndCount(name string, args []Object) (Iterator, int64, *Error) {
+	if err := checkArgumentCount(args, 2); err != nil {
+		return nil, 0, err
+	}
+
+	iter, err := GetIterator(args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	n, ok := args[1].(*Integer)
+	if !ok {
+		return nil, 0, NewError(TypeError, "second argument to `%s` must be INTEGER, got %s", name, args[1].Type())
+	}
+	if n.Value < 0 {
+		return nil, 0, NewError(ArgumentError, "second argument to `%s` must not be negative, got %d", name, n.Value)
+	}
+
+	return iter, n.Value, nil
+}
+
+func checkArgumentCount(args []Object, want int) *Error {
+	if len(args) != want {
+		return NewError(ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), want)
+	}
+
+	return nil
+}
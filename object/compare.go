@@ -0,0 +1,145 @@
+package object
+
+import "strings"
+
+// Compare orders two objects, returning a negative number, zero or a
+// positive number when a sorts before, together with or after b. Integers
+// compare numerically and strings lexicographically by code point. Arrays
+// compare element by element up to the first difference, and an array that
+// is a prefix of another sorts first. It reports false if a and b cannot be
+// ordered, such as when they are of different types.
+func Compare(a, b Object) (int, bool) {
+	return compare(a, b, nil)
+}
+
+// comparing holds the pairs of arrays and structs whose comparison is in
+// progress. Both can contain themselves, so meeting one of these pairs again
+// means the comparison has gone round a cycle.
+type comparing map[[2]Object]bool
+
+// enter records that a and b are being compared, and reports false if they
+// already were.
+func (c *comparing) enter(a, b Object) bool {
+	if *c == nil {
+		*c = comparing{}
+	}
+
+	key := [2]Object{a, b}
+	if (*c)[key] {
+		return false
+	}
+	(*c)[key] = true
+
+	return true
+}
+
+func (c comparing) leave(a, b Object) {
+	delete(c, [2]Object{a, b})
+}
+
+func compare(a, b Object, active comparing) (int, bool) {
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case a.Value < b.Value:
+			return -1, true
+		case a.Value > b.Value:
+			return 1, true
+		default:
+			return 0, true
+		}
+	case *String:
+		b, ok := b.(*String)
+		if !ok {
+			return 0, false
+		}
+		// Byte order is code point order for UTF-8
+		return strings.Compare(a.Value, b.Value), true
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok {
+			return 0, false
+		}
+		return compareArrays(a, b, active)
+	default:
+		return 0, false
+	}
+}
+
+// compareArrays orders arrays element by element. Arrays met again within
+// themselves are only ordered when they are the same array, which is equal to
+// itself.
+func compareArrays(a, b *Array, active comparing) (int, bool) {
+	if a == b {
+		return 0, true
+	}
+	if !active.enter(a, b) {
+		return 0, false
+	}
+	defer active.leave(a, b)
+
+	for i := 0; i < len(a.Elements) && i < len(b.Elements); i++ {
+		x, y := a.Elements[i], b.Elements[i]
+
+		if c, ok := compare(x, y, active); ok {
+			if c != 0 {
+				return c, true
+			}
+			continue
+		}
+
+		// Elements that cannot be ordered, such as booleans, are fine as
+		// long as they are equal
+		if !equals(x, y, active) {
+			return 0, false
+		}
+	}
+
+	return len(a.Elements) - len(b.Elements), true
+}
+
+// equals compares arrays and structs by value and everything else with
+// Equals. Arrays and structs met again within themselves are compared by
+// identity, rather than recursing forever.
+func equals(a, b Object, active comparing) bool {
+	if a == b {
+		return true
+	}
+
+	switch a := a.(type) {
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) || !active.enter(a, b) {
+			return false
+		}
+		defer active.leave(a, b)
+
+		for i, el := range a.Elements {
+			if !equals(el, b.Elements[i], active) {
+				return false
+			}
+		}
+
+		return true
+	case *Struct:
+		b, ok := b.(*Struct)
+		if !ok || a.StructType != b.StructType || !active.enter(a, b) {
+			return false
+		}
+		defer active.leave(a, b)
+
+		for name, val := range a.Fields {
+			if !equals(val, b.Fields[name], active) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return a.Equals(b)
+	}
+}
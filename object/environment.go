@@ -2,12 +2,19 @@ package object
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	c := make(map[string]bool)
+	return &Environment{store: s, constants: c, outer: nil}
 }
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store     map[string]Object
+	constants map[string]bool // names in store that were declared with const
+	outer     *Environment
+	module    *Module // Set on the top-level environment of a module
+
+	// Set on the environment of a generator call, hands a yielded value to
+	// the consumer and returns once the next value is requested
+	yield func(val Object) Object
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -19,11 +26,105 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+// Set declares a binding in the current scope, shadowing any binding of the
+// same name in an outer scope.
 func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
+	delete(e.constants, name)
+	return val
+}
+
+// SetConst declares a binding in the current scope that cannot be reassigned.
+func (e *Environment) SetConst(name string, val Object) Object {
+	e.store[name] = val
+	e.constants[name] = true
 	return val
 }
 
+// Assign updates an existing binding in the innermost scope that declares it,
+// and reports false if the name was never declared. Callers are expected to
+// check IsConst first, Assign does not guard constant bindings.
+func (e *Environment) Assign(name string, val Object) (Object, bool) {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = val
+		return val, true
+	}
+
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+
+	return nil, false
+}
+
+// IsConst reports whether the innermost binding of name was declared with const.
+func (e *Environment) IsConst(name string) bool {
+	if _, ok := e.store[name]; ok {
+		return e.constants[name]
+	}
+
+	if e.outer != nil {
+		return e.outer.IsConst(name)
+	}
+
+	return false
+}
+
+// DeclaresConst reports whether name was declared with const in this scope
+// itself, ignoring outer scopes.
+func (e *Environment) DeclaresConst(name string) bool {
+	return e.constants[name]
+}
+
+// Module returns the module whose top-level environment encloses this one, or
+// nil if the environment was not created for a module.
+func (e *Environment) Module() *Module {
+	if e.module != nil || e.outer == nil {
+		return e.module
+	}
+
+	return e.outer.Module()
+}
+
+// EnsureModule returns the module e belongs to. An environment created
+// outside of any module has its outermost environment made the top level of
+// a __main__ module the first time, so that all of its imports share one
+// registry resolved against searchPath.
+func (e *Environment) EnsureModule(searchPath []string) *Module {
+	if m := e.Module(); m != nil {
+		return m
+	}
+
+	root := e
+	for root.outer != nil {
+		root = root.outer
+	}
+
+	root.module = &Module{
+		Name:     "__main__",
+		Env:      root,
+		Exports:  map[string]bool{},
+		Registry: NewModuleRegistry(searchPath),
+	}
+	return root.module
+}
+
+// SetYield makes e the environment of a running generator, whose yields are
+// handled by yield.
+func (e *Environment) SetYield(yield func(val Object) Object) {
+	e.yield = yield
+}
+
+// Yield returns the yield handler of the generator whose body this
+// environment belongs to, or nil outside of a generator.
+func (e *Environment) Yield() func(val Object) Object {
+	if e.yield != nil || e.outer == nil {
+		return e.yield
+	}
+
+	return e.outer.Yield()
+}
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
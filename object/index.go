@@ -0,0 +1,104 @@
+package object
+
+import "unicode/utf8"
+
+// NormalizeIndex resolves a negative index relative to the end of a
+// collection of the given length, and reports whether the result is in bounds.
+func NormalizeIndex(rawIdx, length int64) (int64, bool) {
+	adjIdx := rawIdx
+	if rawIdx < 0 {
+		adjIdx = length + rawIdx
+	}
+
+	return adjIdx, adjIdx >= 0 && adjIdx < length
+}
+
+// SliceIndices returns the indices selected by a Python-style slice over a
+// collection of the given length. Omitted bounds are passed as nil, and out
+// of range bounds are clamped rather than reported as errors.
+func SliceIndices(length int64, start, end, step *int64) ([]int64, *Error) {
+	stepVal := int64(1)
+	if step != nil {
+		stepVal = *step
+	}
+	if stepVal == 0 {
+		return nil, NewError(ArgumentError, "slice step cannot be zero")
+	}
+
+	// With a negative step the slice walks backwards, so the valid bounds
+	// shift from [0, length] to [-1, length - 1]
+	lower, upper := int64(0), length
+	if stepVal < 0 {
+		lower, upper = -1, length-1
+	}
+
+	clamp := func(bound *int64, defaultVal int64) int64 {
+		if bound == nil {
+			return defaultVal
+		}
+
+		val := *bound
+		if val < 0 {
+			val += length
+		}
+		if val < lower {
+			return lower
+		}
+		if val > upper {
+			return upper
+		}
+		return val
+	}
+
+	var startVal, endVal int64
+	if stepVal > 0 {
+		startVal, endVal = clamp(start, lower), clamp(end, upper)
+	} else {
+		startVal, endVal = clamp(start, upper), clamp(end, lower)
+	}
+
+	indices := []int64{}
+	for i := startVal; (stepVal > 0 && i < endVal) || (stepVal < 0 && i > endVal); i += stepVal {
+		indices = append(indices, i)
+	}
+
+	return indices, nil
+}
+
+// IsMissingIndex reports whether indexing left with index would fail only
+// because the key or position is absent, which optional indexing turns into
+// null. Other failures, such as an unhashable key, are still errors.
+func IsMissingIndex(left, index Object) bool {
+	switch left := left.(type) {
+	case *Hash:
+		key, ok := index.(Hashable)
+		if !ok {
+			return false
+		}
+		_, ok = left.Pairs[key.HashKey()]
+		return !ok
+	case *Array:
+		idx, ok := index.(*Integer)
+		if !ok {
+			return false
+		}
+		_, inBounds := NormalizeIndex(idx.Value, int64(len(left.Elements)))
+		return !inBounds
+	case *String:
+		idx, ok := index.(*Integer)
+		if !ok {
+			return false
+		}
+		_, inBounds := NormalizeIndex(idx.Value, int64(utf8.RuneCountInString(left.Value)))
+		return !inBounds
+	case *Range:
+		idx, ok := index.(*Integer)
+		if !ok {
+			return false
+		}
+		_, inBounds := NormalizeIndex(idx.Value, left.Len())
+		return !inBounds
+	default:
+		return false
+	}
+}
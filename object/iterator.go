@@ -0,0 +1,132 @@
+package object
+
+import "unicode/utf8"
+
+// Iterator produces the elements of a sequence one at a time, so that the
+// sequence never has to be materialized.
+type Iterator interface {
+	Object
+	// Next returns the next element, or false once the sequence is
+	// exhausted. If producing an element fails, the *Error is returned as
+	// the element and the iterator is exhausted from then on.
+	Next() (Object, bool)
+	// Close stops the iterator before the end of the sequence, releasing
+	// anything it holds, such as the goroutine of a generator. Next reports
+	// the end of the sequence afterwards.
+	Close()
+}
+
+// Iterable is implemented by objects whose elements can be iterated over.
+type Iterable interface {
+	Iter() Iterator
+}
+
+// GetIterator returns a new iterator over the elements of obj.
+func GetIterator(obj Object) (Iterator, *Error) {
+	iterable, ok := obj.(Iterable)
+	if !ok {
+		return nil, NewError(TypeError, "%s is not iterable", obj.Type())
+	}
+
+	return iterable.Iter(), nil
+}
+
+// FuncIterator is an Iterator whose elements are produced by NextFn. NextFn
+// is not called again once it has reported the end of the sequence or
+// returned an error, or once the iterator is closed.
+type FuncIterator struct {
+	Name    string // Describes the sequence, as in <array iterator>
+	NextFn  func() (Object, bool)
+	CloseFn func() // Called by the first call to Close. May be nil
+	done    bool
+	closed  bool
+}
+
+func (fi *FuncIterator) Type() ObjectType         { return ITERATOR_OBJ }
+func (fi *FuncIterator) Inspect() string          { return "<" + fi.Name + ">" }
+func (fi *FuncIterator) Equals(other Object) bool { return fi == other }
+func (fi *FuncIterator) Next() (Object, bool) {
+	if fi.done {
+		return nil, false
+	}
+
+	val, ok := fi.NextFn()
+	if !ok {
+		fi.done = true
+		return nil, false
+	}
+	if _, isError := val.(*Error); isError {
+		fi.done = true
+	}
+
+	return val, true
+}
+
+func (fi *FuncIterator) Close() {
+	if fi.closed {
+		return
+	}
+	fi.done, fi.closed = true, true
+
+	if fi.CloseFn != nil {
+		fi.CloseFn()
+	}
+}
+
+// Iter returns the iterator itself, so iterating over an iterator continues
+// from where it currently is.
+func (fi *FuncIterator) Iter() Iterator { return fi }
+
+// Iter iterates over the elements the array has when each one is reached, so
+// elements pushed during iteration are included.
+func (a *Array) Iter() Iterator {
+	i := 0
+	return &FuncIterator{Name: "array iterator", NextFn: func() (Object, bool) {
+		if i >= len(a.Elements) {
+			return nil, false
+		}
+		i++
+		return a.Elements[i-1], true
+	}}
+}
+
+// Iter iterates over the characters of the string.
+func (s *String) Iter() Iterator {
+	offset := 0
+	return &FuncIterator{Name: "string iterator", NextFn: func() (Object, bool) {
+		if offset >= len(s.Value) {
+			return nil, false
+		}
+		ch, size := utf8.DecodeRuneInString(s.Value[offset:])
+		offset += size
+		return &String{Value: string(ch)}, true
+	}}
+}
+
+// Iter iterates over the keys the hash has when Iter is called.
+func (h *Hash) Iter() Iterator {
+	keys := []Object{}
+	for _, pair := range h.Pairs {
+		keys = append(keys, pair.Key)
+	}
+
+	i := 0
+	return &FuncIterator{Name: "hash iterator", NextFn: func() (Object, bool) {
+		if i >= len(keys) {
+			return nil, false
+		}
+		i++
+		return keys[i-1], true
+	}}
+}
+
+func (r *Range) Iter() Iterator {
+	i := int64(0)
+	return &FuncIterator{Name: "range iterator", NextFn: func() (Object, bool) {
+		if i >= r.Len() {
+			return nil, false
+		}
+		i++
+		return &Integer{Value: r.At(i - 1)}, true
+	}}
+}
@@ -0,0 +1,88 @@
+package object
+
+// IsMissingMember reports whether obj.name would fail only because obj is a
+// hash without the key name, which optional member access turns into null
+// just as optional indexing does.
+func IsMissingMember(obj Object, name string) bool {
+	if _, ok := LookupMethod(obj, name); ok {
+		return false
+	}
+
+	_, ok := obj.(*Hash)
+	return ok && IsMissingIndex(obj, &String{Value: name})
+}
+
+// GetMember reads obj.name, which is the string key name of a hash, a field
+// of a struct or caught exception, an export of a module or otherwise a
+// method of obj's type. Hash keys take precedence over hash methods.
+func GetMember(obj Object, name string) (Object, *Error) {
+	switch obj := obj.(type) {
+	case *Hash:
+		key := &String{Value: name}
+		if pair, ok := obj.Pairs[key.HashKey()]; ok {
+			return pair.Value, nil
+		}
+		if method, ok := LookupMethod(obj, name); ok {
+			return method, nil
+		}
+		return nil, NewError(KeyError, "key %s not found in hash map", key.Inspect())
+	case *Struct:
+		val, ok := obj.Fields[name]
+		if !ok {
+			return nil, NewError(AttributeError, "%s has no field %s", obj.StructType.Name, name)
+		}
+		return val, nil
+	case *Exception:
+		return obj.Field(name)
+	case *Module:
+		// Names that are not exported are not accessible, even though the
+		// module declares them
+		val, ok := obj.Get(name)
+		if !obj.Exports[name] || !ok {
+			return nil, NewError(AttributeError, "module %s has no export %s", obj.Name, name)
+		}
+		return val, nil
+	default:
+		if method, ok := LookupMethod(obj, name); ok {
+			return method, nil
+		}
+		if _, ok := Methods[obj.Type()]; ok {
+			return nil, NewError(AttributeError, "%s has no method %s", obj.Type(), name)
+		}
+		return nil, NewError(TypeError, "cannot access member %s of %s", name, obj.Type())
+	}
+}
+
+// CheckSetMember returns the error that assigning to obj.name raises, or nil
+// if it can be assigned. Only the keys of hashes and the fields of structs
+// can be.
+func CheckSetMember(obj Object, name string) *Error {
+	switch obj := obj.(type) {
+	case *Hash:
+		return nil
+	case *Struct:
+		if !obj.StructType.HasField(name) {
+			return NewError(AttributeError, "%s has no field %s", obj.StructType.Name, name)
+		}
+		return nil
+	default:
+		return NewError(TypeError, "cannot assign to member %s of %s", name, obj.Type())
+	}
+}
+
+// SetMember assigns val to obj.name.
+func SetMember(obj Object, name string, val Object) *Error {
+	if err := CheckSetMember(obj, name); err != nil {
+		return err
+	}
+
+	switch obj := obj.(type) {
+	case *Struct:
+		obj.Fields[name] = val
+	case *Hash:
+		key := &String{Value: name}
+		obj.Pairs[key.HashKey()] = HashPair{Key: key, Value: val}
+	}
+
+	return nil
+}
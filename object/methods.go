@@ -0,0 +1,244 @@
+package object
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Method is the Go implementation of a method on a built-in type, called with
+// the value it was looked up on as its receiver.
+type Method func(receiver Object, args ...Object) Object
+
+// Methods holds the methods of each built-in type, called as s.split(","),
+// shared by the interpreter and the VM.
+var Methods = map[ObjectType]map[string]Method{
+	STRING_OBJ: {
+		"len": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 0); err != nil {
+				return err
+			}
+			s := receiver.(*String).Value
+			return &Integer{Value: int64(utf8.RuneCountInString(s))}
+		},
+		"upper": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 0); err != nil {
+				return err
+			}
+			return &String{Value: strings.ToUpper(receiver.(*String).Value)}
+		},
+		"lower": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 0); err != nil {
+				return err
+			}
+			return &String{Value: strings.ToLower(receiver.(*String).Value)}
+		},
+		"trim": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 0); err != nil {
+				return err
+			}
+			return &String{Value: strings.TrimSpace(receiver.(*String).Value)}
+		},
+		"split": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 1); err != nil {
+				return err
+			}
+			sep, ok := args[0].(*String)
+			if !ok {
+				return NewError(TypeError, "argument to `split` must be STRING, got %s", args[0].Type())
+			}
+
+			elements := []Object{}
+			for _, part := range strings.Split(receiver.(*String).Value, sep.Value) {
+				elements = append(elements, &String{Value: part})
+			}
+			return &Array{Elements: elements}
+		},
+		"contains": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 1); err != nil {
+				return err
+			}
+			sub, ok := args[0].(*String)
+			if !ok {
+				return NewError(TypeError, "argument to `contains` must be STRING, got %s", args[0].Type())
+			}
+			return nativeBoolToBooleanObject(strings.Contains(receiver.(*String).Value, sub.Value))
+		},
+		"starts_with": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 1); err != nil {
+				return err
+			}
+			prefix, ok := args[0].(*String)
+			if !ok {
+				return NewError(TypeError, "argument to `starts_with` must be STRING, got %s", args[0].Type())
+			}
+			return nativeBoolToBooleanObject(strings.HasPrefix(receiver.(*String).Value, prefix.Value))
+		},
+		"ends_with": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 1); err != nil {
+				return err
+			}
+			suffix, ok := args[0].(*String)
+			if !ok {
+				return NewError(TypeError, "argument to `ends_with` must be STRING, got %s", args[0].Type())
+			}
+			return nativeBoolToBooleanObject(strings.HasSuffix(receiver.(*String).Value, suffix.Value))
+		},
+		"replace": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 2); err != nil {
+				return err
+			}
+			old, ok := args[0].(*String)
+			if !ok {
+				return NewError(TypeError, "arguments to `replace` must be STRING, got %s", args[0].Type())
+			}
+			replacement, ok := args[1].(*String)
+			if !ok {
+				return NewError(TypeError, "arguments to `replace` must be STRING, got %s", args[1].Type())
+			}
+			return &String{Value: strings.ReplaceAll(receiver.(*String).Value, old.Value, replacement.Value)}
+		},
+	},
+	ARRAY_OBJ: {
+		"len": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 0); err != nil {
+				return err
+			}
+			return &Integer{Value: int64(len(receiver.(*Array).Elements))}
+		},
+		// Returns a new array, as the push builtin does
+		"push": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 1); err != nil {
+				return err
+			}
+			return builtinPush(receiver, args[0])
+		},
+		// Unlike push, appends to the array itself
+		"append": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 1); err != nil {
+				return err
+			}
+			arr := receiver.(*Array)
+			arr.Elements = append(arr.Elements, args[0])
+			return NULL
+		},
+		"pop": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 0); err != nil {
+				return err
+			}
+			arr := receiver.(*Array)
+			if len(arr.Elements) == 0 {
+				return NewError(IndexError, "pop from empty array")
+			}
+			last := arr.Elements[len(arr.Elements)-1]
+			arr.Elements = arr.Elements[:len(arr.Elements)-1]
+			return last
+		},
+		"contains": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 1); err != nil {
+				return err
+			}
+			for _, el := range receiver.(*Array).Elements {
+				if el.Equals(args[0]) {
+					return TRUE
+				}
+			}
+			return FALSE
+		},
+		"join": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 1); err != nil {
+				return err
+			}
+			sep, ok := args[0].(*String)
+			if !ok {
+				return NewError(TypeError, "argument to `join` must be STRING, got %s", args[0].Type())
+			}
+
+			parts := []string{}
+			for _, el := range receiver.(*Array).Elements {
+				parts = append(parts, el.Inspect())
+			}
+			return &String{Value: strings.Join(parts, sep.Value)}
+		},
+	},
+	RANGE_OBJ: {
+		"len": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 0); err != nil {
+				return err
+			}
+			return &Integer{Value: receiver.(*Range).Len()}
+		},
+	},
+	HASH_OBJ: {
+		"len": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 0); err != nil {
+				return err
+			}
+			return &Integer{Value: int64(len(receiver.(*Hash).Pairs))}
+		},
+		"keys": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 0); err != nil {
+				return err
+			}
+			keys := []Object{}
+			for _, pair := range receiver.(*Hash).Pairs {
+				keys = append(keys, pair.Key)
+			}
+			return &Array{Elements: keys}
+		},
+		"values": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 0); err != nil {
+				return err
+			}
+			values := []Object{}
+			for _, pair := range receiver.(*Hash).Pairs {
+				values = append(values, pair.Value)
+			}
+			return &Array{Elements: values}
+		},
+		"get": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 2); err != nil {
+				return err
+			}
+			key, ok := args[0].(Hashable)
+			if !ok {
+				return NewError(TypeError, "unusable as hash key: %s", args[0].Type())
+			}
+			if pair, ok := receiver.(*Hash).Pairs[key.HashKey()]; ok {
+				return pair.Value
+			}
+			return args[1]
+		},
+		"delete": func(receiver Object, args ...Object) Object {
+			if err := checkArgumentCount(args, 1); err != nil {
+				return err
+			}
+			key, ok := args[0].(Hashable)
+			if !ok {
+				return NewError(TypeError, "unusable as hash key: %s", args[0].Type())
+			}
+			delete(receiver.(*Hash).Pairs, key.HashKey())
+			return NULL
+		},
+	},
+}
+
+// LookupMethod returns the method name of obj bound to obj, so that it can be
+// called like any other function. It reports false if obj's type has no
+// method of that name.
+func LookupMethod(obj Object, name string) (Object, bool) {
+	fn, ok := Methods[obj.Type()][name]
+	if !ok {
+		return nil, false
+	}
+
+	return &Builtin{Fn: func(args ...Object) Object {
+		return fn(obj, args...)
+	}}, true
+}
+
+func nativeBoolToBooleanObject(b bool) *Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
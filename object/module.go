@@ -0,0 +1,73 @@
+package object
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SearchPath returns the directories imports are looked up in when they are
+// not found relative to the importing file, taken from $SEVILLE_PATH.
+func SearchPath() []string {
+	return filepath.SplitList(os.Getenv("SEVILLE_PATH"))
+}
+
+// ResolveModulePath finds the file an import refers to. Relative paths are
+// looked up next to the importing file first, or the working directory for
+// the REPL, then in each directory of the search path.
+func ResolveModulePath(path string, importer *Module) (string, *Error) {
+	candidates := []string{path}
+
+	if !filepath.IsAbs(path) {
+		dir := "."
+		if importer.Path != "" {
+			dir = filepath.Dir(importer.Path)
+		}
+
+		candidates = []string{filepath.Join(dir, path)}
+		for _, dir := range importer.Registry.SearchPath {
+			candidates = append(candidates, filepath.Join(dir, path))
+		}
+	}
+
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		abs, err := filepath.Abs(candidate)
+		if err != nil {
+			return "", NewError(ImportError, "cannot resolve module %s: %s", path, err)
+		}
+
+		return abs, nil
+	}
+
+	return "", NewError(ImportError, "module not found: %s", path)
+}
+
+// ModuleName returns the name of the module at path, its file name without
+// the extension.
+func ModuleName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// CircularImport returns the error of importing the module at path while it
+// is still being loaded, or nil if it is not.
+func (r *ModuleRegistry) CircularImport(path string) *Error {
+	for i, loading := range r.Loading {
+		if loading != path {
+			continue
+		}
+
+		cycle := []string{}
+		for _, p := range append(r.Loading[i:], path) {
+			cycle = append(cycle, filepath.Base(p))
+		}
+
+		return NewError(ImportError, "circular import: %s", strings.Join(cycle, " -> "))
+	}
+
+	return nil
+}
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
 	"seville/ast"
+	"seville/opcode"
+	"sort"
 	"strings"
 )
 
@@ -21,6 +24,15 @@ const (
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	EXCEPTION_OBJ    = "EXCEPTION"
+	MODULE_OBJ       = "MODULE"
+	STRUCT_TYPE_OBJ  = "STRUCT_TYPE"
+	STRUCT_OBJ       = "STRUCT"
+	RANGE_OBJ        = "RANGE"
+	ITERATOR_OBJ     = "ITERATOR"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	PATTERN_OBJ           = "PATTERN"
 )
 
 type Object interface {
@@ -29,12 +41,24 @@ type Object interface {
 	Equals(other Object) bool
 }
 
+// The booleans and null are singletons, shared by the interpreter and the
+// VM, so that they can be compared by identity.
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
 type Integer struct {
 	Value int64
 }
 
 type BuiltinFunction func(args ...Object) Object
 
+// CallFunction calls fn with args, for a builtin that is passed a function,
+// in whichever of the interpreter and the VM is running the builtin.
+type CallFunction func(fn Object, args ...Object) Object
+
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Equals(other Object) bool {
@@ -70,38 +94,291 @@ func (rv *ReturnValue) Equals(other Object) bool {
 	return rv == other
 }
 
+// ErrorKind classifies an Error, so that scripts and embedders can tell
+// failures apart without matching on the message
+type ErrorKind string
+
+const (
+	GenericError      ErrorKind = "Error" // Values raised with throw
+	TypeError         ErrorKind = "TypeError"
+	KeyError          ErrorKind = "KeyError"
+	IndexError        ErrorKind = "IndexError"
+	NameError         ErrorKind = "NameError"
+	ArgumentError     ErrorKind = "ArgumentError"
+	ZeroDivisionError ErrorKind = "ZeroDivisionError"
+	ImportError       ErrorKind = "ImportError"
+	AttributeError    ErrorKind = "AttributeError"
+	MatchError        ErrorKind = "MatchError"
+)
+
 type Error struct {
+	Kind    ErrorKind
 	Message string
+	// The value passed to throw, nil for errors raised by the runtime itself
+	Value Object
+	// Position of the expression that raised the error, 0 when unknown
+	Line   int
+	Column int
+	// The calls the error propagated through, innermost call first
+	Stack []StackFrame
+}
+
+// StackFrame records a function call that an error propagated out of
+type StackFrame struct {
+	Function string // The name the function was called by
+	Line     int    // Position of the call site
+	Column   int
+}
+
+func (sf StackFrame) String() string {
+	return fmt.Sprintf("at %s (line %d, column %d)", sf.Function, sf.Line, sf.Column)
+}
+
+func NewError(kind ErrorKind, format string, a ...interface{}) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string  { return string(e.Kind) + ": " + e.Message }
+
+// Error makes runtime errors usable as Go errors, which is how the VM
+// reports them.
+func (e *Error) Error() string { return e.Inspect() }
 func (e *Error) Equals(other Object) bool {
 	otherErr, ok := other.(*Error)
 	if !ok {
 		return false
 	}
-	return e.Message == otherErr.Message
+	return e.Kind == otherErr.Kind && e.Message == otherErr.Message
+}
+
+// Copy returns a copy of the error that can be given a position or stack
+// frames without changing the original, which a caught exception still holds.
+func (e *Error) Copy() *Error {
+	copied := *e
+	copied.Stack = append([]StackFrame(nil), e.Stack...)
+	return &copied
+}
+
+// Traceback lists the calls the error propagated through, outermost call
+// first, or returns an empty string if the error was raised at the top level.
+func (e *Error) Traceback() string {
+	if len(e.Stack) == 0 {
+		return ""
+	}
+
+	var out bytes.Buffer
+
+	out.WriteString("Traceback (most recent call last):\n")
+	for i := len(e.Stack) - 1; i >= 0; i-- {
+		out.WriteString("    " + e.Stack[i].String() + "\n")
+	}
+
+	return out.String()
+}
+
+// Exception is an Error that has been caught, so that scripts can hold on to
+// it and inspect it as an ordinary value rather than it propagating.
+type Exception struct {
+	Error *Error
+}
+
+// Field reads a field of the exception: its message, type, value, line or
+// column.
+func (ex *Exception) Field(name string) (Object, *Error) {
+	err := ex.Error
+
+	switch name {
+	case "message":
+		return &String{Value: err.Message}, nil
+	case "type":
+		return &String{Value: string(err.Kind)}, nil
+	case "value":
+		if err.Value == nil {
+			return NULL, nil
+		}
+		return err.Value, nil
+	case "line":
+		return &Integer{Value: int64(err.Line)}, nil
+	case "column":
+		return &Integer{Value: int64(err.Column)}, nil
+	default:
+		return nil, NewError(KeyError, "exception has no field %s", name)
+	}
+}
+
+// Index reads the field of the exception named by index, as in e["message"].
+func (ex *Exception) Index(index Object) (Object, *Error) {
+	key, ok := index.(*String)
+	if !ok {
+		return nil, NewError(TypeError, "exception fields must be accessed with strings, got %s", index.Type())
+	}
+
+	return ex.Field(key.Value)
+}
+
+func (ex *Exception) Type() ObjectType { return EXCEPTION_OBJ }
+func (ex *Exception) Inspect() string  { return ex.Error.Inspect() }
+func (ex *Exception) Equals(other Object) bool {
+	otherEx, ok := other.(*Exception)
+	if !ok {
+		return false
+	}
+	return ex.Error == otherEx.Error
+}
+
+// Module is a file loaded with import. Files that import it can only access
+// the names it exports.
+type Module struct {
+	Name     string // The file name without its extension
+	Path     string // Absolute path of the file, empty for the REPL
+	Env      *Environment
+	Exports  map[string]bool
+	Registry *ModuleRegistry
+
+	// Set for a module run by the VM, whose top-level names live in global
+	// slots rather than in Env, along with the name of each slot
+	Globals     []Object
+	GlobalNames []string
 }
 
+// NewModule creates a module with an empty top-level environment, that
+// imports from within the module are resolved against.
+func NewModule(name, path string, registry *ModuleRegistry) *Module {
+	m := &Module{Name: name, Path: path, Exports: map[string]bool{}, Registry: registry}
+	m.Env = NewEnvironment()
+	m.Env.module = m
+	return m
+}
+
+// Get returns the value of a name declared at the top level of the module.
+func (m *Module) Get(name string) (Object, bool) {
+	if m.Globals == nil {
+		return m.Env.Get(name)
+	}
+
+	for i, global := range m.GlobalNames {
+		if global == name && m.Globals[i] != nil {
+			return m.Globals[i], true
+		}
+	}
+
+	return nil, false
+}
+
+func (m *Module) Type() ObjectType         { return MODULE_OBJ }
+func (m *Module) Inspect() string          { return "<module " + m.Name + ">" }
+func (m *Module) Equals(other Object) bool { return m == other }
+
+// ModuleRegistry is shared by all the modules of a program, so that each file
+// is only evaluated once however many times it is imported.
+type ModuleRegistry struct {
+	// Directories searched, in order, for imports that are not found
+	// relative to the importing file
+	SearchPath []string
+	Loaded     map[string]*Module // By absolute path
+	// Paths of the modules currently being evaluated, outermost first, used
+	// to detect circular imports
+	Loading []string
+}
+
+func NewModuleRegistry(searchPath []string) *ModuleRegistry {
+	return &ModuleRegistry{SearchPath: searchPath, Loaded: map[string]*Module{}}
+}
+
+// StructType is declared with struct Name { fields }, and is called to
+// construct instances of it.
+type StructType struct {
+	Name   string
+	Fields []string
+}
+
+func (st *StructType) Type() ObjectType         { return STRUCT_TYPE_OBJ }
+func (st *StructType) Inspect() string          { return "<struct " + st.Name + ">" }
+func (st *StructType) Equals(other Object) bool { return st == other }
+
+// HasField reports whether name is one of the declared fields.
+func (st *StructType) HasField(name string) bool {
+	for _, field := range st.Fields {
+		if field == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// KeywordArgument is an evaluated name = value argument of a call.
+type KeywordArgument struct {
+	Name  string
+	Value Object
+}
+
+// Construct creates an instance of st, taking its fields positionally in
+// declaration order or as keyword arguments. Every field must be given.
+func (st *StructType) Construct(args []Object, kwargs []KeywordArgument) (*Struct, *Error) {
+	if len(args) > len(st.Fields) {
+		return nil, NewError(ArgumentError, "too many arguments. got=%d, want at most %d", len(args), len(st.Fields))
+	}
+
+	fields := map[string]Object{}
+	for i, arg := range args {
+		fields[st.Fields[i]] = arg
+	}
+
+	for _, kwarg := range kwargs {
+		if !st.HasField(kwarg.Name) {
+			return nil, NewError(ArgumentError, "unexpected keyword argument %s", kwarg.Name)
+		}
+		if _, ok := fields[kwarg.Name]; ok {
+			return nil, NewError(ArgumentError, "multiple values for field %s", kwarg.Name)
+		}
+		fields[kwarg.Name] = kwarg.Value
+	}
+
+	for _, name := range st.Fields {
+		if _, ok := fields[name]; !ok {
+			return nil, NewError(ArgumentError, "missing argument for field %s", name)
+		}
+	}
+
+	return &Struct{StructType: st, Fields: fields}, nil
+}
+
+// Struct is an instance of a StructType. It always holds a value for exactly
+// the fields of its type.
+type Struct struct {
+	StructType *StructType
+	Fields     map[string]Object
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+func (s *Struct) Inspect() string  { return inspect(s, nil) }
+
+// Equals compares structs field by field, so instances of the same struct
+// type with equal fields are equal.
+func (s *Struct) Equals(other Object) bool { return equals(s, other, nil) }
+
 type Function struct {
+	Name       string // Empty for anonymous functions
 	Parameters []*ast.Identifier
+	Defaults   map[string]ast.Expression
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Generator  bool // Calls return an iterator over the values the body yields
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
-	}
-
 	out.WriteString("fn")
+	if f.Name != "" {
+		out.WriteString(" " + f.Name)
+	}
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(ast.ParametersString(f.Parameters, f.Defaults, f.Rest))
 	out.WriteString(") {\n    ")
 	out.WriteString(f.Body.String())
 	out.WriteString("\n")
@@ -111,6 +388,149 @@ func (f *Function) Inspect() string {
 }
 func (f *Function) Equals(other Object) bool { return f == other }
 
+// CompiledFunction is a function compiled to bytecode, with constants of
+// its own. It is a constant of the code it is declared in, which wraps it in
+// a Closure each time the declaration runs.
+type CompiledFunction struct {
+	Instructions opcode.Instructions
+	Constants    []Object
+	NumLocals    int
+	Name         string   // Empty for anonymous functions
+	Parameters   []string // The names of the parameters, which take the first local slots
+	HasDefault   []bool   // Whether each parameter has a default value
+	Rest         string   // The rest parameter, whose slot follows the parameters. Empty if none
+	// Captures describes the variables the function closes over, in the
+	// order of its free symbols
+	Captures []Capture
+	// Positions holds the source position of each instruction that can
+	// raise an error, by increasing offset
+	Positions []Position
+	// CallSites describes each call the function makes, by increasing
+	// offset, for the stack frames of the errors that propagate out of them
+	CallSites []CallSite
+	// Handlers is the exception table of the function. An inner try comes
+	// before the tries around it
+	Handlers []Handler
+}
+
+// Position is the source position of the instruction at Offset.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// CallSite is the stack frame recorded for the call made by the instruction
+// at Offset.
+type CallSite struct {
+	Offset int
+	Frame  StackFrame
+}
+
+// Handler is an entry of an exception table. An error raised by an
+// instruction in [Start, End) is caught by the code at Target, which runs
+// with Depth elements on the stack above the locals of the frame, and the
+// caught exception on top of them.
+type Handler struct {
+	Start  int
+	End    int
+	Target int
+	Depth  int
+}
+
+// Capture tells the VM where to find a variable when it creates a closure:
+// a local slot of the enclosing function if Local is set, else one of the
+// enclosing function's own free variables. Name is the name of the
+// variable, for errors.
+type Capture struct {
+	Name  string
+	Local bool
+	Index int
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	params := append([]string{}, cf.Parameters...)
+	if cf.Rest != "" {
+		params = append(params, "..."+cf.Rest)
+	}
+
+	name := ""
+	if cf.Name != "" {
+		name = " " + cf.Name
+	}
+
+	return fmt.Sprintf("fn%s(%s) {...}", name, strings.Join(params, ", "))
+}
+func (cf *CompiledFunction) Equals(other Object) bool { return cf == other }
+
+// PositionAt returns the position of the instruction that the given offset
+// falls in, which may be past the opcode, among its operands. It returns
+// zeros if the instruction has no position.
+func (cf *CompiledFunction) PositionAt(offset int) (line, column int) {
+	i := sort.Search(len(cf.Positions), func(i int) bool { return cf.Positions[i].Offset > offset })
+	if i == 0 {
+		return 0, 0
+	}
+
+	return cf.Positions[i-1].Line, cf.Positions[i-1].Column
+}
+
+// CallSiteAt returns the stack frame of the call instruction that the given
+// offset falls in.
+func (cf *CompiledFunction) CallSiteAt(offset int) StackFrame {
+	i := sort.Search(len(cf.CallSites), func(i int) bool { return cf.CallSites[i].Offset > offset })
+	if i == 0 {
+		return StackFrame{Function: "<anonymous>"}
+	}
+
+	return cf.CallSites[i-1].Frame
+}
+
+// HandlerAt returns the innermost handler of the instruction that the given
+// offset falls in, if any.
+func (cf *CompiledFunction) HandlerAt(offset int) (Handler, bool) {
+	for _, handler := range cf.Handlers {
+		if handler.Start <= offset && offset < handler.End {
+			return handler, true
+		}
+	}
+
+	return Handler{}, false
+}
+
+// Closure is a compiled function together with the variables it captured.
+// It is a function as far as programs can tell.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []*Upvalue
+	// Module is the module the function was declared in, whose globals it
+	// reads and assigns wherever it is called from
+	Module *Module
+}
+
+func (c *Closure) Type() ObjectType         { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string          { return c.Fn.Inspect() }
+func (c *Closure) Equals(other Object) bool { return c == other }
+
+// Upvalue is a variable captured by a closure. While the function declaring
+// the variable runs, Value points at its slot on the VM stack, so that the
+// function and its closures share it. Once the function returns, the upvalue
+// is closed and Value points at a copy the upvalue keeps.
+type Upvalue struct {
+	Value  *Object
+	closed Object
+}
+
+// Close moves the variable off the stack into the upvalue.
+func (u *Upvalue) Close() {
+	u.closed = *u.Value
+	u.Value = &u.closed
+}
+
+// String holds UTF-8 text. Its length, indices, slices and iteration all
+// count Unicode code points, so a flag such as 🇫🇷 or an accent written as a
+// combining mark is more than one character.
 type String struct {
 	Value string
 }
@@ -127,6 +547,9 @@ func (s *String) Equals(other Object) bool {
 
 type Builtin struct {
 	Fn BuiltinFunction
+	// CallFn is set instead of Fn for a builtin that calls the functions
+	// it is passed, which it does through call
+	CallFn func(call CallFunction, args ...Object) Object
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -140,22 +563,151 @@ type Array struct {
 }
 
 func (a *Array) Type() ObjectType { return ARRAY_OBJ }
-func (a *Array) Inspect() string {
-	var out bytes.Buffer
+func (a *Array) Inspect() string  { return inspect(a, nil) }
+
+// Arrays are equal when their elements are equal
+func (a *Array) Equals(other Object) bool { return equals(a, other, nil) }
+
+// Range is the sequence of integers from Start up to End, stepping by Step.
+// It is never materialized: its length, elements and membership are all
+// computed from its bounds.
+type Range struct {
+	Start     int64
+	End       int64
+	Step      int64 // Never zero
+	Inclusive bool  // Whether End itself belongs to the range, if the steps reach it
+}
 
-	elements := []string{}
-	for _, e := range a.Elements {
-		elements = append(elements, e.Inspect())
+// NewRange creates the range from start to end, stepping by step, which is
+// nil when it is omitted. The bounds must be integers, the step must not be
+// zero and the range must be countable.
+func NewRange(start, end, step Object, inclusive bool) (*Range, *Error) {
+	bounds := []Object{start, end}
+	if step != nil {
+		bounds = append(bounds, step)
 	}
 
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
+	values := []int64{}
+	for _, bound := range bounds {
+		integer, ok := bound.(*Integer)
+		if !ok {
+			return nil, NewError(TypeError, "range bounds must be INTEGER, got %s", bound.Type())
+		}
+		values = append(values, integer.Value)
+	}
 
-	return out.String()
+	rng := &Range{Start: values[0], End: values[1], Step: 1, Inclusive: inclusive}
+	if step != nil {
+		if values[2] == 0 {
+			return nil, NewError(ArgumentError, "range step cannot be zero")
+		}
+		rng.Step = values[2]
+	}
+
+	if !rng.Countable() {
+		return nil, NewError(ArgumentError, "range has too many elements: %s", rng.Inspect())
+	}
+
+	return rng, nil
 }
-func (a *Array) Equals(other Object) bool {
-	return a == other
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	op := ".."
+	if r.Inclusive {
+		op = "..="
+	}
+
+	out := fmt.Sprintf("%d%s%d", r.Start, op, r.End)
+	if r.Step != 1 {
+		out += fmt.Sprintf(" by %d", r.Step)
+	}
+
+	return out
+}
+
+// Ranges are equal when they produce the same elements, so 0..3 == 0..=2
+func (r *Range) Equals(other Object) bool {
+	otherRange, ok := other.(*Range)
+	if !ok {
+		return false
+	}
+
+	length := r.Len()
+	switch {
+	case length != otherRange.Len():
+		return false
+	case length == 0:
+		return true
+	case length == 1:
+		return r.Start == otherRange.Start
+	default:
+		return r.Start == otherRange.Start && r.Step == otherRange.Step
+	}
+}
+
+// Countable reports whether the number of elements of the range fits in an
+// int64. Len, At and Contains are only meaningful for countable ranges.
+func (r *Range) Countable() bool {
+	_, ok := r.length()
+	return ok
+}
+
+// Len returns the number of elements of the range.
+func (r *Range) Len() int64 {
+	length, _ := r.length()
+	return length
+}
+
+// length counts the elements of the range, working in uint64 so that the
+// distance between any two int64 bounds can be represented.
+func (r *Range) length() (int64, bool) {
+	var distance, step uint64
+	switch {
+	case r.Step > 0 && r.Start <= r.End:
+		distance, step = uint64(r.End)-uint64(r.Start), uint64(r.Step)
+	case r.Step < 0 && r.Start >= r.End:
+		distance, step = uint64(r.Start)-uint64(r.End), -uint64(r.Step)
+	default:
+		return 0, true
+	}
+
+	if !r.Inclusive {
+		if distance == 0 {
+			return 0, true
+		}
+		distance--
+	}
+
+	// The range holds its start plus one element per whole step taken
+	steps := distance / step
+	if steps >= math.MaxInt64 {
+		return 0, false
+	}
+
+	return int64(steps) + 1, true
+}
+
+// At returns the element at index i, which must be in [0, Len()). The
+// multiplication may wrap around, but the element lies between the bounds,
+// so the wrapped sum is still exact.
+func (r *Range) At(i int64) int64 {
+	return r.Start + i*r.Step
+}
+
+// Contains reports whether n is an element of the range.
+func (r *Range) Contains(n int64) bool {
+	length := r.Len()
+	if length == 0 {
+		return false
+	}
+
+	last := r.At(length - 1)
+	if r.Step > 0 {
+		return n >= r.Start && n <= last && (uint64(n)-uint64(r.Start))%uint64(r.Step) == 0
+	}
+
+	return n <= r.Start && n >= last && (uint64(r.Start)-uint64(n))%-uint64(r.Step) == 0
 }
 
 type HashKey struct {
@@ -203,19 +755,69 @@ type Hashable interface {
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
+func (h *Hash) Inspect() string { return inspect(h, nil) }
+
+func (h *Hash) Equals(other Object) bool { return h == other }
 
-	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+// inspect formats arrays, hashes and structs with their contents, and
+// everything else with Inspect. A container met again within itself is
+// abbreviated to [...], {...} or Name{...} instead of recursing forever.
+func inspect(obj Object, active map[Object]bool) string {
+	switch obj.(type) {
+	case *Array, *Hash, *Struct:
+	default:
+		return obj.Inspect()
 	}
 
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
+	if active[obj] {
+		switch obj := obj.(type) {
+		case *Array:
+			return "[...]"
+		case *Struct:
+			return obj.StructType.Name + "{...}"
+		default:
+			return "{...}"
+		}
+	}
+
+	if active == nil {
+		active = map[Object]bool{}
+	}
+	active[obj] = true
+	defer delete(active, obj)
+
+	var out bytes.Buffer
+
+	switch obj := obj.(type) {
+	case *Array:
+		elements := []string{}
+		for _, e := range obj.Elements {
+			elements = append(elements, inspect(e, active))
+		}
+
+		out.WriteString("[")
+		out.WriteString(strings.Join(elements, ", "))
+		out.WriteString("]")
+	case *Hash:
+		pairs := []string{}
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, fmt.Sprintf("%s: %s", inspect(pair.Key, active), inspect(pair.Value, active)))
+		}
+
+		out.WriteString("{")
+		out.WriteString(strings.Join(pairs, ", "))
+		out.WriteString("}")
+	case *Struct:
+		fields := []string{}
+		for _, name := range obj.StructType.Fields {
+			fields = append(fields, name+": "+inspect(obj.Fields[name], active))
+		}
+
+		out.WriteString(obj.StructType.Name)
+		out.WriteString("{")
+		out.WriteString(strings.Join(fields, ", "))
+		out.WriteString("}")
+	}
 
 	return out.String()
 }
-
-func (h *Hash) Equals(other Object) bool { return h == other }
@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello, World!"}
@@ -52,3 +55,315 @@ func TestBooleanHashKey(t *testing.T) {
 		t.Errorf("booleans with differen content have different hash keys. n1: %t, n2: %t", num1.Value, diff1.Value)
 	}
 }
+
+func TestStructInspectAndEquals(t *testing.T) {
+	point := &StructType{Name: "Point", Fields: []string{"x", "y"}}
+	other := &StructType{Name: "Point", Fields: []string{"x", "y"}}
+
+	p1 := &Struct{StructType: point, Fields: map[string]Object{"x": &Integer{Value: 1}, "y": &Integer{Value: 2}}}
+	p2 := &Struct{StructType: point, Fields: map[string]Object{"x": &Integer{Value: 1}, "y": &Integer{Value: 2}}}
+	p3 := &Struct{StructType: point, Fields: map[string]Object{"x": &Integer{Value: 1}, "y": &Integer{Value: 3}}}
+	p4 := &Struct{StructType: other, Fields: map[string]Object{"x": &Integer{Value: 1}, "y": &Integer{Value: 2}}}
+
+	if p1.Inspect() != "Point{x: 1, y: 2}" {
+		t.Errorf("p1.Inspect() wrong. got=%q", p1.Inspect())
+	}
+	if !p1.Equals(p2) {
+		t.Errorf("structs with equal fields are not equal")
+	}
+	if p1.Equals(p3) {
+		t.Errorf("structs with different fields are equal")
+	}
+	if p1.Equals(p4) {
+		t.Errorf("structs of different struct types are equal")
+	}
+}
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		rng      *Range
+		inspect  string
+		elements []int64
+	}{
+		{&Range{Start: 0, End: 5, Step: 1}, "0..5", []int64{0, 1, 2, 3, 4}},
+		{&Range{Start: 0, End: 5, Step: 1, Inclusive: true}, "0..=5", []int64{0, 1, 2, 3, 4, 5}},
+		{&Range{Start: 0, End: 10, Step: 3}, "0..10 by 3", []int64{0, 3, 6, 9}},
+		{&Range{Start: 0, End: 9, Step: 3, Inclusive: true}, "0..=9 by 3", []int64{0, 3, 6, 9}},
+		{&Range{Start: 5, End: 0, Step: -2}, "5..0 by -2", []int64{5, 3, 1}},
+		{&Range{Start: 5, End: 1, Step: -2, Inclusive: true}, "5..=1 by -2", []int64{5, 3, 1}},
+		{&Range{Start: 5, End: 0, Step: 1}, "5..0", []int64{}},
+		{&Range{Start: 3, End: 3, Step: 1}, "3..3", []int64{}},
+		{&Range{Start: 3, End: 3, Step: 1, Inclusive: true}, "3..=3", []int64{3}},
+		{&Range{Start: 5, End: 0, Step: math.MinInt64}, "5..0 by -9223372036854775808", []int64{5}},
+	}
+
+	for _, tt := range tests {
+		if tt.rng.Inspect() != tt.inspect {
+			t.Errorf("Inspect() wrong. expected=%q, got=%q", tt.inspect, tt.rng.Inspect())
+		}
+
+		if tt.rng.Len() != int64(len(tt.elements)) {
+			t.Errorf("%s: Len() wrong. expected=%d, got=%d", tt.inspect, len(tt.elements), tt.rng.Len())
+			continue
+		}
+
+		members := map[int64]bool{}
+		for i, el := range tt.elements {
+			members[el] = true
+			if tt.rng.At(int64(i)) != el {
+				t.Errorf("%s: At(%d) wrong. expected=%d, got=%d", tt.inspect, i, el, tt.rng.At(int64(i)))
+			}
+		}
+
+		for n := int64(-3); n <= 12; n++ {
+			if tt.rng.Contains(n) != members[n] {
+				t.Errorf("%s: Contains(%d) wrong. expected=%t", tt.inspect, n, members[n])
+			}
+		}
+	}
+}
+
+func TestHugeRange(t *testing.T) {
+	tests := []struct {
+		rng       *Range
+		countable bool
+		length    int64
+		last      int64
+	}{
+		{&Range{Start: 0, End: math.MaxInt64, Step: 1}, true, math.MaxInt64, math.MaxInt64 - 1},
+		{&Range{Start: 0, End: math.MaxInt64, Step: 1, Inclusive: true}, false, 0, 0},
+		{&Range{Start: -math.MaxInt64, End: math.MaxInt64, Step: 1}, false, 0, 0},
+		{&Range{Start: math.MinInt64, End: math.MaxInt64, Step: 1, Inclusive: true}, false, 0, 0},
+		{&Range{Start: -math.MaxInt64, End: math.MaxInt64, Step: 4, Inclusive: true}, true, 1 << 62, math.MaxInt64 - 2},
+		{&Range{Start: math.MaxInt64, End: math.MinInt64, Step: -3}, true, 6148914691236517205, math.MinInt64 + 3},
+		{&Range{Start: math.MinInt64, End: math.MaxInt64, Step: math.MaxInt64, Inclusive: true}, true, 3, math.MaxInt64 - 1},
+	}
+
+	for _, tt := range tests {
+		if tt.rng.Countable() != tt.countable {
+			t.Errorf("%s: Countable() wrong. expected=%t", tt.rng.Inspect(), tt.countable)
+			continue
+		}
+		if !tt.countable {
+			continue
+		}
+
+		if tt.rng.Len() != tt.length {
+			t.Errorf("%s: Len() wrong. expected=%d, got=%d", tt.rng.Inspect(), tt.length, tt.rng.Len())
+			continue
+		}
+		if last := tt.rng.At(tt.length - 1); last != tt.last {
+			t.Errorf("%s: last element wrong. expected=%d, got=%d", tt.rng.Inspect(), tt.last, last)
+		}
+		if !tt.rng.Contains(tt.rng.Start) || !tt.rng.Contains(tt.last) {
+			t.Errorf("%s: does not contain its first and last elements", tt.rng.Inspect())
+		}
+		if tt.rng.Contains(tt.last + 1) {
+			t.Errorf("%s: Contains(%d) wrong. expected=false", tt.rng.Inspect(), tt.last+1)
+		}
+	}
+}
+
+func TestRangeEquals(t *testing.T) {
+	tests := []struct {
+		a, b     *Range
+		expected bool
+	}{
+		{&Range{Start: 0, End: 3, Step: 1}, &Range{Start: 0, End: 2, Step: 1, Inclusive: true}, true},
+		{&Range{Start: 0, End: 10, Step: 3}, &Range{Start: 0, End: 11, Step: 3}, true},
+		{&Range{Start: 5, End: 0, Step: 1}, &Range{Start: 9, End: 1, Step: 1}, true},
+		{&Range{Start: 2, End: 3, Step: 1}, &Range{Start: 2, End: 9, Step: 7}, true},
+		{&Range{Start: 0, End: 3, Step: 1}, &Range{Start: 1, End: 4, Step: 1}, false},
+		{&Range{Start: 0, End: 10, Step: 2}, &Range{Start: 0, End: 5, Step: 1}, false},
+	}
+
+	for _, tt := range tests {
+		if tt.a.Equals(tt.b) != tt.expected {
+			t.Errorf("%s == %s wrong. expected=%t", tt.a.Inspect(), tt.b.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestIterators(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	key := &String{Value: "k"}
+	hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: &Integer{Value: 1}}
+
+	tests := []struct {
+		iterable Iterable
+		expected []string
+	}{
+		{&Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "a"}}}, []string{"1", "a"}},
+		{&Array{Elements: []Object{}}, []string{}},
+		{&String{Value: "h🍇é"}, []string{"h", "🍇", "é"}},
+		{hash, []string{"k"}},
+		{&Range{Start: 5, End: 0, Step: -2}, []string{"5", "3", "1"}},
+	}
+
+	for _, tt := range tests {
+		iter := tt.iterable.Iter()
+
+		for i, expected := range tt.expected {
+			el, ok := iter.Next()
+			if !ok {
+				t.Fatalf("iterator ended after %d elements, expected %d", i, len(tt.expected))
+			}
+			if el.Inspect() != expected {
+				t.Errorf("element %d wrong. expected=%q, got=%q", i, expected, el.Inspect())
+			}
+		}
+
+		for i := 0; i < 2; i++ {
+			if el, ok := iter.Next(); ok {
+				t.Errorf("iterator not exhausted. got=%s", el.Inspect())
+			}
+		}
+	}
+}
+
+func TestFuncIteratorStopsAfterError(t *testing.T) {
+	calls := 0
+	iter := &FuncIterator{Name: "failing", NextFn: func() (Object, bool) {
+		calls++
+		return &Error{Message: "boom"}, true
+	}}
+
+	if el, ok := iter.Next(); !ok || el.(*Error).Message != "boom" {
+		t.Fatalf("expected the error as the first element. got=%v, %t", el, ok)
+	}
+
+	if _, ok := iter.Next(); ok || calls != 1 {
+		t.Errorf("iterator continued after an error. calls=%d", calls)
+	}
+
+	if iter.Iter() != iter {
+		t.Errorf("iter.Iter() is not the iterator itself")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	one := &Integer{Value: 1}
+	two := &Integer{Value: 2}
+	a := &String{Value: "a"}
+	b := &String{Value: "b"}
+	arr := func(elements ...Object) *Array { return &Array{Elements: elements} }
+
+	tests := []struct {
+		a, b     Object
+		expected int
+		ok       bool
+	}{
+		{one, two, -1, true},
+		{two, one, 1, true},
+		{one, &Integer{Value: 1}, 0, true},
+		{a, b, -1, true},
+		{&String{Value: "ab"}, a, 1, true},
+		{arr(one, two), arr(one, two), 0, true},
+		{arr(one), arr(one, two), -1, true},
+		{arr(two), arr(one, two), 1, true},
+		{arr(arr(one), a), arr(arr(one), b), -1, true},
+		{arr(&Boolean{Value: true}, one), arr(&Boolean{Value: true}, two), -1, false},
+		{one, a, 0, false},
+		{&Boolean{Value: true}, &Boolean{Value: false}, 0, false},
+	}
+
+	for i, tt := range tests {
+		c, ok := Compare(tt.a, tt.b)
+		if ok != tt.ok {
+			t.Errorf("tests[%d] - Compare(%s, %s) ok wrong. expected=%t", i, tt.a.Inspect(), tt.b.Inspect(), tt.ok)
+			continue
+		}
+		if ok && sign(c) != tt.expected {
+			t.Errorf("tests[%d] - Compare(%s, %s) wrong. expected=%d, got=%d", i, tt.a.Inspect(), tt.b.Inspect(), tt.expected, c)
+		}
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func TestArrayEquals(t *testing.T) {
+	a := &Array{Elements: []Object{&Integer{Value: 1}, &Array{Elements: []Object{&String{Value: "x"}}}}}
+	b := &Array{Elements: []Object{&Integer{Value: 1}, &Array{Elements: []Object{&String{Value: "x"}}}}}
+	c := &Array{Elements: []Object{&Integer{Value: 1}}}
+
+	if !a.Equals(b) {
+		t.Errorf("arrays with equal elements are not equal")
+	}
+	if a.Equals(c) || c.Equals(a) {
+		t.Errorf("arrays of different lengths are equal")
+	}
+	if a.Equals(&Integer{Value: 1}) {
+		t.Errorf("array is equal to an integer")
+	}
+}
+
+func TestCyclicEqualsAndCompare(t *testing.T) {
+	a := &Array{Elements: []Object{&Integer{Value: 1}}}
+	b := &Array{Elements: []Object{&Integer{Value: 1}}}
+	a.Elements[0], b.Elements[0] = a, b
+
+	if !a.Equals(a) {
+		t.Errorf("cyclic array is not equal to itself")
+	}
+	if a.Equals(b) {
+		t.Errorf("distinct cyclic arrays are equal")
+	}
+	if c, ok := Compare(a, a); !ok || c != 0 {
+		t.Errorf("Compare(a, a) wrong. got=%d, %t", c, ok)
+	}
+	if _, ok := Compare(a, b); ok {
+		t.Errorf("distinct cyclic arrays can be ordered")
+	}
+
+	point := &StructType{Name: "Point", Fields: []string{"x"}}
+	p := &Struct{StructType: point, Fields: map[string]Object{}}
+	q := &Struct{StructType: point, Fields: map[string]Object{}}
+	p.Fields["x"] = &Array{Elements: []Object{p}}
+	q.Fields["x"] = &Array{Elements: []Object{q}}
+
+	if a.Inspect() != "[[...]]" {
+		t.Errorf("a.Inspect() wrong. got=%q", a.Inspect())
+	}
+	if p.Inspect() != "Point{x: [Point{...}]}" {
+		t.Errorf("p.Inspect() wrong. got=%q", p.Inspect())
+	}
+
+	if !p.Equals(p) || p.Equals(q) {
+		t.Errorf("cyclic struct equality wrong. p == p: %t, p == q: %t", p.Equals(p), p.Equals(q))
+	}
+}
+
+func TestMembers(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	if err := SetMember(hash, "keys", &Integer{Value: 1}); err != nil {
+		t.Fatalf("SetMember failed: %s", err.Inspect())
+	}
+
+	// A key hides the method of the same name
+	val, err := GetMember(hash, "keys")
+	if err != nil || !val.Equals(&Integer{Value: 1}) {
+		t.Errorf("wrong value of hash key. got=%v, %v", val, err)
+	}
+
+	if _, err := GetMember(hash, "values"); err != nil {
+		t.Errorf("expected the values method, got=%s", err.Inspect())
+	}
+
+	st := &StructType{Name: "P", Fields: []string{"x"}}
+	instance, _ := st.Construct([]Object{&Integer{Value: 1}}, nil)
+	if err := SetMember(instance, "y", NULL); err == nil || err.Message != "P has no field y" {
+		t.Errorf("wrong error for undeclared field. got=%v", err)
+	}
+	if err := SetMember(&Integer{Value: 1}, "x", NULL); err == nil || err.Kind != TypeError {
+		t.Errorf("wrong error for integer member. got=%v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package object
+
+import "seville/ast"
+
+// Pattern holds a pattern as a constant of a compiled function, for the VM to
+// match values against.
+type Pattern struct {
+	Pattern ast.Pattern
+}
+
+func (p *Pattern) Type() ObjectType         { return PATTERN_OBJ }
+func (p *Pattern) Inspect() string          { return p.Pattern.String() }
+func (p *Pattern) Equals(other Object) bool { return p == other }
+
+// MatchPattern passes each name in pattern to bind along with the part of val
+// it matches, in the order of ast.PatternBindings. The literals and keys in
+// pattern are evaluated with literal, which may return an *Error. If val does
+// not match, it returns a MatchError describing the first mismatch, and any
+// names bound before it should be discarded.
+func MatchPattern(
+	pattern ast.Pattern,
+	val Object,
+	literal func(node ast.Expression) Object,
+	bind func(name string, val Object) Object,
+) *Error {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return nil
+	case *ast.Identifier:
+		bind(pattern.Value, val)
+		return nil
+	case *ast.LiteralPattern:
+		lit := literal(pattern.Value)
+		if err, ok := lit.(*Error); ok {
+			return err
+		}
+		if !lit.Equals(val) {
+			return NewError(MatchError, "pattern %s does not match %s", pattern.String(), val.Inspect())
+		}
+		return nil
+	case *ast.ArrayPattern:
+		return matchArrayPattern(pattern, val, literal, bind)
+	case *ast.HashPattern:
+		return matchHashPattern(pattern, val, literal, bind)
+	default:
+		return NewError(TypeError, "unknown pattern: %s", pattern.String())
+	}
+}
+
+func matchArrayPattern(
+	pattern *ast.ArrayPattern,
+	val Object,
+	literal func(node ast.Expression) Object,
+	bind func(name string, val Object) Object,
+) *Error {
+	array, ok := val.(*Array)
+	if !ok {
+		return NewError(MatchError, "pattern %s expects an array, got %s", pattern.String(), val.Type())
+	}
+
+	got, want := len(array.Elements), len(pattern.Elements)
+	if pattern.Rest == nil && got != want {
+		return NewError(MatchError, "pattern %s expects %d elements, got %d", pattern.String(), want, got)
+	}
+	if got < want {
+		return NewError(MatchError, "pattern %s expects at least %d elements, got %d", pattern.String(), want, got)
+	}
+
+	for i, el := range pattern.Elements {
+		if err := MatchPattern(el, array.Elements[i], literal, bind); err != nil {
+			return err
+		}
+	}
+
+	if pattern.Rest != nil {
+		rest := make([]Object, got-want)
+		copy(rest, array.Elements[want:])
+		bind(pattern.Rest.Value, &Array{Elements: rest})
+	}
+
+	return nil
+}
+
+func matchHashPattern(
+	pattern *ast.HashPattern,
+	val Object,
+	literal func(node ast.Expression) Object,
+	bind func(name string, val Object) Object,
+) *Error {
+	hash, ok := val.(*Hash)
+	if !ok {
+		return NewError(MatchError, "pattern %s expects a hash, got %s", pattern.String(), val.Type())
+	}
+
+	for i, keyNode := range pattern.Keys {
+		key := literal(keyNode)
+		if err, ok := key.(*Error); ok {
+			return err
+		}
+
+		hashable, ok := key.(Hashable)
+		if !ok {
+			return NewError(TypeError, "unusable as hash key: %s", key.Type())
+		}
+
+		pair, ok := hash.Pairs[hashable.HashKey()]
+		if !ok {
+			return NewError(MatchError, "pattern %s expects key %s, which is missing", pattern.String(), key.Inspect())
+		}
+
+		if err := MatchPattern(pattern.Values[i], pair.Value, literal, bind); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -41,6 +41,10 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 		return def.Name
 	case 1:
 		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	case 3:
+		return fmt.Sprintf("%s %d %d %d", def.Name, operands[0], operands[1], operands[2])
 	}
 
 	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
@@ -52,6 +56,73 @@ const (
 	OpConstant Opcode = iota
 	OpAdd
 	OpSubtract
+	OpTrue
+	OpFalse
+	OpJumpNotTruthy
+	OpJump
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpBitNot
+	OpEqual
+	OpNotEqual
+	OpLessThan
+	OpLessThanOrEqual
+	OpGreaterThan
+	OpGreaterThanOrEqual
+	OpPop
+	OpDup
+	OpRotThree
+	OpNull
+	OpMultiply
+	OpDivide
+	OpModulo
+	OpPower
+	OpMinus
+	OpBang
+	OpIn
+	OpGetGlobal
+	OpSetGlobal
+	OpArray
+	OpHash
+	OpIndex
+	OpSlice
+	OpAssignGlobal
+	OpSetIndex
+	OpGetLocal
+	OpSetLocal
+	OpAssignLocal
+	OpGetBuiltin
+	OpClosure
+	OpGetFree
+	OpAssignFree
+	OpCall
+	OpApply
+	OpReturnValue
+	OpJumpIfBound
+	OpThrow
+	OpImport
+	OpGetMember
+	OpSetMember
+	OpStruct
+	OpMatch
+	OpNoMatch
+	OpDestructure
+	OpIter
+	OpIterNext
+	OpAppend
+	OpInsert
+	OpCloseUpvalues
+	OpGenerator
+	OpYield
+	OpJumpNotNull
+	OpJumpNull
+	OpJumpMissingIndex
+	OpJumpMissingMember
+	OpRange
+	OpSpread
 )
 
 type Definition struct {
@@ -63,6 +134,148 @@ var definitions = map[Opcode]*Definition{
 	OpConstant: {"OpConstant", []int{2}},
 	OpAdd:      {"OpAdd", []int{}},
 	OpSubtract: {"OpSubtract", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+	// The operand of a jump is the absolute position of its target
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+	OpBitAnd:        {"OpBitAnd", []int{}},
+	OpBitOr:         {"OpBitOr", []int{}},
+	OpBitXor:        {"OpBitXor", []int{}},
+	OpShiftLeft:     {"OpShiftLeft", []int{}},
+	OpShiftRight:    {"OpShiftRight", []int{}},
+	OpBitNot:        {"OpBitNot", []int{}},
+
+	OpEqual:              {"OpEqual", []int{}},
+	OpNotEqual:           {"OpNotEqual", []int{}},
+	OpLessThan:           {"OpLessThan", []int{}},
+	OpLessThanOrEqual:    {"OpLessThanOrEqual", []int{}},
+	OpGreaterThan:        {"OpGreaterThan", []int{}},
+	OpGreaterThanOrEqual: {"OpGreaterThanOrEqual", []int{}},
+
+	OpPop: {"OpPop", []int{}},
+	OpDup: {"OpDup", []int{}},
+	// Moves the top of the stack below the two elements under it
+	OpRotThree: {"OpRotThree", []int{}},
+	OpNull:     {"OpNull", []int{}},
+
+	OpMultiply: {"OpMultiply", []int{}},
+	OpDivide:   {"OpDivide", []int{}},
+	OpModulo:   {"OpModulo", []int{}},
+	OpPower:    {"OpPower", []int{}},
+	OpMinus:    {"OpMinus", []int{}},
+	OpBang:     {"OpBang", []int{}},
+	OpIn:       {"OpIn", []int{}},
+
+	// The operand of a global is the index of its slot
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+
+	// Builds an array from that many elements, or a hash from that many
+	// keys and values, interleaved
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+	// Pops the start, end and step of a slice, null when omitted, and the
+	// collection under them
+	OpSlice: {"OpSlice", []int{}},
+
+	// Assignments pop the assigned value and push it back once it is
+	// stored. Their last operand is the opcode of the operator a compound
+	// assignment such as += applies first, or 0 for a plain assignment
+	OpAssignGlobal: {"OpAssignGlobal", []int{2, 1}},
+	// Pops the index, the value and the collection under them, in the
+	// order they are evaluated in
+	OpSetIndex: {"OpSetIndex", []int{1}},
+
+	// Local slots hold the names declared in blocks, and live on the stack
+	// of the frame the block runs in
+	OpGetLocal:    {"OpGetLocal", []int{2}},
+	OpSetLocal:    {"OpSetLocal", []int{2}},
+	OpAssignLocal: {"OpAssignLocal", []int{2, 1}},
+
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+	// Wraps the compiled function in the given constant in a closure over
+	// the variables it captures
+	OpClosure:    {"OpClosure", []int{2}},
+	OpGetFree:    {"OpGetFree", []int{1}},
+	OpAssignFree: {"OpAssignFree", []int{1, 1}},
+	// Calls the function under its arguments with the given number of
+	// arguments, all positional
+	OpCall: {"OpCall", []int{1}},
+	// Calls the function under its arguments as OpCall does, where the
+	// constant given by the second operand holds a string for each argument:
+	// empty for a positional argument, ... for a spread one, else the name of
+	// a keyword argument
+	OpApply:       {"OpApply", []int{1, 2}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	// Jumps to its second operand if the parameter in the local slot given by
+	// its first operand was passed an argument, skipping its default value
+	OpJumpIfBound: {"OpJumpIfBound", []int{2, 2}},
+	// Pops a value and raises it as an error, or raises the error of a
+	// caught exception again
+	OpThrow: {"OpThrow", []int{}},
+	// Pushes the module at the path in the given constant, running it first
+	// if it has not been imported yet
+	OpImport: {"OpImport", []int{2}},
+	// Reads the member named by the given constant of the object on top of
+	// the stack
+	OpGetMember: {"OpGetMember", []int{2}},
+	// Pops the value and the object under it, and assigns the member as
+	// OpSetIndex does an element
+	OpSetMember: {"OpSetMember", []int{2, 1}},
+	// Pushes a new struct type with the name and fields of the one in the
+	// given constant
+	OpStruct: {"OpStruct", []int{2}},
+	// Pops a value and matches it against the pattern in the first operand.
+	// If it matches, pushes the values of the names the pattern binds, which
+	// the second operand counts, and otherwise jumps to the third
+	OpMatch: {"OpMatch", []int{2, 2, 2}},
+	// Pops the subject of a match expression that no arm matched and raises
+	// an error
+	OpNoMatch: {"OpNoMatch", []int{}},
+	// Pops a value and matches it against the pattern in the first operand
+	// as OpMatch does, raising an error if it does not match
+	OpDestructure: {"OpDestructure", []int{2, 2}},
+	// Pops a value and pushes an iterator over its elements
+	OpIter: {"OpIter", []int{}},
+	// Pushes the next element of the iterator on top of the stack, or pops
+	// the iterator and jumps to the operand once it is exhausted
+	OpIterNext: {"OpIterNext", []int{2}},
+	// Pops a value and appends it to the array the operand counts down from
+	// the top of the stack
+	OpAppend: {"OpAppend", []int{1}},
+	// Pops a value and the key under it, and sets them in the hash the
+	// operand counts down from the top of the stack
+	OpInsert: {"OpInsert", []int{1}},
+	// Closes the upvalues of the local slots from the operand up, so that
+	// the closures created in one iteration of a loop keep its variables
+	OpCloseUpvalues: {"OpCloseUpvalues", []int{2}},
+	// Ends a call to a generator once its arguments are bound, returning an
+	// iterator that runs the rest of the body, suspended at each yield
+	OpGenerator: {"OpGenerator", []int{}},
+	// Pops a value and suspends the generator, handing the value to the
+	// consumer. The yield evaluates to null once the generator resumes
+	OpYield: {"OpYield", []int{}},
+	// Jumps to the operand if the value on top of the stack is not null,
+	// leaving it there, and otherwise pops it, for the right side of ??
+	OpJumpNotNull: {"OpJumpNotNull", []int{2}},
+	// The jumps out of an optional chain, to the end of the chain given by
+	// their last operand, leave null on the stack in place of the link they
+	// short-circuit. Jumps if the value on top of the stack is null
+	OpJumpNull: {"OpJumpNull", []int{2}},
+	// Jumps if indexing the collection under the index on top of the stack
+	// would fail because the index is absent, popping both
+	OpJumpMissingIndex: {"OpJumpMissingIndex", []int{2}},
+	// Jumps if the object on top of the stack is null or a hash without the
+	// member named by the first operand, popping it
+	OpJumpMissingMember: {"OpJumpMissingMember", []int{2, 2}},
+	// Pops the start, end and step of a range, null when the step is
+	// omitted, and pushes the range. The operand is 1 for an inclusive range
+	OpRange: {"OpRange", []int{1}},
+	// Raises an error unless the value on top of the stack, a spread
+	// argument, is an array, before the call it belongs to is made
+	OpSpread: {"OpSpread", []int{}},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -94,6 +307,8 @@ func Make(op Opcode, operands ...int) []byte {
 		switch width {
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
 		}
 		offset += width
 	}
@@ -109,6 +324,8 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 		switch width {
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
 		}
 
 		offset += width
@@ -120,3 +337,7 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
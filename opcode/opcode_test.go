@@ -10,6 +10,7 @@ func TestMake(t *testing.T) {
 	}{
 		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpAssignGlobal, []int{65534, 255}, []byte{byte(OpAssignGlobal), 255, 254, 255}},
 	}
 
 	for _, tt := range tests {
@@ -33,12 +34,16 @@ func TestInstructionsString(t *testing.T) {
 		Make(OpConstant, 2),
 		Make(OpConstant, 65535),
 		Make(OpAdd),
+		Make(OpAssignGlobal, 1, 0),
+		Make(OpMatch, 2, 1, 65535),
 	}
 
 	expected := `0000 OpConstant 1
 0003 OpConstant 2
 0006 OpConstant 65535
 0009 OpAdd
+0010 OpAssignGlobal 1 0
+0014 OpMatch 2 1 65535
 `
 
 	concatted := Instructions{}
@@ -58,6 +63,9 @@ func TestReadOperands(t *testing.T) {
 		bytesRead int
 	}{
 		{OpConstant, []int{65535}, 2},
+		{OpArray, []int{3}, 2},
+		{OpAssignGlobal, []int{65535, 255}, 3},
+		{OpMatch, []int{1, 2, 65535}, 6},
 	}
 
 	for _, tt := range tests {
@@ -12,9 +12,16 @@ const (
 	_ int = iota // using iota here to give constants incrementing numbers
 	LOWEST
 	ASSIGN      // =
+	TERNARY     // a ? b : c
+	NULLISH     // ??
 	IN          // in
+	BIT_OR      // |
+	BIT_XOR     // ^
+	BIT_AND     // &
 	EQUALS      // ==
 	LESSGREATER // >, <, >=, or <=
+	RANGE       // 0..n
+	SHIFT       // << or >>
 	SUM         // +
 	PRODUCT     // *
 	EXP         // **
@@ -30,15 +37,35 @@ var precedences = map[token.TokenType]int{
 	token.GT:       LESSGREATER,
 	token.LT_OR_EQ: LESSGREATER,
 	token.GT_OR_EQ: LESSGREATER,
+	token.RANGE:    RANGE,
+	token.RANGE_EQ: RANGE,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.PERCENT:  PRODUCT,
 	token.EXP:      EXP,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
 	token.IN:       IN,
 	token.ASSIGN:   ASSIGN,
+	token.NULLISH:  NULLISH,
+	token.QUESTION: TERNARY,
+	token.OPTIONAL: INDEX,
+	token.DOT:      INDEX,
+
+	token.PIPE:      BIT_OR,
+	token.CARET:     BIT_XOR,
+	token.AMPERSAND: BIT_AND,
+	token.LSHIFT:    SHIFT,
+	token.RSHIFT:    SHIFT,
+
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.PERCENT_ASSIGN:  ASSIGN,
+	token.EXP_ASSIGN:      ASSIGN,
 }
 
 type (
@@ -55,10 +82,20 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// Names declared so far in each enclosing function or block scope, mapped
+	// to whether they were declared with const. Used to reject reassigning
+	// constants at parse time, anything not visible here is checked by the
+	// evaluator instead.
+	scopes []map[string]bool
+
+	// The function literals whose bodies are being parsed, innermost last
+	functions []*ast.FunctionLiteral
 }
 
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{l: l, errors: []string{}}
+	p.enterScope()
 
 	// Read two token, so curToken and peekToken are both set
 	p.nextToken()
@@ -69,11 +106,17 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.NULL, p.parseNullLiteral)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
+	p.registerPrefix(token.YIELD, p.parseYieldExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.PIPE, p.parseLambdaLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
@@ -83,17 +126,35 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
-	p.registerInfix(token.LT, p.parseInfixExpression)
-	p.registerInfix(token.GT, p.parseInfixExpression)
-	p.registerInfix(token.LT_OR_EQ, p.parseInfixExpression)
-	p.registerInfix(token.GT_OR_EQ, p.parseInfixExpression)
+	p.registerInfix(token.LT, p.parseComparisonExpression)
+	p.registerInfix(token.GT, p.parseComparisonExpression)
+	p.registerInfix(token.LT_OR_EQ, p.parseComparisonExpression)
+	p.registerInfix(token.GT_OR_EQ, p.parseComparisonExpression)
 	p.registerInfix(token.EXP, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpressions)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 	p.registerInfix(token.IN, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.LSHIFT, p.parseInfixExpression)
+	p.registerInfix(token.RSHIFT, p.parseInfixExpression)
+	p.registerInfix(token.RANGE, p.parseRangeExpression)
+	p.registerInfix(token.RANGE_EQ, p.parseRangeExpression)
+	p.registerInfix(token.NULLISH, p.parseInfixExpression)
+	p.registerInfix(token.OPTIONAL, p.parseOptionalChainExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
+	p.registerInfix(token.QUESTION, p.parseConditionalExpression)
 	p.registerInfix(token.ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.PERCENT_ASSIGN, p.parseAssignmentExpression)
+	p.registerInfix(token.EXP_ASSIGN, p.parseAssignmentExpression)
 
 	return p
 }
@@ -116,6 +177,36 @@ func (p *Parser) nextToken() {
 	p.peekToken = p.l.NextToken()
 }
 
+// parserState is a position in the token stream that the parser can return
+// to, along with the number of errors reported before it.
+type parserState struct {
+	lexer     lexer.Lexer
+	curToken  token.Token
+	peekToken token.Token
+	errors    int
+}
+
+func (p *Parser) save() parserState {
+	return parserState{lexer: *p.l, curToken: p.curToken, peekToken: p.peekToken, errors: len(p.errors)}
+}
+
+// reparse parses the tokens between start and end again with parse, in the
+// scopes that are current now rather than those that were current the first
+// time, then carries on from where the parser is. Errors from the first parse
+// are replaced by those of the second, and errors reported since end are kept.
+func (p *Parser) reparse(start, end parserState, parse func()) {
+	later := append([]string{}, p.errors[end.errors:]...)
+	resume := p.save()
+
+	*p.l, p.curToken, p.peekToken = start.lexer, start.curToken, start.peekToken
+	p.errors = p.errors[:start.errors]
+
+	parse()
+
+	*p.l, p.curToken, p.peekToken = resume.lexer, resume.curToken, resume.peekToken
+	p.errors = append(p.errors, later...)
+}
+
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
@@ -131,10 +222,23 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.STRUCT:
+		return p.parseStructStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
+	case token.FUNCTION:
+		if p.peekTokenIs(token.IDENT) {
+			return p.parseFunctionStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -143,11 +247,24 @@ func (p *Parser) parseStatement() ast.Statement {
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
-	if !p.expectPeek(token.IDENT) {
-		return nil
-	}
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
 
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		stmt.Pattern = p.parsePattern()
+		if stmt.Pattern == nil {
+			return nil
+		}
+
+		if !p.checkDuplicateBindings(stmt.Pattern) {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -157,6 +274,15 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
+	// Declared after parsing the value, which can only see the outer binding
+	for _, name := range stmt.Bindings() {
+		if p.currentScope()[name.Value] {
+			msg := fmt.Sprintf("cannot redeclare constant: %s", name.Value)
+			p.errors = append(p.errors, msg)
+		}
+		p.currentScope()[name.Value] = stmt.IsConst()
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -178,6 +304,160 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseFunctionStatement() *ast.FunctionStatement {
+	stmt := &ast.FunctionStatement{Token: p.curToken}
+	stmt.Name = &ast.Identifier{Token: p.peekToken, Value: p.peekToken.Literal}
+
+	lit, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok || lit == nil {
+		return nil
+	}
+	stmt.Function = lit
+
+	if p.currentScope()[stmt.Name.Value] {
+		msg := fmt.Sprintf("cannot redeclare constant: %s", stmt.Name.Value)
+		p.errors = append(p.errors, msg)
+	}
+	p.currentScope()[stmt.Name.Value] = false
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseStructStatement() *ast.StructStatement {
+	stmt := &ast.StructStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Fields = []*ast.Identifier{}
+	seen := map[string]bool{}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		field := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if seen[field.Value] {
+			msg := fmt.Sprintf("duplicate field %s in struct %s", field.Value, stmt.Name.Value)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		seen[field.Value] = true
+		stmt.Fields = append(stmt.Fields, field)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+
+	if p.currentScope()[stmt.Name.Value] {
+		msg := fmt.Sprintf("cannot redeclare constant: %s", stmt.Name.Value)
+		p.errors = append(p.errors, msg)
+	}
+	p.currentScope()[stmt.Name.Value] = false
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+
+	stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.AS) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Alias = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.currentScope()[stmt.Alias.Value] {
+		msg := fmt.Sprintf("cannot redeclare constant: %s", stmt.Alias.Value)
+		p.errors = append(p.errors, msg)
+	}
+	p.currentScope()[stmt.Alias.Value] = false
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseExportStatement() *ast.ExportStatement {
+	stmt := &ast.ExportStatement{Token: p.curToken}
+
+	if len(p.scopes) != 1 {
+		p.errors = append(p.errors, "export is only allowed at the top level of a module")
+		return nil
+	}
+
+	p.nextToken()
+
+	switch {
+	case p.curTokenIs(token.LET), p.curTokenIs(token.CONST):
+		if let := p.parseLetStatement(); let != nil {
+			stmt.Statement = let
+		}
+	case p.curTokenIs(token.FUNCTION) && p.peekTokenIs(token.IDENT):
+		if fn := p.parseFunctionStatement(); fn != nil {
+			stmt.Statement = fn
+		}
+	case p.curTokenIs(token.STRUCT):
+		if st := p.parseStructStatement(); st != nil {
+			stmt.Statement = st
+		}
+	default:
+		msg := fmt.Sprintf("expected let, const, fn or struct after export, got %s instead", p.curToken.Type)
+		p.errors = append(p.errors, msg)
+	}
+
+	if stmt.Statement == nil {
+		return nil
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	// defer untrace(trace("parseExpression"))
 	prefix := p.prefixParseFns[p.curToken.Type]
@@ -235,6 +515,10 @@ func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
+func (p *Parser) parseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: p.curToken}
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	p.nextToken()
 
@@ -265,7 +549,7 @@ func (p *Parser) parseIfExpression() ast.Expression {
 		return nil
 	}
 
-	expression.Consequence = p.parseBlockStatement()
+	expression.Consequence = p.parseScopedBlockStatement()
 
 	for p.peekTokenIs(token.ELIF) {
 		p.nextToken()
@@ -281,7 +565,7 @@ func (p *Parser) parseIfExpression() ast.Expression {
 			return nil
 		}
 
-		expression.Alternative = p.parseBlockStatement()
+		expression.Alternative = p.parseScopedBlockStatement()
 	}
 
 	return expression
@@ -304,7 +588,7 @@ func (p *Parser) parseElifExpression() *ast.ElifExpression {
 		return nil
 	}
 
-	elif.Consequence = p.parseBlockStatement()
+	elif.Consequence = p.parseScopedBlockStatement()
 
 	return elif
 }
@@ -324,144 +608,618 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	return block
 }
 
-func (p *Parser) parseFunctionLiteral() ast.Expression {
-	lit := &ast.FunctionLiteral{Token: p.curToken}
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
 
-	if !p.expectPeek(token.LPAREN) {
+	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	expression.Body = p.parseScopedBlockStatement()
 
-	if !p.expectPeek(token.LBRACE) {
-		return nil
-	}
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
 
-	lit.Body = p.parseBlockStatement()
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
 
-	return lit
-}
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+			expression.CatchParameter = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
-	if p.peekTokenIs(token.RPAREN) {
-		p.nextToken()
-		return identifiers
-	}
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
 
-	p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+		p.enterScope()
+		if expression.CatchParameter != nil {
+			p.currentScope()[expression.CatchParameter.Value] = false
+		}
+		expression.Catch = p.parseBlockStatement()
+		p.exitScope()
+	}
 
-	for p.peekTokenIs(token.COMMA) {
+	if p.peekTokenIs(token.FINALLY) {
 		p.nextToken()
-		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Finally = p.parseScopedBlockStatement()
 	}
 
-	if !p.expectPeek(token.RPAREN) {
+	if expression.Catch == nil && expression.Finally == nil {
+		p.errors = append(p.errors, "expected catch or finally block after try block")
 		return nil
 	}
 
-	return identifiers
-}
-
-func (p *Parser) parseCallExpressions(function ast.Expression) ast.Expression {
-	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseExpressionList(token.RPAREN)
-	return exp
+	return expression
 }
 
-func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
-	args := []ast.Expression{}
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.curToken}
 
-	if p.peekTokenIs(end) {
-		p.nextToken()
-		return args
+	if !p.expectPeek(token.LPAREN) {
+		return nil
 	}
 
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	expression.Subject = p.parseExpression(LOWEST)
 
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
-		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+	if !p.expectPeek(token.RPAREN) {
+		return nil
 	}
 
-	if !p.expectPeek(end) {
+	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	return args
-}
+	expression.Arms = []*ast.MatchArm{}
 
-func (p *Parser) parseStringLiteral() ast.Expression {
-	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
-}
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
 
-func (p *Parser) curTokenIs(t token.TokenType) bool {
-	return p.curToken.Type == t
-}
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
 
-func (p *Parser) peekTokenIs(t token.TokenType) bool {
-	return p.peekToken.Type == t
-}
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
 
-func (p *Parser) expectPeek(t token.TokenType) bool {
-	if p.peekTokenIs(t) {
-		p.nextToken()
-		return true
-	} else {
-		p.peekError(t)
-		return false
+		if p.peekTokenIs(token.EOF) {
+			p.peekError(token.RBRACE)
+			return nil
+		}
 	}
-}
-
-func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
-	p.prefixParseFns[tokenType] = fn
-}
 
-func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
-	p.infixParseFns[tokenType] = fn
-}
+	p.nextToken()
 
-func (p *Parser) noPrefixparseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found.", t)
-	p.errors = append(p.errors, msg)
+	return expression
 }
 
-func (p *Parser) parsePrefixExpression() ast.Expression {
-	// defer untrace(trace("parsePrefixExpression"))
-
-	expression := &ast.PrefixExpression{
-		Token:    p.curToken,
-		Operator: p.curToken.Literal,
+// parseMatchArm parses pattern [if guard] => body, where the body is either a
+// block or a single expression. The bindings of the pattern are only visible
+// to the guard and body of their own arm.
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	pattern := p.parsePattern()
+	if pattern == nil {
+		return nil
 	}
 
-	p.nextToken()
-	expression.Right = p.parseExpression(PREFIX)
+	p.enterScope()
+	defer p.exitScope()
 
-	return expression
-}
+	if !p.declarePatternBindings(pattern) {
+		return nil
+	}
 
-func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
-	// defer untrace(trace("parseInfixExpression"))
+	var guard ast.Expression
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		guard = p.parseExpression(LOWEST)
+	}
 
-	expression := &ast.InfixExpression{
-		Token:    p.curToken,
-		Operator: p.curToken.Literal,
-		Left:     left,
+	if !p.expectPeek(token.ARROW) {
+		return nil
 	}
 
-	precedence := p.curPrecedence()
+	arm := &ast.MatchArm{Token: p.curToken, Pattern: pattern, Guard: guard}
+
 	p.nextToken()
-	expression.Right = p.parseExpression(precedence)
 
-	return expression
+	if p.curTokenIs(token.LBRACE) {
+		arm.Body = p.parseBlockStatement()
+	} else {
+		arm.Body = p.parseExpression(LOWEST)
+	}
+
+	return arm
+}
+
+// parsePattern parses the pattern starting at curToken: _, a binding name, a
+// literal, or an array or hash of patterns.
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		if p.curToken.Literal == "_" {
+			return &ast.WildcardPattern{Token: p.curToken}
+		}
+		return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	case token.INT, token.STRING, token.TRUE, token.FALSE, token.NULL:
+		return &ast.LiteralPattern{Token: p.curToken, Value: p.prefixParseFns[p.curToken.Type]()}
+	case token.MINUS:
+		if !p.peekTokenIs(token.INT) {
+			break
+		}
+		return &ast.LiteralPattern{Token: p.curToken, Value: p.parsePrefixExpression()}
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	}
+
+	msg := fmt.Sprintf("unexpected %s in pattern", p.curToken.Type)
+	p.errors = append(p.errors, msg)
+	return nil
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.curToken, Elements: []ast.Pattern{}}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+
+			pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+			if !p.peekTokenIs(token.RBRACKET) {
+				msg := fmt.Sprintf("rest pattern ...%s must be the last element", pattern.Rest.Value)
+				p.errors = append(p.errors, msg)
+				return nil
+			}
+			break
+		}
+
+		el := p.parsePattern()
+		if el == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, el)
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+
+	return pattern
+}
+
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.curToken, Keys: []ast.Expression{}, Values: []ast.Pattern{}}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		switch p.curToken.Type {
+		case token.INT, token.STRING, token.TRUE, token.FALSE:
+			pattern.Keys = append(pattern.Keys, p.prefixParseFns[p.curToken.Type]())
+		default:
+			msg := fmt.Sprintf("hash pattern keys must be literals, got %s instead", p.curToken.Type)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+
+		value := p.parsePattern()
+		if value == nil {
+			return nil
+		}
+		pattern.Values = append(pattern.Values, value)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+
+	return pattern
+}
+
+// declarePatternBindings declares the names bound by pattern in the current
+// scope, reporting names that are bound more than once.
+func (p *Parser) declarePatternBindings(pattern ast.Pattern) bool {
+	if !p.checkDuplicateBindings(pattern) {
+		return false
+	}
+
+	for _, ident := range ast.PatternBindings(pattern) {
+		p.currentScope()[ident.Value] = false
+	}
+
+	return true
+}
+
+func (p *Parser) checkDuplicateBindings(pattern ast.Pattern) bool {
+	seen := map[string]bool{}
+
+	for _, ident := range ast.PatternBindings(pattern) {
+		if seen[ident.Value] {
+			msg := fmt.Sprintf("%s is bound more than once in pattern %s", ident.Value, pattern.String())
+			p.errors = append(p.errors, msg)
+			return false
+		}
+		seen[ident.Value] = true
+	}
+
+	return true
+}
+
+// parseScopedBlockStatement parses a block that introduces its own lexical
+// scope, such as the body of an if expression.
+func (p *Parser) parseScopedBlockStatement() *ast.BlockStatement {
+	p.enterScope()
+	defer p.exitScope()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+
+	if p.peekTokenIs(token.IDENT) {
+		p.nextToken()
+		lit.Name = p.curToken.Literal
+	}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.parseFunctionParameters(lit, token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	p.enterFunctionScope(lit)
+	defer p.exitFunctionScope()
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+// parseLambdaLiteral parses the |x, y| x + y shorthand into a function whose
+// body returns the expression after the parameters.
+func (p *Parser) parseLambdaLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.parseFunctionParameters(lit, token.PIPE) {
+		return nil
+	}
+
+	p.nextToken()
+
+	p.enterFunctionScope(lit)
+	defer p.exitFunctionScope()
+
+	ret := &ast.ReturnStatement{
+		Token: token.Token{Type: token.RETURN, Literal: "return", Line: p.curToken.Line, Column: p.curToken.Column},
+	}
+	ret.ReturnValue = p.parseExpression(LOWEST)
+
+	lit.Body = &ast.BlockStatement{Token: ret.Token, Statements: []ast.Statement{ret}}
+
+	return lit
+}
+
+// enterFunctionScope opens the scope of a function body, with its parameters
+// already declared.
+func (p *Parser) enterFunctionScope(lit *ast.FunctionLiteral) {
+	p.enterScope()
+	p.functions = append(p.functions, lit)
+
+	for _, param := range lit.Parameters {
+		p.currentScope()[param.Value] = false
+	}
+	if lit.Rest != nil {
+		p.currentScope()[lit.Rest.Value] = false
+	}
+}
+
+func (p *Parser) exitFunctionScope() {
+	p.exitScope()
+	p.functions = p.functions[:len(p.functions)-1]
+}
+
+// parseYieldExpression parses yield value, which turns the function it
+// appears in into a generator.
+func (p *Parser) parseYieldExpression() ast.Expression {
+	expression := &ast.YieldExpression{Token: p.curToken}
+
+	if len(p.functions) == 0 {
+		p.errors = append(p.errors, "yield outside of a function")
+		return nil
+	}
+	p.functions[len(p.functions)-1].Generator = true
+
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+
+	return expression
+}
+
+// parseFunctionParameters parses a parameter list up to and including the end
+// token, ) for functions and | for lambdas.
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral, end token.TokenType) bool {
+	lit.Parameters = []*ast.Identifier{}
+	lit.Defaults = map[string]ast.Expression{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return true
+	}
+
+	for {
+		p.nextToken()
+
+		if !p.parseFunctionParameter(lit, end) {
+			return false
+		}
+
+		if lit.Rest != nil || !p.peekTokenIs(token.COMMA) {
+			break
+		}
+
+		p.nextToken()
+	}
+
+	return p.expectPeek(end)
+}
+
+// parseFunctionParameter parses a single parameter, one of a, a = 1 or ...a
+func (p *Parser) parseFunctionParameter(lit *ast.FunctionLiteral, end token.TokenType) bool {
+	if p.curTokenIs(token.ELLIPSIS) {
+		if !p.expectPeek(token.IDENT) {
+			return false
+		}
+
+		if !p.checkDuplicateParameter(lit, p.curToken.Literal) {
+			return false
+		}
+
+		lit.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		if !p.peekTokenIs(end) {
+			msg := fmt.Sprintf("rest parameter ...%s must be the last parameter", lit.Rest.Value)
+			p.errors = append(p.errors, msg)
+			return false
+		}
+
+		return true
+	}
+
+	if !p.curTokenIs(token.IDENT) {
+		msg := fmt.Sprintf("expected parameter name, got %s instead", p.curToken.Type)
+		p.errors = append(p.errors, msg)
+		return false
+	}
+
+	if !p.checkDuplicateParameter(lit, p.curToken.Literal) {
+		return false
+	}
+
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.ASSIGN) {
+		p.nextToken()
+		p.nextToken()
+
+		// In a lambda a | ends the parameters rather than being a bitwise
+		// or, so defaults stop before it and looser operators need parentheses
+		precedence := LOWEST
+		if end == token.PIPE {
+			precedence = BIT_OR
+		}
+		lit.Defaults[ident.Value] = p.parseExpression(precedence)
+	} else if len(lit.Defaults) > 0 {
+		msg := fmt.Sprintf("parameter %s without a default follows a parameter with a default", ident.Value)
+		p.errors = append(p.errors, msg)
+		return false
+	}
+
+	lit.Parameters = append(lit.Parameters, ident)
+
+	return true
+}
+
+func (p *Parser) checkDuplicateParameter(lit *ast.FunctionLiteral, name string) bool {
+	for _, param := range lit.Parameters {
+		if param.Value == name {
+			msg := fmt.Sprintf("duplicate parameter name %s", name)
+			p.errors = append(p.errors, msg)
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *Parser) parseCallExpressions(function ast.Expression) ast.Expression {
+	exp := &ast.CallExpression{Token: p.curToken, Function: function}
+	exp.Arguments = p.parseCallArguments()
+	return exp
+}
+
+func (p *Parser) parseCallArguments() []ast.Expression {
+	args := []ast.Expression{}
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return args
+	}
+
+	seenKeyword := false
+	for {
+		p.nextToken()
+
+		arg := p.parseCallArgument()
+		if _, ok := arg.(*ast.KeywordArgument); ok {
+			seenKeyword = true
+		} else if seenKeyword {
+			p.errors = append(p.errors, "positional argument follows keyword argument")
+		}
+		args = append(args, arg)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return args
+}
+
+// parseCallArgument parses a single argument, one of x, ...xs or name = x
+func (p *Parser) parseCallArgument() ast.Expression {
+	switch {
+	case p.curTokenIs(token.ELLIPSIS):
+		spread := &ast.SpreadExpression{Token: p.curToken}
+		p.nextToken()
+		spread.Value = p.parseExpression(LOWEST)
+		return spread
+	case p.curTokenIs(token.IDENT) && p.peekTokenIs(token.ASSIGN):
+		arg := &ast.KeywordArgument{
+			Token: p.curToken,
+			Name:  &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+		}
+		p.nextToken()
+		p.nextToken()
+		arg.Value = p.parseExpression(LOWEST)
+		return arg
+	default:
+		return p.parseExpression(LOWEST)
+	}
+}
+
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	args := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return args
+	}
+
+	p.nextToken()
+	args = append(args, p.parseExpression(LOWEST))
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		args = append(args, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return args
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+func (p *Parser) curTokenIs(t token.TokenType) bool {
+	return p.curToken.Type == t
+}
+
+func (p *Parser) peekTokenIs(t token.TokenType) bool {
+	return p.peekToken.Type == t
+}
+
+func (p *Parser) expectPeek(t token.TokenType) bool {
+	if p.peekTokenIs(t) {
+		p.nextToken()
+		return true
+	} else {
+		p.peekError(t)
+		return false
+	}
+}
+
+func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
+	p.prefixParseFns[tokenType] = fn
+}
+
+func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
+	p.infixParseFns[tokenType] = fn
+}
+
+func (p *Parser) noPrefixparseFnError(t token.TokenType) {
+	msg := fmt.Sprintf("no prefix parse function for %s found.", t)
+	p.errors = append(p.errors, msg)
+}
+
+func (p *Parser) parsePrefixExpression() ast.Expression {
+	// defer untrace(trace("parsePrefixExpression"))
+
+	expression := &ast.PrefixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+	}
+
+	p.nextToken()
+	expression.Right = p.parseExpression(PREFIX)
+
+	return expression
+}
+
+func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
+	// defer untrace(trace("parseInfixExpression"))
+
+	expression := &ast.InfixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Left:     left,
+	}
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+
+	return expression
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -483,29 +1241,282 @@ func (p *Parser) curPrecedence() int {
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 
-	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		array.Elements = []ast.Expression{}
+		return array
+	}
+
+	p.nextToken()
+	start := p.save()
+	first := p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.FOR) {
+		return p.parseArrayComprehension(array.Token, start, p.save())
+	}
+
+	array.Elements = []ast.Expression{first}
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		array.Elements = append(array.Elements, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
 
 	return array
 }
 
+// parseArrayComprehension is called with peekToken on the for token, after
+// the element between start and end has been parsed once. The targets are
+// only known once the clause is parsed, so the element is then parsed again
+// in their scope.
+func (p *Parser) parseArrayComprehension(tok token.Token, start, end parserState) ast.Expression {
+	comprehension := &ast.ArrayComprehension{Token: tok}
+
+	p.enterScope()
+	defer p.exitScope()
+
+	comprehension.Clause = p.parseComprehensionClause()
+	if comprehension.Clause == nil {
+		return nil
+	}
+
+	p.reparse(start, end, func() {
+		comprehension.Element = p.parseExpression(LOWEST)
+	})
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return comprehension
+}
+
+// parseHashComprehension is like parseArrayComprehension, with the key and
+// value pair between start and end.
+func (p *Parser) parseHashComprehension(tok token.Token, start, end parserState) ast.Expression {
+	comprehension := &ast.HashComprehension{Token: tok}
+
+	p.enterScope()
+	defer p.exitScope()
+
+	comprehension.Clause = p.parseComprehensionClause()
+	if comprehension.Clause == nil {
+		return nil
+	}
+
+	p.reparse(start, end, func() {
+		comprehension.Key = p.parseExpression(LOWEST)
+		p.nextToken()
+		p.nextToken()
+		comprehension.Value = p.parseExpression(LOWEST)
+	})
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return comprehension
+}
+
+// parseComprehensionClause parses for target in iterable, followed by an
+// optional if condition, called with peekToken on the for token. Several
+// comma separated targets destructure each element as an array, so
+// for k, v in xs is the same as for [k, v] in xs. The targets are declared in
+// the current scope, which the caller enters for the comprehension.
+func (p *Parser) parseComprehensionClause() *ast.ComprehensionClause {
+	p.nextToken()
+	clause := &ast.ComprehensionClause{Token: p.curToken}
+
+	p.nextToken()
+	targetToken := p.curToken
+	target := p.parsePattern()
+	if target == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.COMMA) {
+		targets := &ast.ArrayPattern{Token: targetToken, Elements: []ast.Pattern{target}}
+
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			p.nextToken()
+
+			el := p.parsePattern()
+			if el == nil {
+				return nil
+			}
+			targets.Elements = append(targets.Elements, el)
+		}
+
+		target = targets
+	}
+	clause.Target = target
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	clause.Iterable = p.parseExpression(LOWEST)
+
+	if !p.declarePatternBindings(target) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		clause.Condition = p.parseExpression(LOWEST)
+	}
+
+	return clause
+}
+
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
 
+	// The start of a slice may be omitted, as in arr[:2]
+	if p.peekTokenIs(token.COLON) {
+		return p.parseSliceExpression(exp.Token, left, nil)
+	}
+
 	p.nextToken()
 	exp.Index = p.parseExpression(LOWEST)
 
+	if p.peekTokenIs(token.COLON) {
+		return p.parseSliceExpression(exp.Token, left, exp.Index)
+	}
+
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
 	return exp
 }
 
+// parseSliceExpression is called with peekToken on the first ':' of the slice.
+func (p *Parser) parseSliceExpression(tok token.Token, left, start ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: start}
+
+	p.nextToken()
+
+	if !p.peekTokenIs(token.COLON) && !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.End = p.parseExpression(LOWEST)
+	}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+
+		if !p.peekTokenIs(token.RBRACKET) {
+			p.nextToken()
+			exp.Step = p.parseExpression(LOWEST)
+		}
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return exp
+}
+
+// parseComparisonExpression parses an ordering comparison. A single
+// comparison is an ordinary infix expression, while further comparisons
+// that follow it, as in a < b < c, form a ComparisonChain.
+func (p *Parser) parseComparisonExpression(left ast.Expression) ast.Expression {
+	first := p.parseInfixExpression(left).(*ast.InfixExpression)
+	if !isOrderingComparison(p.peekToken.Type) {
+		return first
+	}
+
+	chain := &ast.ComparisonChain{
+		Token:     first.Token,
+		Operands:  []ast.Expression{first.Left, first.Right},
+		Operators: []string{first.Operator},
+	}
+
+	for isOrderingComparison(p.peekToken.Type) {
+		p.nextToken()
+		chain.Operators = append(chain.Operators, p.curToken.Literal)
+
+		precedence := p.curPrecedence()
+		p.nextToken()
+		chain.Operands = append(chain.Operands, p.parseExpression(precedence))
+	}
+
+	return chain
+}
+
+func isOrderingComparison(t token.TokenType) bool {
+	return t == token.LT || t == token.GT || t == token.LT_OR_EQ || t == token.GT_OR_EQ
+}
+
+// parseRangeExpression parses start..end and start..=end, followed by an
+// optional by step. by is not a keyword, so it is only taken as the step
+// when it follows the end on the same line.
+func (p *Parser) parseRangeExpression(start ast.Expression) ast.Expression {
+	expression := &ast.RangeExpression{
+		Token:     p.curToken,
+		Start:     start,
+		Inclusive: p.curTokenIs(token.RANGE_EQ),
+	}
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+	expression.End = p.parseExpression(precedence)
+
+	if p.peekTokenIs(token.IDENT) && p.peekToken.Literal == "by" && p.peekToken.Line == p.curToken.Line {
+		p.nextToken()
+		p.nextToken()
+		expression.Step = p.parseExpression(precedence)
+	}
+
+	return expression
+}
+
+// parseConditionalExpression parses cond ? a : b. It is right associative, so
+// a ? b : c ? d : e groups as a ? b : (c ? d : e), and like the consequence
+// the alternative extends as far right as possible, so a ? b : c = 1 assigns
+// to c.
+func (p *Parser) parseConditionalExpression(condition ast.Expression) ast.Expression {
+	expression := &ast.ConditionalExpression{Token: p.curToken, Condition: condition}
+
+	p.nextToken()
+	expression.Consequence = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Alternative = p.parseExpression(LOWEST)
+
+	return expression
+}
+
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.curToken, Object: object}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	exp.Property = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return exp
+}
+
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.curToken}
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
 
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
+		start := p.save()
 		key := p.parseExpression(LOWEST)
 
 		if !p.expectPeek(token.COLON) {
@@ -515,6 +1526,10 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 
+		if len(hash.Pairs) == 0 && p.peekTokenIs(token.FOR) {
+			return p.parseHashComprehension(hash.Token, start, p.save())
+		}
+
 		hash.Pairs[key] = value
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
@@ -535,9 +1550,106 @@ func (p *Parser) parseAssignmentExpression(left ast.Expression) ast.Expression {
 		AssignmentType: p.curToken,
 		Left:           left,
 	}
+
+	if ident, ok := left.(*ast.Identifier); ok && p.isConst(ident.Value) {
+		msg := fmt.Sprintf("cannot assign to constant: %s", ident.Value)
+		p.errors = append(p.errors, msg)
+	}
+	if _, ok := left.(*ast.OptionalChain); ok {
+		msg := fmt.Sprintf("cannot assign to optional chain %s", left.String())
+		p.errors = append(p.errors, msg)
+	}
 	precedence := p.curPrecedence()
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 
 	return expression
 }
+
+func (p *Parser) enterScope() {
+	p.scopes = append(p.scopes, map[string]bool{})
+}
+
+func (p *Parser) exitScope() {
+	p.scopes = p.scopes[:len(p.scopes)-1]
+}
+
+func (p *Parser) currentScope() map[string]bool {
+	return p.scopes[len(p.scopes)-1]
+}
+
+// isConst reports whether the innermost declaration of name seen so far was
+// declared with const.
+func (p *Parser) isConst(name string) bool {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if isConst, ok := p.scopes[i][name]; ok {
+			return isConst
+		}
+	}
+
+	return false
+}
+
+// parseOptionalChainExpression parses a chain of postfix links that starts
+// with an optional one, as in a?.[k][j], a?.b.c or f?.(x)(y), called with
+// curToken on the first ?. token. When an optional link short-circuits, so
+// do all the links after it, so the whole chain is wrapped in an
+// OptionalChain that marks where the short-circuit ends.
+func (p *Parser) parseOptionalChainExpression(left ast.Expression) ast.Expression {
+	chain := &ast.OptionalChain{Token: p.curToken}
+
+	exp := p.parseOptionalLink(left)
+	for exp != nil {
+		switch p.peekToken.Type {
+		case token.LBRACKET:
+			p.nextToken()
+			exp = p.parseIndexExpression(exp)
+		case token.LPAREN:
+			p.nextToken()
+			exp = p.parseCallExpressions(exp)
+		case token.DOT:
+			p.nextToken()
+			exp = p.parseMemberExpression(exp)
+		case token.OPTIONAL:
+			p.nextToken()
+			exp = p.parseOptionalLink(exp)
+		default:
+			chain.Expression = exp
+			return chain
+		}
+	}
+
+	return nil
+}
+
+// parseOptionalLink parses the link after a ?. token, one of ?.[k], ?.[a:b],
+// ?.(x) or ?.name, called with curToken on the ?. token.
+func (p *Parser) parseOptionalLink(left ast.Expression) ast.Expression {
+	switch p.peekToken.Type {
+	case token.LBRACKET:
+		p.nextToken()
+		switch exp := p.parseIndexExpression(left).(type) {
+		case *ast.IndexExpression:
+			exp.Optional = true
+			return exp
+		case *ast.SliceExpression:
+			exp.Optional = true
+			return exp
+		}
+		return nil
+	case token.LPAREN:
+		p.nextToken()
+		exp := p.parseCallExpressions(left).(*ast.CallExpression)
+		exp.Optional = true
+		return exp
+	case token.IDENT:
+		exp := &ast.MemberExpression{Token: p.curToken, Object: left, Optional: true}
+		p.nextToken()
+		exp.Property = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		return exp
+	default:
+		msg := fmt.Sprintf("expected [, ( or a name after ?., got %s instead", p.peekToken.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"seville/ast"
 	"seville/lexer"
+	"strings"
 	"testing"
 )
 
@@ -41,6 +42,141 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedBindings []string
+		expectedString   string
+	}{
+		{"let [a, b] = pair;", []string{"a", "b"}, "let [a, b] = pair;"},
+		{"let [head, ...tail] = arr;", []string{"head", "tail"}, "let [head, ...tail] = arr;"},
+		{`let {"name": n, "age": a} = person;`, []string{"n", "a"}, "let {name: n, age: a} = person;"},
+		{`const [x, [y, _], {"z": z}] = v;`, []string{"x", "y", "z"}, "const [x, [y, _], {z: z}] = v;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.LetStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.Name != nil || stmt.Pattern == nil {
+			t.Fatalf("destructuring let should set Pattern and not Name. got Name=%v, Pattern=%v", stmt.Name, stmt.Pattern)
+		}
+
+		bindings := []string{}
+		for _, ident := range stmt.Bindings() {
+			bindings = append(bindings, ident.Value)
+		}
+
+		if strings.Join(bindings, ",") != strings.Join(tt.expectedBindings, ",") {
+			t.Errorf("wrong bindings. expected=%v, got=%v", tt.expectedBindings, bindings)
+		}
+
+		if stmt.String() != tt.expectedString {
+			t.Errorf("stmt.String() wrong. expected=%q, got=%q", tt.expectedString, stmt.String())
+		}
+	}
+
+	errorTests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"let [a, a] = pair", "a is bound more than once in pattern [a, a]"},
+		{"const [a, b] = pair; let [b] = x", "cannot redeclare constant: b"},
+		{"const [a, b] = pair; a = 2", "cannot assign to constant: a"},
+		{"let [a, b] pair", "expected next token to be =, got IDENT instead"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expectedError {
+			t.Errorf("expected parser error %q, got=%v", tt.expectedError, p.Errors())
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	input := "const x = 5;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+
+	if !stmt.IsConst() {
+		t.Errorf("stmt.IsConst() is false for %q", stmt.String())
+	}
+
+	if stmt.String() != "const x = 5;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+
+	if !testIdentifier(t, stmt.Name, "x") || !testLiteralExpression(t, stmt.Value, 5) {
+		return
+	}
+}
+
+func TestConstReassignmentErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"const x = 1; x = 2", "cannot assign to constant: x"},
+		{"const x = 1; x += 2", "cannot assign to constant: x"},
+		{"const x = 1; let f = fn() { x = 2 }", "cannot assign to constant: x"},
+		{"const x = 1; let x = 2", "cannot redeclare constant: x"},
+		{"const x = 1; const x = 2", "cannot redeclare constant: x"},
+		{"const x = 1; let f = fn() { let x = 2; x = 3 }", ""},
+		{"const x = 1; let f = fn(x) { x = 3 }", ""},
+		{"let x = 1; x = 2; const y = x", ""},
+		{"const x = 1; if (true) { let x = 2; x = 3 }", ""},
+		{"const x = 1; if (true) { let x = 2 }; x = 3", "cannot assign to constant: x"},
+		{"if (true) { const x = 1 } else { let x = 2; x = 3 }", ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if tt.expectedError == "" {
+			if len(errors) != 0 {
+				t.Errorf("unexpected parser errors for %q: %v", tt.input, errors)
+			}
+			continue
+		}
+
+		if len(errors) != 1 {
+			t.Errorf("expected 1 parser error for %q, got=%v", tt.input, errors)
+			continue
+		}
+
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong parser error. expected=%q, got=%q", tt.expectedError, errors[0])
+		}
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("s.TokenLiteral() not 'let'. got=%q", s.TokenLiteral())
@@ -116,6 +252,42 @@ func TestReturnStatements(t *testing.T) {
 	}
 }
 
+func TestThrowStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+		expectedText  string
+	}{
+		{"throw 5;", 5, "throw 5;"},
+		{"raise err", "err", "raise err;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		throwStmt, ok := program.Statements[0].(*ast.ThrowStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ThrowStatement. got=%T", program.Statements[0])
+		}
+
+		if !testLiteralExpression(t, throwStmt.Value, tt.expectedValue) {
+			return
+		}
+
+		if throwStmt.String() != tt.expectedText {
+			t.Errorf("throwStmt.String() wrong. expected=%q, got=%q", tt.expectedText, throwStmt.String())
+		}
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 
@@ -176,6 +348,58 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralBases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0", 0},
+		{"1_000_000", 1000000},
+		{"0xff", 255},
+		{"0XFF", 255},
+		{"0xdead_beef", 0xdeadbeef},
+		{"0o17", 15},
+		{"0O7_7", 63},
+		{"0b1010", 10},
+		{"0B1111_0000", 240},
+		{"0x_1f", 31},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value wrong for %q. expected=%d, got=%d", tt.input, tt.expected, literal.Value)
+		}
+		if literal.TokenLiteral() != tt.input {
+			t.Errorf("literal.TokenLiteral wrong. expected=%q, got=%q", tt.input, literal.TokenLiteral())
+		}
+	}
+}
+
+func TestInvalidIntegerLiterals(t *testing.T) {
+	tests := []string{"1__000", "1_", "0x", "0b102", "0o8", "9223372036854775808"}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		expected := fmt.Sprintf("could not parse %q as integer", input)
+		if len(p.Errors()) == 0 || p.Errors()[0] != expected {
+			t.Errorf("expected parser error %q, got=%v", expected, p.Errors())
+		}
+	}
+}
+
 func TestBooleanLiteralExpression(t *testing.T) {
 	tests := []struct {
 		input            string
@@ -352,6 +576,133 @@ func testIdentifier(t *testing.T, exp ast.Expression, value string) bool {
 	return true
 }
 
+func TestNullLiteralExpression(t *testing.T) {
+	input := "null;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.NullLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.NullLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.TokenLiteral() != "null" {
+		t.Errorf("literal.TokenLiteral not %q. got=%q", "null", literal.TokenLiteral())
+	}
+}
+
+func TestParsingOptionalChaining(t *testing.T) {
+	input := "a?.[1]; f?.(x); a?.b"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	link := func(i int) ast.Expression {
+		chain, ok := program.Statements[i].(*ast.ExpressionStatement).Expression.(*ast.OptionalChain)
+		if !ok {
+			t.Fatalf("exp not *ast.OptionalChain. got=%T", program.Statements[i].(*ast.ExpressionStatement).Expression)
+		}
+		return chain.Expression
+	}
+
+	indexExp, ok := link(0).(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", link(0))
+	}
+	if !indexExp.Optional {
+		t.Errorf("indexExp.Optional is false")
+	}
+	if !testIdentifier(t, indexExp.Left, "a") || !testIntegerLiteral(t, indexExp.Index, 1) {
+		return
+	}
+
+	callExp, ok := link(1).(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.CallExpression. got=%T", link(1))
+	}
+	if !callExp.Optional {
+		t.Errorf("callExp.Optional is false")
+	}
+	if !testIdentifier(t, callExp.Function, "f") || !testIdentifier(t, callExp.Arguments[0], "x") {
+		return
+	}
+
+	memberExp, ok := link(2).(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.MemberExpression. got=%T", link(2))
+	}
+	if !memberExp.Optional {
+		t.Errorf("memberExp.Optional is false")
+	}
+	if !testIdentifier(t, memberExp.Object, "a") || !testIdentifier(t, memberExp.Property, "b") {
+		return
+	}
+
+	errorTests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"a?.1", "expected [, ( or a name after ?., got INT instead"},
+		{"a?.[k] = 1", "cannot assign to optional chain (a?.[k])"},
+		{"a?.b.c += 1", "cannot assign to optional chain ((a?.b).c)"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expectedError {
+			t.Errorf("expected parser error %q, got=%v", tt.expectedError, p.Errors())
+		}
+	}
+}
+
+func TestParsingOptionalChainExtent(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a?.[k][j]", "((a?.[k])[j])"},
+		{"a?.b.c(1)[2]", "(((a?.b).c)(1)[2])"},
+		{"a?.[k]?.(x).y", "((a?.[k])?.(x).y)"},
+		{"a?.b + c.d", "((a?.b) + (c.d))"},
+		{"-a?.b[0]", "(-((a?.b)[0]))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong parse of %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	// The chain ends at the first token that is not a postfix link, so only
+	// the left operand of + is short-circuited
+	l := lexer.New("a?.b.c + d")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	infix, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.InfixExpression. got=%T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+	if _, ok := infix.Left.(*ast.OptionalChain); !ok {
+		t.Errorf("infix.Left not *ast.OptionalChain. got=%T", infix.Left)
+	}
+}
+
 func TestParsingInfixExpressions(t *testing.T) {
 	infixTests := []struct {
 		input      string
@@ -537,62 +888,190 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"1 == 1 in [1, 2, 3, true]",
 			"((1 == 1) in [1, 2, 3, true])",
 		},
-	}
-
-	for _, tt := range tests {
-		l := lexer.New(tt.input)
-		p := New(l)
-		program := p.ParseProgram()
-		checkParserErrors(t, p)
-
-		actual := program.String()
-		if actual != tt.expected {
-			t.Errorf("expected=%q, got=%q", tt.expected, actual)
-		}
-	}
-}
-
-func TestIfExpression(t *testing.T) {
-	input := `if (x < y) { x }`
-
-	l := lexer.New(input)
-	p := New(l)
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
-
-	if len(program.Statements) != 1 {
-		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
-			1, len(program.Statements))
-	}
-
-	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
-	if !ok {
-		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
-			program.Statements[0])
-	}
-
-	exp, ok := stmt.Expression.(*ast.IfExpression)
-	if !ok {
-		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T",
-			stmt.Expression)
-	}
-
-	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
-		return
-	}
-
-	if len(exp.Consequence.Statements) != 1 {
-		t.Errorf("consequence is not 1 statements. got=%d\n",
-			len(exp.Consequence.Statements))
-	}
-
-	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
-	if !ok {
-		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
-			exp.Consequence.Statements[0])
-	}
-
-	if !testIdentifier(t, consequence.Expression, "x") {
+		{
+			"a % b * c",
+			"((a % b) * c)",
+		},
+		{
+			"x += 2 * 3",
+			"x += (2 * 3)",
+		},
+		{
+			"counts[k] **= 1 + 1",
+			"(counts[k]) **= (1 + 1)",
+		},
+		{
+			"a ?? b + c",
+			"(a ?? (b + c))",
+		},
+		{
+			"x = a ?? b ?? null",
+			"x = ((a ?? b) ?? null)",
+		},
+		{
+			"a == null ?? true",
+			"((a == null) ?? true)",
+		},
+		{
+			"a < b < c",
+			"(a < b < c)",
+		},
+		{
+			"1 <= x + 1 < y * 2 >= z",
+			"(1 <= (x + 1) < (y * 2) >= z)",
+		},
+		{
+			"a < b < c == d < e",
+			"((a < b < c) == (d < e))",
+		},
+		{
+			"a == b == c",
+			"((a == b) == c)",
+		},
+		{
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"a & b == c",
+			"(a & (b == c))",
+		},
+		{
+			"1 << 2 + 3 < x >> 1",
+			"((1 << (2 + 3)) < (x >> 1))",
+		},
+		{
+			"~a & -b",
+			"((~a) & (-b))",
+		},
+		{
+			"x = a | b ?? c",
+			"x = ((a | b) ?? c)",
+		},
+		{
+			"0..1 << n",
+			"(0..(1 << n))",
+		},
+		{
+			"0..n + 1",
+			"(0..(n + 1))",
+		},
+		{
+			"x in 0..=n by 2 * k",
+			"(x in (0..=n by (2 * k)))",
+		},
+		{
+			"a..b == c..d",
+			"((a..b) == (c..d))",
+		},
+		{
+			"0..n[1]",
+			"(0..(n[1]))",
+		},
+		{
+			"(0..n)[1]",
+			"((0..n)[1])",
+		},
+		{
+			"a ? b : c ? d : e",
+			"(a ? b : (c ? d : e))",
+		},
+		{
+			"a ? b ? c : d : e",
+			"(a ? (b ? c : d) : e)",
+		},
+		{
+			"x = a > b ? a + 1 : b * 2",
+			"x = ((a > b) ? (a + 1) : (b * 2))",
+		},
+		{
+			"a ?? b ? c : d ?? e",
+			"((a ?? b) ? c : (d ?? e))",
+		},
+		{
+			`h?.["k"]?.[0] ?? f?.(1, 2)`,
+			`(((h?.[k])?.[0]) ?? f?.(1, 2))`,
+		},
+		{
+			"a?.[1:]",
+			"(a?.[1:])",
+		},
+		{
+			"a[1:b + 1] + s[::-1]",
+			"((a[1:(b + 1)]) + (s[::(-1)]))",
+		},
+		{
+			"person.age += a.b.c",
+			"(person.age) += ((a.b).c)",
+		},
+		{
+			"m.f(1) + m.x[0] * -m.y",
+			"((m.f)(1) + (((m.x)[0]) * (-(m.y))))",
+		},
+		{
+			"map(xs, |x| x * 2 + 1)",
+			"map(xs, |x| ((x * 2) + 1))",
+		},
+		{
+			"|a, b = 2| |c| a + b + c",
+			"|a, b = 2| |c| ((a + b) + c)",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestIfExpression(t *testing.T) {
+	input := `if (x < y) { x }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Consequence.Statements) != 1 {
+		t.Errorf("consequence is not 1 statements. got=%d\n",
+			len(exp.Consequence.Statements))
+	}
+
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Consequence.Statements[0])
+	}
+
+	if !testIdentifier(t, consequence.Expression, "x") {
 		return
 	}
 
@@ -740,19 +1219,517 @@ func TestIfElifElseExpression(t *testing.T) {
 			len(exp.Alternative.Statements))
 	}
 
-	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
-	if !ok {
-		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
-			exp.Alternative.Statements[0])
-	}
+	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Alternative.Statements[0])
+	}
+
+	if !testIdentifier(t, alternative.Expression, "y") {
+		return
+	}
+}
+
+func TestComparisonChain(t *testing.T) {
+	input := "a < b <= c"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	chain, ok := stmt.Expression.(*ast.ComparisonChain)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.ComparisonChain. got=%T", stmt.Expression)
+	}
+
+	if len(chain.Operands) != 3 {
+		t.Fatalf("chain.Operands does not contain 3 operands. got=%d", len(chain.Operands))
+	}
+	for i, name := range []string{"a", "b", "c"} {
+		testIdentifier(t, chain.Operands[i], name)
+	}
+
+	if strings.Join(chain.Operators, " ") != "< <=" {
+		t.Errorf("chain.Operators wrong. got=%v", chain.Operators)
+	}
+
+	// A single comparison is still an ordinary infix expression
+	l = lexer.New("a < b")
+	p = New(l)
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt = program.Statements[0].(*ast.ExpressionStatement)
+	testInfixExpression(t, stmt.Expression, "a", "<", "b")
+}
+
+func TestConditionalExpression(t *testing.T) {
+	input := `x < y ? x : y`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.ConditionalExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.ConditionalExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if !testIdentifier(t, exp.Consequence, "x") {
+		return
+	}
+
+	if !testIdentifier(t, exp.Alternative, "y") {
+		return
+	}
+}
+
+func TestConditionalExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"a ? b", "expected next token to be :, got EOF instead"},
+		{"a ? b c", "expected next token to be :, got IDENT instead"},
+		{"a ? : c", "no prefix parse function for : found."},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expectedError {
+			t.Errorf("expected parser error %q, got=%v", tt.expectedError, p.Errors())
+		}
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedParam    string
+		expectedCatch    bool
+		expectedFinally  bool
+		expectedAsString string
+	}{
+		{
+			"try { x } catch (e) { y }",
+			"e", true, false,
+			"try { x } catch (e) { y }",
+		},
+		{
+			"try { x } catch { y }",
+			"", true, false,
+			"try { x } catch { y }",
+		},
+		{
+			"try { x } finally { z }",
+			"", false, true,
+			"try { x } finally { z }",
+		},
+		{
+			"try { x } catch (err) { y } finally { z }",
+			"err", true, true,
+			"try { x } catch (err) { y } finally { z }",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not *ast.TryExpression. got=%T", stmt.Expression)
+		}
+
+		if len(exp.Body.Statements) != 1 {
+			t.Errorf("body is not 1 statements. got=%d", len(exp.Body.Statements))
+		}
+
+		if tt.expectedParam == "" && exp.CatchParameter != nil {
+			t.Errorf("exp.CatchParameter is not nil. got=%s", exp.CatchParameter)
+		}
+		if tt.expectedParam != "" && !testIdentifier(t, exp.CatchParameter, tt.expectedParam) {
+			return
+		}
+
+		if (exp.Catch != nil) != tt.expectedCatch {
+			t.Errorf("exp.Catch wrong. expected present=%t, got=%+v", tt.expectedCatch, exp.Catch)
+		}
+
+		if (exp.Finally != nil) != tt.expectedFinally {
+			t.Errorf("exp.Finally wrong. expected present=%t, got=%+v", tt.expectedFinally, exp.Finally)
+		}
+
+		if exp.String() != tt.expectedAsString {
+			t.Errorf("exp.String() wrong. expected=%q, got=%q", tt.expectedAsString, exp.String())
+		}
+	}
+
+	l := lexer.New("try { x }")
+	p := New(l)
+	p.ParseProgram()
+
+	expectedError := "expected catch or finally block after try block"
+	if len(p.Errors()) != 1 || p.Errors()[0] != expectedError {
+		t.Errorf("expected parser error %q, got=%v", expectedError, p.Errors())
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match (v) {
+		1 => "one",
+		-1 => "minus one"
+		"s" => { let y = 2; y }
+		[a, [b, _], ...rest] if a > b => a + b,
+		{"k": v, 2: true} => v,
+		null => 0,
+		_ => x
+	}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+	}
+
+	testIdentifier(t, exp.Subject, "v")
+
+	expectedArms := []struct {
+		pattern string
+		guard   string
+		body    string
+	}{
+		{"1", "", "one"},
+		{"(-1)", "", "minus one"},
+		{"s", "", "let y = 2;y"},
+		{"[a, [b, _], ...rest]", "(a > b)", "(a + b)"},
+		{"{k: v, 2: true}", "", "v"},
+		{"null", "", "0"},
+		{"_", "", "x"},
+	}
+
+	if len(exp.Arms) != len(expectedArms) {
+		t.Fatalf("wrong number of arms. expected=%d, got=%d", len(expectedArms), len(exp.Arms))
+	}
+
+	for i, expected := range expectedArms {
+		arm := exp.Arms[i]
+		if arm.Pattern.String() != expected.pattern {
+			t.Errorf("arms[%d] pattern wrong. expected=%q, got=%q", i, expected.pattern, arm.Pattern.String())
+		}
+		guard := ""
+		if arm.Guard != nil {
+			guard = arm.Guard.String()
+		}
+		if guard != expected.guard {
+			t.Errorf("arms[%d] guard wrong. expected=%q, got=%q", i, expected.guard, guard)
+		}
+		if arm.Body.String() != expected.body {
+			t.Errorf("arms[%d] body wrong. expected=%q, got=%q", i, expected.body, arm.Body.String())
+		}
+	}
+
+	if _, ok := exp.Arms[3].Pattern.(*ast.ArrayPattern); !ok {
+		t.Errorf("arms[3] pattern is not *ast.ArrayPattern. got=%T", exp.Arms[3].Pattern)
+	}
+	if _, ok := exp.Arms[6].Pattern.(*ast.WildcardPattern); !ok {
+		t.Errorf("arms[6] pattern is not *ast.WildcardPattern. got=%T", exp.Arms[6].Pattern)
+	}
+
+	expectedString := "match (v) { [x, _] if (x > 0) => x, _ => { 0 } }"
+	l = lexer.New("match (v) { [x, _] if x > 0 => x, _ => { 0 } }")
+	p = New(l)
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if program.String() != expectedString {
+		t.Errorf("program.String() wrong. expected=%q, got=%q", expectedString, program.String())
+	}
+}
+
+func TestMatchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"match (v) { [a, a] => 1 }", "a is bound more than once in pattern [a, a]"},
+		{"match (v) { [...rest, a] => 1 }", "rest pattern ...rest must be the last element"},
+		{"match (v) { {k: 1} => 1 }", "hash pattern keys must be literals, got IDENT instead"},
+		{"match (v) { a + 1 => 1 }", "expected next token to be =>, got + instead"},
+		{"match (v) { fn() {} => 1 }", "unexpected FUNCTION in pattern"},
+		{"match (v) { 1 => 2", "expected next token to be }, got EOF instead"},
+		{"const c = 1; match (v) { c => c = 2 }", ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if tt.expectedError == "" {
+			checkParserErrors(t, p)
+			continue
+		}
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expectedError {
+			t.Errorf("expected parser error %q, got=%v", tt.expectedError, p.Errors())
+		}
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	input := `fn(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d\n",
+			len(function.Parameters))
+	}
+
+	testLiteralExpression(t, function.Parameters[0], "x")
+	testLiteralExpression(t, function.Parameters[1], "y")
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n",
+			len(function.Body.Statements))
+	}
+
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T",
+			function.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{input: "fn() {};", expectedParams: []string{}},
+		{input: "fn(x) {};", expectedParams: []string{"x"}},
+		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d\n",
+				len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+	}
+}
+
+func TestStructStatements(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedName   string
+		expectedFields []string
+		expectedString string
+	}{
+		{"struct Point { x, y }", "Point", []string{"x", "y"}, "struct Point { x, y }"},
+		{"struct Empty {}", "Empty", []string{}, "struct Empty {}"},
+		{"struct User { name, email, }", "User", []string{"name", "email"}, "struct User { name, email }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.StructStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.StructStatement. got=%T", program.Statements[0])
+		}
+
+		testIdentifier(t, stmt.Name, tt.expectedName)
+
+		if len(stmt.Fields) != len(tt.expectedFields) {
+			t.Fatalf("wrong number of fields. expected=%d, got=%d", len(tt.expectedFields), len(stmt.Fields))
+		}
+
+		for i, field := range tt.expectedFields {
+			testIdentifier(t, stmt.Fields[i], field)
+		}
+
+		if stmt.String() != tt.expectedString {
+			t.Errorf("stmt.String() wrong. expected=%q, got=%q", tt.expectedString, stmt.String())
+		}
+	}
+
+	errorTests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"struct Point { x, x }", "duplicate field x in struct Point"},
+		{"struct Point { x y }", "expected next token to be ,, got IDENT instead"},
+		{"struct { x }", "expected next token to be IDENT, got { instead"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expectedError {
+			t.Errorf("expected parser error %q, got=%v", tt.expectedError, p.Errors())
+		}
+	}
+}
+
+func TestImportStatements(t *testing.T) {
+	input := `import "lib/math.sv" as math;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ImportStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.Path.Value != "lib/math.sv" {
+		t.Errorf("stmt.Path.Value is not %q. got=%q", "lib/math.sv", stmt.Path.Value)
+	}
+
+	testIdentifier(t, stmt.Alias, "math")
+
+	expected := `import "lib/math.sv" as math`
+	if stmt.String() != expected {
+		t.Errorf("stmt.String() wrong. expected=%q, got=%q", expected, stmt.String())
+	}
+}
+
+func TestExportStatements(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedName   string
+		expectedString string
+	}{
+		{"export let x = 1;", "x", "export let x = 1;"},
+		{"export const y = 2;", "y", "export const y = 2;"},
+		{"export fn f(a) { a }", "f", "export fn f(a) a"},
+		{"export struct P { x }", "P", "export struct P { x }"},
+		{"export let [a, b] = pair;", "a,b", "export let [a, b] = pair;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExportStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.ExportStatement. got=%T", program.Statements[0])
+		}
+
+		if strings.Join(stmt.Names(), ",") != tt.expectedName {
+			t.Errorf("stmt.Names() is not %q. got=%v", tt.expectedName, stmt.Names())
+		}
+
+		if stmt.String() != tt.expectedString {
+			t.Errorf("stmt.String() wrong. expected=%q, got=%q", tt.expectedString, stmt.String())
+		}
+	}
+}
+
+func TestModuleParsingErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"export 1", "expected let, const, fn or struct after export, got INT instead"},
+		{"fn f() { export let x = 1 }", "export is only allowed at the top level of a module"},
+		{`import "a.sv"`, "expected next token to be AS, got EOF instead"},
+		{`import a as b`, "expected next token to be STRING, got IDENT instead"},
+		{`const m = 1; import "m.sv" as m`, "cannot redeclare constant: m"},
+		{"m.1", "expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
 
-	if !testIdentifier(t, alternative.Expression, "y") {
-		return
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expectedError {
+			t.Errorf("expected parser error %q, got=%v", tt.expectedError, p.Errors())
+		}
 	}
 }
 
-func TestFunctionLiteralParsing(t *testing.T) {
-	input := `fn(x, y) { x + y; }`
+func TestFunctionStatementParsing(t *testing.T) {
+	input := "fn add(x, y) { x + y }"
 
 	l := lexer.New(input)
 	p := New(l)
@@ -760,52 +1737,54 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	checkParserErrors(t, p)
 
 	if len(program.Statements) != 1 {
-		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
-			1, len(program.Statements))
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
 	}
 
-	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	stmt, ok := program.Statements[0].(*ast.FunctionStatement)
 	if !ok {
-		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
-			program.Statements[0])
+		t.Fatalf("program.Statements[0] is not *ast.FunctionStatement. got=%T", program.Statements[0])
 	}
 
-	function, ok := stmt.Expression.(*ast.FunctionLiteral)
-	if !ok {
-		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T",
-			stmt.Expression)
+	if !testIdentifier(t, stmt.Name, "add") {
+		return
 	}
 
-	if len(function.Parameters) != 2 {
-		t.Fatalf("function literal parameters wrong. want 2, got=%d\n",
-			len(function.Parameters))
+	if stmt.Function.Name != "add" {
+		t.Errorf("stmt.Function.Name is not %q. got=%q", "add", stmt.Function.Name)
 	}
 
-	testLiteralExpression(t, function.Parameters[0], "x")
-	testLiteralExpression(t, function.Parameters[1], "y")
-
-	if len(function.Body.Statements) != 1 {
-		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n",
-			len(function.Body.Statements))
+	if len(stmt.Function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d", len(stmt.Function.Parameters))
 	}
 
-	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
-	if !ok {
-		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T",
-			function.Body.Statements[0])
+	expected := "fn add(x, y) (x + y)"
+	if stmt.String() != expected {
+		t.Errorf("stmt.String() wrong. expected=%q, got=%q", expected, stmt.String())
 	}
 
-	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+	l = lexer.New("const f = 1; fn f() { 2 }")
+	p = New(l)
+	p.ParseProgram()
+
+	expectedError := "cannot redeclare constant: f"
+	if len(p.Errors()) != 1 || p.Errors()[0] != expectedError {
+		t.Errorf("expected parser error %q, got=%v", expectedError, p.Errors())
+	}
 }
 
-func TestFunctionParameterParsing(t *testing.T) {
+func TestLambdaLiteralParsing(t *testing.T) {
 	tests := []struct {
 		input          string
 		expectedParams []string
+		expectedRest   string
+		expectedBody   string
+		expectedString string
 	}{
-		{input: "fn() {};", expectedParams: []string{}},
-		{input: "fn(x) {};", expectedParams: []string{"x"}},
-		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+		{"|x| x * 2", []string{"x"}, "", "(x * 2)", "|x| (x * 2)"},
+		{"|| 42", []string{}, "", "42", "|| 42"},
+		{"|a, ...rest| rest", []string{"a"}, "rest", "rest", "|a, ...rest| rest"},
+		{"|x| fn(y) { x + y }", []string{"x"}, "", "fn(y) (x + y)", "|x| fn(y) (x + y)"},
+		{"|a, b = 1 << 2| a | b", []string{"a", "b"}, "", "(a | b)", "|a, b = (1 << 2)| (a | b)"},
 	}
 
 	for _, tt := range tests {
@@ -815,16 +1794,147 @@ func TestFunctionParameterParsing(t *testing.T) {
 		checkParserErrors(t, p)
 
 		stmt := program.Statements[0].(*ast.ExpressionStatement)
-		function := stmt.Expression.(*ast.FunctionLiteral)
+		function, ok := stmt.Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+		}
+
+		if !function.IsLambda() {
+			t.Errorf("function.IsLambda() is false for %q", tt.input)
+		}
 
 		if len(function.Parameters) != len(tt.expectedParams) {
-			t.Errorf("length parameters wrong. want %d, got=%d\n",
-				len(tt.expectedParams), len(function.Parameters))
+			t.Errorf("length parameters wrong. want %d, got=%d", len(tt.expectedParams), len(function.Parameters))
 		}
 
 		for i, ident := range tt.expectedParams {
 			testLiteralExpression(t, function.Parameters[i], ident)
 		}
+
+		if tt.expectedRest != "" {
+			testIdentifier(t, function.Rest, tt.expectedRest)
+		}
+
+		if len(function.Body.Statements) != 1 {
+			t.Fatalf("function.Body.Statements has not 1 statements. got=%d", len(function.Body.Statements))
+		}
+
+		ret, ok := function.Body.Statements[0].(*ast.ReturnStatement)
+		if !ok {
+			t.Fatalf("body stmt is not ast.ReturnStatement. got=%T", function.Body.Statements[0])
+		}
+
+		if ret.ReturnValue.String() != tt.expectedBody {
+			t.Errorf("body is not %q. got=%q", tt.expectedBody, ret.ReturnValue.String())
+		}
+
+		if function.String() != tt.expectedString {
+			t.Errorf("function.String() wrong. expected=%q, got=%q", tt.expectedString, function.String())
+		}
+	}
+}
+
+func TestYieldExpressions(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  string
+		generator bool
+	}{
+		{"fn() { yield x + 1 }", "fn() yield (x + 1)", true},
+		{"|x| yield x", "|x| yield x", true},
+		{"fn() { return 1 }", "fn() return 1;", false},
+		{"fn() { [yield x for x in xs] }", "fn() [yield x for x in xs]", true},
+		// Only the innermost function becomes a generator
+		{"fn() { fn() { yield 1 } }", "fn() fn() yield 1", false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function, ok := stmt.Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+		}
+
+		if function.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, function.String())
+		}
+
+		if function.Generator != tt.generator {
+			t.Errorf("function.Generator wrong for %q. got=%t", tt.input, function.Generator)
+		}
+	}
+
+	l := lexer.New("yield 1")
+	p := New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 || p.Errors()[0] != "yield outside of a function" {
+		t.Errorf("expected parser error for yield outside of a function, got=%v", p.Errors())
+	}
+}
+
+func TestFunctionDefaultAndRestParameterParsing(t *testing.T) {
+	input := "fn(a, b = 2, c = a + 1, ...rest) { a };"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function := stmt.Expression.(*ast.FunctionLiteral)
+
+	if len(function.Parameters) != 3 {
+		t.Fatalf("length parameters wrong. want 3, got=%d", len(function.Parameters))
+	}
+
+	testLiteralExpression(t, function.Parameters[0], "a")
+	testLiteralExpression(t, function.Parameters[1], "b")
+	testLiteralExpression(t, function.Parameters[2], "c")
+
+	if _, ok := function.Defaults["a"]; ok {
+		t.Errorf("parameter a should not have a default")
+	}
+	testLiteralExpression(t, function.Defaults["b"], 2)
+	testInfixExpression(t, function.Defaults["c"], "a", "+", 1)
+
+	if !testIdentifier(t, function.Rest, "rest") {
+		return
+	}
+
+	expected := "fn(a, b = 2, c = (a + 1), ...rest) a"
+	if function.String() != expected {
+		t.Errorf("function.String() wrong. expected=%q, got=%q", expected, function.String())
+	}
+}
+
+func TestFunctionParameterErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"fn(a = 1, b) {}", "parameter b without a default follows a parameter with a default"},
+		{"fn(...rest, b) {}", "rest parameter ...rest must be the last parameter"},
+		{"fn(1) {}", "expected parameter name, got INT instead"},
+		{"fn(a, a) {}", "duplicate parameter name a"},
+		{"fn(a, b = 1, b = 2) {}", "duplicate parameter name b"},
+		{"fn(a, ...a) {}", "duplicate parameter name a"},
+		{"|x, x| x", "duplicate parameter name x"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expectedError {
+			t.Errorf("expected parser error %q, got=%v", tt.expectedError, p.Errors())
+		}
 	}
 }
 
@@ -866,6 +1976,51 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
 
+func TestCallExpressionSpreadAndKeywordArguments(t *testing.T) {
+	input := "add(1, ...rest, b = 2 * 3, c = x);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp := stmt.Expression.(*ast.CallExpression)
+
+	if len(exp.Arguments) != 4 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	testLiteralExpression(t, exp.Arguments[0], 1)
+
+	spread, ok := exp.Arguments[1].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("argument 1 is not *ast.SpreadExpression. got=%T", exp.Arguments[1])
+	}
+	testIdentifier(t, spread.Value, "rest")
+
+	kwarg, ok := exp.Arguments[2].(*ast.KeywordArgument)
+	if !ok {
+		t.Fatalf("argument 2 is not *ast.KeywordArgument. got=%T", exp.Arguments[2])
+	}
+	testIdentifier(t, kwarg.Name, "b")
+	testInfixExpression(t, kwarg.Value, 2, "*", 3)
+
+	expected := "add(1, ...rest, b = (2 * 3), c = x)"
+	if exp.String() != expected {
+		t.Errorf("exp.String() wrong. expected=%q, got=%q", expected, exp.String())
+	}
+
+	l = lexer.New("add(b = 1, 2)")
+	p = New(l)
+	p.ParseProgram()
+
+	expectedError := "positional argument follows keyword argument"
+	if len(p.Errors()) != 1 || p.Errors()[0] != expectedError {
+		t.Errorf("expected parser error %q, got=%v", expectedError, p.Errors())
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	input := `"hello world";`
 
@@ -931,6 +2086,189 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStart interface{}
+		expectedEnd   interface{}
+		expectedStep  interface{}
+	}{
+		{"my_array[1:3]", 1, 3, nil},
+		{"my_array[:3]", nil, 3, nil},
+		{"my_array[1:]", 1, nil, nil},
+		{"my_array[:]", nil, nil, nil},
+		{"my_array[::2]", nil, nil, 2},
+		{"my_array[1::2]", 1, nil, 2},
+		{"my_array[1:3:]", 1, 3, nil},
+		{"my_array[i:j:k]", "i", "j", "k"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		sliceExp, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+		}
+
+		if !testIdentifier(t, sliceExp.Left, "my_array") {
+			return
+		}
+
+		bounds := []struct {
+			name     string
+			actual   ast.Expression
+			expected interface{}
+		}{
+			{"Start", sliceExp.Start, tt.expectedStart},
+			{"End", sliceExp.End, tt.expectedEnd},
+			{"Step", sliceExp.Step, tt.expectedStep},
+		}
+
+		for _, bound := range bounds {
+			if bound.expected == nil {
+				if bound.actual != nil {
+					t.Errorf("sliceExp.%s is not nil. got=%s", bound.name, bound.actual.String())
+				}
+				continue
+			}
+
+			if !testLiteralExpression(t, bound.actual, bound.expected) {
+				return
+			}
+		}
+	}
+}
+
+func TestRangeExpression(t *testing.T) {
+	tests := []struct {
+		input     string
+		inclusive bool
+		hasStep   bool
+	}{
+		{"0..n", false, false},
+		{"0..=n", true, false},
+		{"0..n by 2", false, true},
+		{"10..=0 by -1", true, true},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.RangeExpression)
+		if !ok {
+			t.Fatalf("exp is not ast.RangeExpression. got=%T", stmt.Expression)
+		}
+
+		if exp.Inclusive != tt.inclusive {
+			t.Errorf("exp.Inclusive wrong for %q. got=%t", tt.input, exp.Inclusive)
+		}
+
+		if (exp.Step != nil) != tt.hasStep {
+			t.Errorf("exp.Step wrong for %q. got=%v", tt.input, exp.Step)
+		}
+	}
+
+	// by on the next line is an identifier starting a new statement
+	l := lexer.New("let r = 0..n\nby")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+}
+
+func TestParsingComprehensions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[x * 2 for x in xs]", "[(x * 2) for x in xs]"},
+		{"[x for x in xs if x > 0]", "[x for x in xs if (x > 0)]"},
+		{"[a + b for a, b in pairs]", "[(a + b) for [a, b] in pairs]"},
+		{"[h for [h, ...t] in xs if t]", "[h for [h, ...t] in xs if t]"},
+		{"[x for x in a ?? b if x ? true : false]", "[x for x in (a ?? b) if (x ? true : false)]"},
+		{"{k: v for k, v in items(h)}", "{k: v for [k, v] in items(h)}"},
+		{`{x: x * x for x in xs if x != 2}`, "{x: (x * x) for x in xs if (x != 2)}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		switch stmt.Expression.(type) {
+		case *ast.ArrayComprehension, *ast.HashComprehension:
+		default:
+			t.Fatalf("exp is not a comprehension. got=%T", stmt.Expression)
+		}
+
+		if stmt.Expression.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, stmt.Expression.String())
+		}
+	}
+}
+
+func TestComprehensionErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"[x for x xs]", "expected next token to be in, got IDENT instead"},
+		{"[x for x in xs", "expected next token to be ], got EOF instead"},
+		{"[x for a, a in xs]", "a is bound more than once in pattern [a, a]"},
+		{"[x for x + 1 in xs]", "expected next token to be in, got + instead"},
+		{"{k: v for k in xs", "expected next token to be }, got EOF instead"},
+		{"[1, x for x in xs]", "expected next token to be ], got FOR instead"},
+		{"const c = 1; [c for c in xs if c = 2]", ""},
+		// The element is parsed in the scope of the targets
+		{"const c = 1; [c = 2 for c in xs]", ""},
+		{"const c = 1; {c: c = 2 for c in xs}", ""},
+		{"const c = 1; [c = 2 for x in xs]", "cannot assign to constant: c"},
+		{"const c = 1; {x: c = 2 for x in xs}", "cannot assign to constant: c"},
+		{"const c = 1; [[c = 2 for x in c] for c in xs]", ""},
+		{"[fn(x, x) { x } for x in xs]", "duplicate parameter name x"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if tt.expectedError == "" {
+			checkParserErrors(t, p)
+			continue
+		}
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expectedError {
+			t.Errorf("expected parser error %q, got=%v", tt.expectedError, p.Errors())
+		}
+
+		// Parsing the element again must not report its errors twice
+		count := 0
+		for _, err := range p.Errors() {
+			if err == tt.expectedError {
+				count++
+			}
+		}
+		if count > 1 {
+			t.Errorf("parser error %q reported %d times", tt.expectedError, count)
+		}
+	}
+}
+
 func TestParsingHashLiteral(t *testing.T) {
 	input := `{"one":1, "two":2, "three":3}`
 	l := lexer.New(input)
@@ -1058,3 +2396,42 @@ func TestParsingIndexVariableReassignment(t *testing.T) {
 		return
 	}
 }
+
+func TestParsingCompoundAssignment(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedOperator string
+	}{
+		{"x += 5", "+="},
+		{"x -= 5", "-="},
+		{"x *= 5", "*="},
+		{"x /= 5", "/="},
+		{"x %= 5", "%="},
+		{"x **= 5", "**="},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+
+		assignExp, ok := stmt.Expression.(*ast.AssignmentExpression)
+		if !ok {
+			t.Fatalf("exp is not *ast.AssignmentExpression. got=%T", stmt.Expression)
+		}
+
+		if !testIdentifier(t, assignExp.Left, "x") {
+			return
+		}
+
+		if assignExp.AssignmentType.Literal != tt.expectedOperator {
+			t.Errorf("expected %s, got %s", tt.expectedOperator, assignExp.AssignmentType.Literal)
+		}
+
+		if !testIntegerLiteral(t, assignExp.Right, 5) {
+			return
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"seville/ast"
 	"seville/compiler"
 	"seville/evaluator"
@@ -11,17 +13,23 @@ import (
 	"seville/object"
 	"seville/parser"
 	"seville/vm"
+	"strings"
 )
 
 const PROMPT = ">> "
 
 func Start(in io.Reader, out io.Writer, isCompiled bool) {
 	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	module := object.NewModule("__main__", "", object.NewModuleRegistry(object.SearchPath()))
+	env := module.Env
 	if isCompiled {
 		fmt.Println("Executing using the experimental compiler ...")
 	}
 
+	// The compiled REPL keeps its globals and imports from one line to the
+	// next
+	symbolTable := compiler.NewSymbolTable()
+
 	for {
 		fmt.Fprint(out, PROMPT)
 		scanned := scanner.Scan()
@@ -44,7 +52,7 @@ func Start(in io.Reader, out io.Writer, isCompiled bool) {
 		}
 
 		if isCompiled {
-			output, err := executeProgramWithCompiler(program)
+			output, err := executeProgramWithCompiler(program, symbolTable, module)
 			if err != nil {
 				io.WriteString(out, err.Error())
 				io.WriteString(out, "\n")
@@ -58,31 +66,86 @@ func Start(in io.Reader, out io.Writer, isCompiled bool) {
 	}
 }
 
-func executeProgramWithCompiler(program *ast.Program) (string, error) {
-	comp := compiler.New()
+// RunFile executes the script at path, writing anything it prints to out.
+// Unlike the REPL, the value of the last statement is not printed. Parser and
+// runtime errors are returned, including the traceback of runtime errors.
+func RunFile(path string, out io.Writer, isCompiled bool) error {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	l := lexer.New(string(source))
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		var msg strings.Builder
+		printParserErrors(&msg, p.Errors())
+		return fmt.Errorf("%s", strings.TrimSuffix(msg.String(), "\n"))
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	module := object.NewModule("__main__", abs, object.NewModuleRegistry(object.SearchPath()))
+	if isCompiled {
+		_, err := executeProgramWithCompiler(program, compiler.NewSymbolTable(), module)
+		return err
+	}
+
+	evaluated := evaluator.Eval(program, module.Env)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return fmt.Errorf("%s", strings.TrimSuffix(formatError(errObj), "\n"))
+	}
+
+	return nil
+}
+
+func executeProgramWithCompiler(
+	program *ast.Program,
+	symbolTable *compiler.SymbolTable,
+	module *object.Module,
+) (string, error) {
+	comp := compiler.NewWithState(symbolTable)
 	err := comp.Compile(program)
 	if err != nil {
 		return "", fmt.Errorf("compilation failed:\n %s", err)
 	}
 
-	machine := vm.New(comp.Bytecode())
+	machine := vm.NewWithModule(comp.Bytecode(), module)
 	err = machine.Run()
+	if errObj, ok := err.(*object.Error); ok {
+		return "", fmt.Errorf("%s", strings.TrimSuffix(formatError(errObj), "\n"))
+	}
 	if err != nil {
 		return "", fmt.Errorf("executing bytecode failed: \n %s", err)
 	}
 
-	stackTop := machine.StackTop()
-	return stackTop.Inspect() + "\n", nil
+	lastPopped := machine.LastPoppedStackElem()
+	if lastPopped == nil {
+		return "", nil
+	}
+	return lastPopped.Inspect() + "\n", nil
 }
 
 func executeProgramWithInterpreter(program *ast.Program, env *object.Environment) string {
 	evaluated := evaluator.Eval(program, env)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return formatError(errObj)
+	}
 	if evaluated != nil {
 		return evaluated.Inspect() + "\n"
 	}
 	return ""
 }
 
+func formatError(errObj *object.Error) string {
+	return errObj.Inspect() + "\n" + errObj.Traceback()
+}
+
 func printParserErrors(out io.Writer, errors []string) {
 	io.WriteString(out, "Oh no my program!\n")
 	io.WriteString(out, "Parser errors:\n")
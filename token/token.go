@@ -5,6 +5,8 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // 1-based line of the first character of the token
+	Column  int // 1-based column, counted in runes, of the first character
 }
 
 const (
@@ -23,6 +25,7 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
 	LT       = "<"
 	GT       = ">"
 	LT_OR_EQ = "<="
@@ -31,10 +34,34 @@ const (
 	NOT_EQ   = "!="
 	EXP      = "**"
 	IN       = "in"
+	NULLISH  = "??"
+	ARROW    = "=>"
+	QUESTION = "?"
+	OPTIONAL = "?."
+
+	// Bitwise operators. Bitwise or is PIPE, which also delimits lambda parameters
+	AMPERSAND = "&"
+	CARET     = "^"
+	TILDE     = "~"
+	LSHIFT    = "<<"
+	RSHIFT    = ">>"
+
+	// Compound assignment operators
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+	PERCENT_ASSIGN  = "%="
+	EXP_ASSIGN      = "**="
 
 	// Delimiters
+	ELLIPSIS  = "..."
+	RANGE     = ".."
+	RANGE_EQ  = "..="
 	COMMA     = ","
 	COLON     = ":"
+	PIPE      = "|"
+	DOT       = "."
 	SEMICOLON = ";"
 	LPAREN    = "("
 	RPAREN    = ")"
@@ -46,24 +73,51 @@ const (
 	// Keywords
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	ELIF     = "ELIF"
 	RETURN   = "RETURN"
+	NULL     = "NULL"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	AS       = "AS"
+	STRUCT   = "STRUCT"
+	MATCH    = "MATCH"
+	FOR      = "FOR"
+	YIELD    = "YIELD"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"elif":   ELIF,
-	"return": RETURN,
-	"in":     IN,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"const":   CONST,
+	"true":    TRUE,
+	"false":   FALSE,
+	"if":      IF,
+	"else":    ELSE,
+	"elif":    ELIF,
+	"return":  RETURN,
+	"in":      IN,
+	"null":    NULL,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"throw":   THROW,
+	"raise":   THROW,
+	"import":  IMPORT,
+	"export":  EXPORT,
+	"as":      AS,
+	"struct":  STRUCT,
+	"match":   MATCH,
+	"for":     FOR,
+	"yield":   YIELD,
 }
 
 func LookupIdent(ident string) TokenType {
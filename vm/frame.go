@@ -0,0 +1,20 @@
+package vm
+
+import (
+	"seville/object"
+	"seville/opcode"
+)
+
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int // The stack index of the first local slot of the frame
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() opcode.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,70 @@
+package vm
+
+import "seville/object"
+
+// newGenerator detaches frame, a call to a generator whose arguments are
+// bound, into a VM of its own, and returns the iterator that runs it. The
+// frame stays suspended there between the elements requested, each of which
+// resumes it until its next yield. The rest of the body does not start until
+// the first element is requested, and never runs once the iterator is
+// closed.
+func (vm *VM) newGenerator(frame *Frame) *object.FuncIterator {
+	numLocals := frame.cl.Fn.NumLocals
+
+	stack := make([]object.Object, StackSize)
+	copy(stack, vm.stack[frame.basePointer:frame.basePointer+numLocals])
+	// Closures created by the default values keep the values they captured
+	vm.closeUpvalues(frame.basePointer)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = &Frame{cl: frame.cl, ip: frame.ip, basePointer: 0}
+
+	gen := &VM{
+		stack:       stack,
+		sp:          numLocals,
+		frames:      frames,
+		framesIndex: 1,
+		generator:   true,
+	}
+
+	name := "generator"
+	if frame.cl.Fn.Name != "" {
+		name += " " + frame.cl.Fn.Name
+	}
+
+	running := false
+
+	iter := &object.FuncIterator{Name: name}
+	iter.NextFn = func() (object.Object, bool) {
+		if running {
+			return object.NewError(object.GenericError, "%s is already running", name), true
+		}
+
+		running = true
+		defer func() { running = false }()
+
+		err := gen.Run()
+		if err != nil {
+			if errObj, ok := err.(*object.Error); ok {
+				return errObj, true
+			}
+			return object.NewError(object.GenericError, "%s", err), true
+		}
+
+		// The body returned without yielding again
+		if gen.yielded == nil {
+			return nil, false
+		}
+
+		val := gen.yielded
+		gen.yielded = nil
+		return val, true
+	}
+	// Closing a suspended generator closes the iterators of the loops it is
+	// suspended in
+	iter.CloseFn = func() {
+		gen.closeLoops(0)
+	}
+
+	return iter
+}
@@ -0,0 +1,81 @@
+package vm
+
+import (
+	"os"
+	"seville/compiler"
+	"seville/lexer"
+	"seville/object"
+	"seville/parser"
+	"strings"
+)
+
+// importModule returns the module at the path imported by code in the
+// importer module, compiling and running it first if no other file has
+// imported it yet. Errors raised while loading the module propagate out of
+// the import as out of a call.
+func (vm *VM) importModule(importer *object.Module, path string) (*object.Module, error) {
+	if importer.Registry == nil {
+		// A VM created without a module runs the program in one of its own,
+		// whose imports share a registry from the first one on
+		importer.Registry = object.NewModuleRegistry(object.SearchPath())
+	}
+
+	resolved, resolveErr := object.ResolveModulePath(path, importer)
+	if resolveErr != nil {
+		return nil, resolveErr
+	}
+
+	module, err := loadModule(resolved, importer.Registry)
+	if err != nil {
+		return nil, vm.callError(err, nil)
+	}
+
+	return module, nil
+}
+
+// loadModule returns the module at path, which must be absolute, compiling
+// and running it on its first import only.
+func loadModule(path string, registry *object.ModuleRegistry) (*object.Module, error) {
+	if module, ok := registry.Loaded[path]; ok {
+		return module, nil
+	}
+
+	if err := registry.CircularImport(path); err != nil {
+		return nil, err
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, object.NewError(object.ImportError, "cannot read module %s: %s", path, err)
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, object.NewError(object.ImportError, "cannot parse module %s: %s", path, strings.Join(p.Errors(), "; "))
+	}
+
+	comp := compiler.New()
+	err = comp.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+
+	module := object.NewModule(object.ModuleName(path), path, registry)
+	bytecode := comp.Bytecode()
+	for _, name := range bytecode.Exports {
+		module.Exports[name] = true
+	}
+
+	registry.Loading = append(registry.Loading, path)
+	err = NewWithModule(bytecode, module).Run()
+	registry.Loading = registry.Loading[:len(registry.Loading)-1]
+
+	if err != nil {
+		return nil, err
+	}
+
+	registry.Loaded[path] = module
+
+	return module, nil
+}
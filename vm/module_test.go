@@ -0,0 +1,177 @@
+package vm
+
+import (
+	"os"
+	"path/filepath"
+	"seville/compiler"
+	"seville/object"
+	"testing"
+)
+
+// writeModules creates each file under a temporary directory and returns the
+// directory.
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+// runModule compiles and runs input as if it were the file main.sv in dir.
+func runModule(t *testing.T, input, dir string, registry *object.ModuleRegistry) (object.Object, error) {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		return nil, err
+	}
+
+	module := object.NewModule("main", filepath.Join(dir, "main.sv"), registry)
+	vm := NewWithModule(comp.Bytecode(), module)
+	if err := vm.Run(); err != nil {
+		return nil, err
+	}
+
+	return vm.LastPoppedStackElem(), nil
+}
+
+func TestImportStatements(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib.sv": `
+			export let x = 1
+			export const y = 2
+			export fn double(n) { triple(n) - n }
+			fn triple(n) { n * 3 }
+			let hidden = 3
+			`,
+		"sub/a.sv":       `import "b.sv" as b; export let value = b.value + 1`,
+		"sub/b.sv":       `export let value = 10`,
+		"state.sv":       `export let counts = {"n": 0}`,
+		"counter.sv":     `export let count = 0; export fn inc() { count += 1 }`,
+		"cycle/a.sv":     `import "b.sv" as b; export let a = 1`,
+		"cycle/b.sv":     `import "a.sv" as a; export let b = 1`,
+		"bad.sv":         `export fn f() { 1 }; 1 + true`,
+		"closure.sv":     `let secret = 5; export fn reveal() { secret }`,
+		"paths/found.sv": `export let found = true`,
+	})
+
+	tests := []vmTestCase{
+		{`import "lib.sv" as lib; lib.x + lib.y`, 3},
+		{`import "lib.sv" as lib; lib.double(5)`, 10},
+		{`import "./lib.sv" as lib; lib.x`, 1},
+		{`import "sub/a.sv" as a; a.value`, 11},
+		{`import "closure.sv" as c; c.reveal()`, 5},
+		{`import "state.sv" as a; import "state.sv" as b; a == b`, true},
+		{`import "counter.sv" as c; c.inc(); c.inc(); c.count`, 2},
+		{`fn f() { import "lib.sv" as lib; lib.x }; f()`, 1},
+		{`import "found.sv" as f; f.found`, true},
+		{`import "lib.sv" as lib; lib.hidden`, &object.Error{Kind: object.AttributeError, Message: "module lib has no export hidden"}},
+		{`import "lib.sv" as lib; lib.triple`, &object.Error{Kind: object.AttributeError, Message: "module lib has no export triple"}},
+		{`import "missing.sv" as m`, &object.Error{Kind: object.ImportError, Message: "module not found: missing.sv"}},
+		{`import "cycle/a.sv" as a`, &object.Error{Kind: object.ImportError, Message: "circular import: a.sv -> b.sv -> a.sv"}},
+		{`import "bad.sv" as bad`, &object.Error{Kind: object.TypeError, Message: "type mismatch: INTEGER + BOOLEAN"}},
+		{`const lib = 1; import "lib.sv" as lib`, &object.Error{Kind: object.NameError, Message: "cannot redeclare constant: lib"}},
+		{`import "lib.sv" as lib; lib.x = 2`, &object.Error{Kind: object.TypeError, Message: "cannot assign to member x of MODULE"}},
+	}
+
+	for _, tt := range tests {
+		registry := object.NewModuleRegistry([]string{filepath.Join(dir, "paths")})
+		result, err := runModule(t, tt.input, dir, registry)
+
+		if expected, ok := tt.expected.(*object.Error); ok {
+			testExpectedError(t, tt.input, expected, err)
+			continue
+		}
+		if err != nil {
+			t.Errorf("vm error for %q: %s", tt.input, err)
+			continue
+		}
+
+		testExpectedObject(t, tt.expected, result)
+	}
+}
+
+func TestImportedModulesAreCached(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"state.sv": `export let counts = {"loads": 0}`,
+		"a.sv":     `import "state.sv" as s; s.counts["loads"] = s.counts["loads"] + 1`,
+		"b.sv":     `import "state.sv" as s; import "a.sv" as a; s.counts["loads"] = s.counts["loads"] + 1`,
+	})
+
+	input := `
+	import "a.sv" as a
+	import "b.sv" as b
+	import "a.sv" as again
+	import "state.sv" as s
+	s.counts["loads"]
+	`
+
+	registry := object.NewModuleRegistry(nil)
+	result, err := runModule(t, input, dir, registry)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 2, result)
+
+	if len(registry.Loaded) != 3 {
+		t.Errorf("registry.Loaded has wrong number of modules. expected=3, got=%d", len(registry.Loaded))
+	}
+
+	if len(registry.Loading) != 0 {
+		t.Errorf("registry.Loading is not empty. got=%v", registry.Loading)
+	}
+}
+
+func TestImportErrorStack(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"bad.sv": "let f = fn() { 1 + true }\nf()",
+	})
+
+	_, err := runModule(t, "let a = 1\nimport \"bad.sv\" as bad", dir, object.NewModuleRegistry(nil))
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		t.Fatalf("expected *object.Error. got=%T (%+v)", err, err)
+	}
+
+	expectedStack := []object.StackFrame{
+		{Function: "f", Line: 2, Column: 1},
+		{Function: "<module bad>", Line: 2, Column: 1},
+	}
+
+	if len(errObj.Stack) != len(expectedStack) {
+		t.Fatalf("wrong stack length. expected=%d, got=%d (%+v)", len(expectedStack), len(errObj.Stack), errObj.Stack)
+	}
+
+	for i, frame := range expectedStack {
+		if errObj.Stack[i] != frame {
+			t.Errorf("wrong stack frame %d. expected=%+v, got=%+v", i, frame, errObj.Stack[i])
+		}
+	}
+}
+
+func TestImportsOutsideAModuleShareARegistry(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"state.sv":   `export let counts = {"loads": 0}; counts["loads"] = counts["loads"] + 1`,
+		"cycle/a.sv": `import "b.sv" as b; export let a = 1`,
+		"cycle/b.sv": `import "a.sv" as a; export let b = 1`,
+	})
+	t.Setenv("SEVILLE_PATH", dir)
+
+	tests := []vmTestCase{
+		{`import "state.sv" as a; import "state.sv" as b; a == b`, true},
+		{`import "state.sv" as a; fn f() { import "state.sv" as b; b.counts["loads"] }; f() + a.counts["loads"]`, 2},
+		{`import "cycle/a.sv" as a`, &object.Error{Kind: object.ImportError, Message: "circular import: a.sv -> b.sv -> a.sv"}},
+	}
+
+	runVmTests(t, tests)
+}
@@ -0,0 +1,363 @@
+package vm
+
+import (
+	"math"
+	"seville/ast"
+	"seville/object"
+	"seville/opcode"
+	"unicode/utf8"
+)
+
+// operators spells out each operator opcode for error messages, which read
+// the same as the interpreter's.
+var operators = map[opcode.Opcode]string{
+	opcode.OpAdd:                "+",
+	opcode.OpSubtract:           "-",
+	opcode.OpMultiply:           "*",
+	opcode.OpDivide:             "/",
+	opcode.OpModulo:             "%",
+	opcode.OpPower:              "**",
+	opcode.OpBitAnd:             "&",
+	opcode.OpBitOr:              "|",
+	opcode.OpBitXor:             "^",
+	opcode.OpShiftLeft:          "<<",
+	opcode.OpShiftRight:         ">>",
+	opcode.OpIn:                 "in",
+	opcode.OpEqual:              "==",
+	opcode.OpNotEqual:           "!=",
+	opcode.OpLessThan:           "<",
+	opcode.OpLessThanOrEqual:    "<=",
+	opcode.OpGreaterThan:        ">",
+	opcode.OpGreaterThanOrEqual: ">=",
+	opcode.OpMinus:              "-",
+	opcode.OpBitNot:             "~",
+}
+
+func binaryOperation(op opcode.Opcode, left, right object.Object) (object.Object, error) {
+	operator := operators[op]
+
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return integerOperation(op, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		if op == opcode.OpAdd {
+			return &object.String{Value: left.(*object.String).Value + right.(*object.String).Value}, nil
+		}
+		return comparisonOperation(op, left, right)
+	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ && op != opcode.OpIn:
+		return comparisonOperation(op, left, right)
+	case left.Type() == object.STRUCT_OBJ && right.Type() == object.STRUCT_OBJ,
+		left.Type() == object.RANGE_OBJ && right.Type() == object.RANGE_OBJ:
+		// Compared by value rather than by identity, but not ordered
+		switch op {
+		case opcode.OpEqual:
+			return nativeBoolToBooleanObject(left.Equals(right)), nil
+		case opcode.OpNotEqual:
+			return nativeBoolToBooleanObject(!left.Equals(right)), nil
+		}
+	case op == opcode.OpEqual:
+		return nativeBoolToBooleanObject(left == right), nil
+	case op == opcode.OpNotEqual:
+		return nativeBoolToBooleanObject(left != right), nil
+	case op == opcode.OpIn:
+		return containsOperation(left, right)
+	case left.Type() != right.Type():
+		return nil, object.NewError(object.TypeError, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	return nil, object.NewError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+func integerOperation(op opcode.Opcode, left, right object.Object) (object.Object, error) {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+
+	var result int64
+	switch op {
+	case opcode.OpAdd:
+		result = leftVal + rightVal
+	case opcode.OpSubtract:
+		result = leftVal - rightVal
+	case opcode.OpMultiply:
+		result = leftVal * rightVal
+	case opcode.OpDivide:
+		if rightVal == 0 {
+			return nil, object.NewError(object.ZeroDivisionError, "division by zero: %d / 0", leftVal)
+		}
+		result = leftVal / rightVal
+	case opcode.OpModulo:
+		if rightVal == 0 {
+			return nil, object.NewError(object.ZeroDivisionError, "modulo by zero: %d %% 0", leftVal)
+		}
+		result = leftVal % rightVal
+	case opcode.OpPower:
+		result = int64(math.Pow(float64(leftVal), float64(rightVal)))
+	case opcode.OpBitAnd:
+		result = leftVal & rightVal
+	case opcode.OpBitOr:
+		result = leftVal | rightVal
+	case opcode.OpBitXor:
+		result = leftVal ^ rightVal
+	case opcode.OpShiftLeft, opcode.OpShiftRight:
+		if rightVal < 0 {
+			return nil, object.NewError(object.ArgumentError, "negative shift count: %d %s %d", leftVal, operators[op], rightVal)
+		}
+		if op == opcode.OpShiftLeft {
+			result = leftVal << rightVal
+		} else {
+			result = leftVal >> rightVal
+		}
+	case opcode.OpEqual, opcode.OpNotEqual, opcode.OpLessThan, opcode.OpLessThanOrEqual,
+		opcode.OpGreaterThan, opcode.OpGreaterThanOrEqual:
+		return comparisonOperation(op, left, right)
+	default:
+		return nil, object.NewError(object.TypeError, "unknown operator %s %s %s", left.Type(), operators[op], right.Type())
+	}
+
+	return &object.Integer{Value: result}, nil
+}
+
+// comparisonOperation compares integers, strings or arrays, which are equal
+// when their elements are and ordered lexicographically.
+func comparisonOperation(op opcode.Opcode, left, right object.Object) (object.Object, error) {
+	switch op {
+	case opcode.OpEqual:
+		return nativeBoolToBooleanObject(left.Equals(right)), nil
+	case opcode.OpNotEqual:
+		return nativeBoolToBooleanObject(!left.Equals(right)), nil
+	case opcode.OpLessThan, opcode.OpLessThanOrEqual, opcode.OpGreaterThan, opcode.OpGreaterThanOrEqual:
+	default:
+		return nil, object.NewError(object.TypeError, "unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+
+	c, ok := object.Compare(left, right)
+	if !ok {
+		return nil, object.NewError(object.TypeError, "cannot compare %s %s %s", left.Inspect(), operators[op], right.Inspect())
+	}
+
+	switch op {
+	case opcode.OpLessThan:
+		return nativeBoolToBooleanObject(c < 0), nil
+	case opcode.OpLessThanOrEqual:
+		return nativeBoolToBooleanObject(c <= 0), nil
+	case opcode.OpGreaterThan:
+		return nativeBoolToBooleanObject(c > 0), nil
+	default:
+		return nativeBoolToBooleanObject(c >= 0), nil
+	}
+}
+
+func containsOperation(left, right object.Object) (object.Object, error) {
+	switch collection := right.(type) {
+	case *object.Array:
+		for _, el := range collection.Elements {
+			if left.Equals(el) {
+				return True, nil
+			}
+		}
+		return False, nil
+	case *object.Hash:
+		key, ok := left.(object.Hashable)
+		if !ok {
+			return nil, object.NewError(object.TypeError, "unusable as hash key: %s", left.Type())
+		}
+		_, ok = collection.Pairs[key.HashKey()]
+		return nativeBoolToBooleanObject(ok), nil
+	case *object.Range:
+		n, ok := left.(*object.Integer)
+		if !ok {
+			return False, nil
+		}
+		return nativeBoolToBooleanObject(collection.Contains(n.Value)), nil
+	default:
+		return nil, object.NewError(object.TypeError, "The `in` keyword is not supported for type %s", right.Type())
+	}
+}
+
+func indexOperation(left, index object.Object) (object.Object, error) {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		i, length := index.(*object.Integer).Value, int64(len(elements))
+
+		adjIdx, ok := object.NormalizeIndex(i, length)
+		if !ok {
+			return nil, object.NewError(object.IndexError, "array index out of bounds: given index %d, array length is: %d", i, length)
+		}
+		return elements[adjIdx], nil
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		// Strings are indexed by rune rather than by byte, consistent with len
+		runes := []rune(left.(*object.String).Value)
+		i, length := index.(*object.Integer).Value, int64(len(runes))
+
+		adjIdx, ok := object.NormalizeIndex(i, length)
+		if !ok {
+			return nil, object.NewError(object.IndexError, "string index out of bounds: given index %d, string length is: %d", i, length)
+		}
+		return &object.String{Value: string(runes[adjIdx])}, nil
+	case left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ:
+		rng := left.(*object.Range)
+		i, length := index.(*object.Integer).Value, rng.Len()
+
+		adjIdx, ok := object.NormalizeIndex(i, length)
+		if !ok {
+			return nil, object.NewError(object.IndexError, "range index out of bounds: given index %d, range length is: %d", i, length)
+		}
+		return &object.Integer{Value: rng.At(adjIdx)}, nil
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return nil, object.NewError(object.TypeError, "unusable as hash key: %s", index.Type())
+		}
+
+		pair, ok := left.(*object.Hash).Pairs[key.HashKey()]
+		if !ok {
+			return nil, object.NewError(object.KeyError, "key %s not found in hash map", index.Inspect())
+		}
+		return pair.Value, nil
+	case left.Type() == object.EXCEPTION_OBJ:
+		val, err := left.(*object.Exception).Index(index)
+		if err != nil {
+			return nil, err
+		}
+		return val, nil
+	default:
+		return nil, object.NewError(object.TypeError, "index operator not supported: %s", left.Type())
+	}
+}
+
+// setMemberOperation assigns val to obj.name, combining it with the current
+// value first for a compound assignment, and returns the value stored.
+func setMemberOperation(obj object.Object, name string, val object.Object, operator opcode.Opcode) (object.Object, error) {
+	if err := object.CheckSetMember(obj, name); err != nil {
+		return nil, err
+	}
+
+	if operator != 0 {
+		current, memberErr := object.GetMember(obj, name)
+		if memberErr != nil {
+			return nil, memberErr
+		}
+
+		var err error
+		val, err = binaryOperation(operator, current, val)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := object.SetMember(obj, name, val); err != nil {
+		return nil, err
+	}
+
+	return val, nil
+}
+
+// sliceOperation slices an array or string, where null bounds are omitted.
+func sliceOperation(left, start, end, step object.Object) (object.Object, error) {
+	bounds := []*int64{}
+	for _, bound := range []object.Object{start, end, step} {
+		switch bound := bound.(type) {
+		case *object.Integer:
+			bounds = append(bounds, &bound.Value)
+		case *object.Null:
+			bounds = append(bounds, nil)
+		default:
+			return nil, object.NewError(object.TypeError, "slice indices must be integers, got %s", bound.Type())
+		}
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		indices, err := object.SliceIndices(int64(len(left.Elements)), bounds[0], bounds[1], bounds[2])
+		if err != nil {
+			return nil, err
+		}
+
+		elements := make([]object.Object, 0, len(indices))
+		for _, i := range indices {
+			elements = append(elements, left.Elements[i])
+		}
+		return &object.Array{Elements: elements}, nil
+	case *object.String:
+		runes := []rune(left.Value)
+		indices, err := object.SliceIndices(int64(utf8.RuneCountInString(left.Value)), bounds[0], bounds[1], bounds[2])
+		if err != nil {
+			return nil, err
+		}
+
+		sliced := make([]rune, 0, len(indices))
+		for _, i := range indices {
+			sliced = append(sliced, runes[i])
+		}
+		return &object.String{Value: string(sliced)}, nil
+	default:
+		return nil, object.NewError(object.TypeError, "slice operator not supported: %s", left.Type())
+	}
+}
+
+// setIndexOperation stores val in an array or hash, with the same errors as
+// assignment in the interpreter.
+func setIndexOperation(collection, index, val object.Object) error {
+	switch collection := collection.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return object.NewError(object.TypeError, "Array indices must be integers. got=%T", index)
+		}
+
+		length := int64(len(collection.Elements))
+		adjIdx, ok := object.NormalizeIndex(i.Value, length)
+		if !ok {
+			return object.NewError(object.IndexError, "Array index out of bounds: given index %d, array length is %d", i.Value, length)
+		}
+
+		collection.Elements[adjIdx] = val
+		return nil
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return object.NewError(object.TypeError, "Hashmap index must be a hashable type, got type %T", index)
+		}
+
+		collection.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: val}
+		return nil
+	default:
+		return object.NewError(object.TypeError, "cannot index type of %T", collection)
+	}
+}
+
+// matchOperation matches val against pattern, returning the values of the
+// names the pattern binds in the order of ast.PatternBindings, or the error
+// describing the first mismatch.
+func matchOperation(pattern ast.Pattern, val object.Object) ([]object.Object, *object.Error) {
+	bound := []object.Object{}
+	bind := func(name string, val object.Object) object.Object {
+		bound = append(bound, val)
+		return val
+	}
+
+	err := object.MatchPattern(pattern, val, patternLiteral, bind)
+	if err != nil {
+		return nil, err
+	}
+
+	return bound, nil
+}
+
+// patternLiteral returns the value of a literal in a pattern, which the
+// parser limits to integers, negated integers, strings, booleans and null.
+func patternLiteral(node ast.Expression) object.Object {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+	case *ast.PrefixExpression:
+		return &object.Integer{Value: -patternLiteral(node.Right).(*object.Integer).Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+	default:
+		return Null
+	}
+}
@@ -8,57 +8,1102 @@ import (
 )
 
 const StackSize = 2048
+const GlobalsSize = 65536
+const MaxFrames = 1024
 
-type VM struct {
-	constants    []object.Object
-	instructions opcode.Instructions
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
+
+// unbound fills the slot of a parameter that was not passed an argument
+// until its default value is evaluated.
+var unbound object.Object = &object.Null{}
 
+type VM struct {
 	stack []object.Object
 	sp    int // Always points to the next value. Top of the stack is stack[sp - 1]
+
+	frames      []*Frame
+	framesIndex int
+
+	// openUpvalues holds the upvalues of variables that are still on the
+	// stack, to be closed when their frame returns
+	openUpvalues []openUpvalue
+
+	// loops holds the stack indexes of the iterators of the loops that are
+	// running, innermost last, to close the iterators that an error or a
+	// return abandons, as the interpreter does
+	loops []int
+
+	lastPoppedStackElem object.Object
+
+	// generator is set for the VM a generator runs in, whose run stops with
+	// the value of each yield in yielded
+	generator bool
+	yielded   object.Object
+}
+
+type openUpvalue struct {
+	slot    int // The stack index of the variable
+	upvalue *object.Upvalue
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobalsStore creates a VM that keeps the globals of an earlier run,
+// as the REPL does between lines.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	module := object.NewModule("__main__", "", nil)
+	module.Globals = s
+	return NewWithModule(bytecode, module)
+}
+
+// NewWithModule creates a VM that runs the top level of module, keeping its
+// globals in the module, where the functions declared in it find them. The
+// REPL runs every line in the same module.
+func NewWithModule(bytecode *compiler.Bytecode, module *object.Module) *VM {
+	if module.Globals == nil {
+		module.Globals = make([]object.Object, GlobalsSize)
+	}
+	module.GlobalNames = bytecode.GlobalNames
+
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Constants:    bytecode.Constants,
+		NumLocals:    bytecode.NumLocals,
+		Positions:    bytecode.Positions,
+		CallSites:    bytecode.CallSites,
+		Handlers:     bytecode.Handlers,
+	}
+	mainFrame := NewFrame(&object.Closure{Fn: mainFn, Module: module}, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
 	return &VM{
-		instructions: bytecode.Instructions,
-		constants:    bytecode.Constants,
-		stack:        make([]object.Object, StackSize),
-		sp:           0,
+		stack: make([]object.Object, StackSize),
+		// The local slots of the program sit at the bottom of the stack
+		sp:          bytecode.NumLocals,
+		frames:      frames,
+		framesIndex: 1,
 	}
 }
 
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow: exceeded limit of %d nested calls", MaxFrames)
+	}
+
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// Run runs the program. A runtime error is caught by the innermost try
+// around the instruction that raised it, in the current frame or one of the
+// frames it returns to, else it stops the program. It is returned with the
+// position it was raised at and the calls it propagated out of.
 func (vm *VM) Run() error {
-	for ip := 0; ip < len(vm.instructions); ip++ {
-		op := opcode.Opcode(vm.instructions[ip])
+	for {
+		err := vm.run()
+		if err == nil {
+			return nil
+		}
+
+		errObj, ok := err.(*object.Error)
+		if !ok {
+			return err
+		}
+
+		errObj, caught := vm.unwind(vm.withPosition(errObj))
+		if !caught {
+			return errObj
+		}
+	}
+}
+
+// unwind looks up the handler of err in the exception table of each frame,
+// from the current one out, popping the frames that have none. The handler
+// found starts running with the exception on the stack. Returns err with the
+// calls it propagated out of, and whether it was caught.
+func (vm *VM) unwind(err *object.Error) (*object.Error, bool) {
+	for {
+		frame := vm.currentFrame()
+		if handler, ok := frame.cl.Fn.HandlerAt(frame.ip); ok {
+			vm.sp = frame.basePointer + frame.cl.Fn.NumLocals + handler.Depth
+			vm.closeLoops(vm.sp)
+			vm.stack[vm.sp] = &object.Exception{Error: err}
+			vm.sp++
+			frame.ip = handler.Target - 1
+
+			return err, true
+		}
+
+		if vm.framesIndex == 1 {
+			vm.closeLoops(0)
+			return err, false
+		}
+
+		callee := vm.popFrame()
+		vm.closeUpvalues(callee.basePointer)
+		err = vm.withCallFrame(err, callee.cl)
+	}
+}
+
+func (vm *VM) run() error {
+	var ip int
+	var ins opcode.Instructions
+	var op opcode.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		frame := vm.currentFrame()
+		ip = frame.ip
+		ins = frame.Instructions()
+		op = opcode.Opcode(ins[ip])
 
 		switch op {
 		case opcode.OpConstant:
-			constIndex := opcode.ReadUint16(vm.instructions[ip+1:])
-			ip += 2
+			constIndex := opcode.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			err := vm.push(frame.cl.Fn.Constants[constIndex])
+			if err != nil {
+				return err
+			}
+		case opcode.OpAdd, opcode.OpSubtract, opcode.OpMultiply, opcode.OpDivide,
+			opcode.OpModulo, opcode.OpPower, opcode.OpBitAnd, opcode.OpBitOr,
+			opcode.OpBitXor, opcode.OpShiftLeft, opcode.OpShiftRight, opcode.OpIn,
+			opcode.OpEqual, opcode.OpNotEqual, opcode.OpLessThan, opcode.OpLessThanOrEqual,
+			opcode.OpGreaterThan, opcode.OpGreaterThanOrEqual:
+			err := vm.executeBinaryOperation(op)
+			if err != nil {
+				return err
+			}
+		case opcode.OpBitNot, opcode.OpMinus:
+			obj := vm.pop()
+			operand, ok := obj.(*object.Integer)
+			if !ok {
+				return object.NewError(object.TypeError, "unknown operator: %s%s", operators[op], obj.Type())
+			}
+
+			result := -operand.Value
+			if op == opcode.OpBitNot {
+				result = ^operand.Value
+			}
+
+			err := vm.push(&object.Integer{Value: result})
+			if err != nil {
+				return err
+			}
+		case opcode.OpBang:
+			err := vm.push(nativeBoolToBooleanObject(!isTruthy(vm.pop())))
+			if err != nil {
+				return err
+			}
+		case opcode.OpPop:
+			vm.lastPoppedStackElem = vm.pop()
+		case opcode.OpDup:
+			err := vm.push(vm.StackTop())
+			if err != nil {
+				return err
+			}
+		case opcode.OpRotThree:
+			top := vm.stack[vm.sp-1]
+			vm.stack[vm.sp-1] = vm.stack[vm.sp-2]
+			vm.stack[vm.sp-2] = vm.stack[vm.sp-3]
+			vm.stack[vm.sp-3] = top
+		case opcode.OpTrue:
+			err := vm.push(True)
+			if err != nil {
+				return err
+			}
+		case opcode.OpFalse:
+			err := vm.push(False)
+			if err != nil {
+				return err
+			}
+		case opcode.OpNull:
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+		case opcode.OpGetGlobal:
+			globalIndex := opcode.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			module := frame.cl.Module
+			val := module.Globals[globalIndex]
+			if val == nil {
+				return object.NewError(object.NameError, "identifier not found: %s", module.GlobalNames[globalIndex])
+			}
+
+			err := vm.push(val)
+			if err != nil {
+				return err
+			}
+		case opcode.OpSetGlobal:
+			globalIndex := opcode.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			frame.cl.Module.Globals[globalIndex] = vm.pop()
+		case opcode.OpGetLocal:
+			localIndex := opcode.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			if err != nil {
+				return err
+			}
+		case opcode.OpSetLocal:
+			localIndex := opcode.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+		case opcode.OpAssignLocal:
+			localIndex := opcode.ReadUint16(ins[ip+1:])
+			operator := opcode.Opcode(opcode.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+
+			val, err := vm.assignedValue(vm.stack[frame.basePointer+int(localIndex)], vm.pop(), operator)
+			if err != nil {
+				return err
+			}
+
+			vm.stack[frame.basePointer+int(localIndex)] = val
+			err = vm.push(val)
+			if err != nil {
+				return err
+			}
+		case opcode.OpAssignGlobal:
+			globalIndex := opcode.ReadUint16(ins[ip+1:])
+			operator := opcode.Opcode(opcode.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+
+			module := frame.cl.Module
+			if module.Globals[globalIndex] == nil {
+				if operator != 0 {
+					return object.NewError(object.NameError, "identifier not found: %s", module.GlobalNames[globalIndex])
+				}
+				return object.NewError(object.NameError, "cannot assign to undeclared identifier: %s", module.GlobalNames[globalIndex])
+			}
 
-			err := vm.push(vm.constants[constIndex])
+			val, err := vm.assignedValue(module.Globals[globalIndex], vm.pop(), operator)
 			if err != nil {
 				return err
 			}
-		case opcode.OpAdd:
-			right := vm.pop()
+
+			module.Globals[globalIndex] = val
+			err = vm.push(val)
+			if err != nil {
+				return err
+			}
+		case opcode.OpSetIndex:
+			operator := opcode.Opcode(opcode.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			index := vm.pop()
+			val := vm.pop()
+			collection := vm.pop()
+
+			if operator != 0 {
+				current, err := indexOperation(collection, index)
+				if err != nil {
+					return err
+				}
+
+				val, err = binaryOperation(operator, current, val)
+				if err != nil {
+					return err
+				}
+			}
+
+			err := setIndexOperation(collection, index, val)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(val)
+			if err != nil {
+				return err
+			}
+		case opcode.OpArray:
+			numElements := int(opcode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+
+			err := vm.push(&object.Array{Elements: elements})
+			if err != nil {
+				return err
+			}
+		case opcode.OpHash:
+			numElements := int(opcode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp -= numElements
+
+			err = vm.push(hash)
+			if err != nil {
+				return err
+			}
+		case opcode.OpIndex:
+			index := vm.pop()
 			left := vm.pop()
-			leftValue := left.(*object.Integer).Value
-			rightValue := right.(*object.Integer).Value
 
-			vm.push(&object.Integer{Value: leftValue + rightValue})
-		case opcode.OpSubtract:
-			right := vm.pop()
+			result, err := indexOperation(left, index)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(result)
+			if err != nil {
+				return err
+			}
+		case opcode.OpSlice:
+			step := vm.pop()
+			end := vm.pop()
+			start := vm.pop()
 			left := vm.pop()
-			leftValue := left.(*object.Integer).Value
-			rightValue := right.(*object.Integer).Value
 
-			vm.push(&object.Integer{Value: leftValue - rightValue})
+			result, err := sliceOperation(left, start, end, step)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(result)
+			if err != nil {
+				return err
+			}
+		case opcode.OpGetBuiltin:
+			builtinIndex := opcode.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			err := vm.push(object.Builtins[builtinIndex].Builtin)
+			if err != nil {
+				return err
+			}
+		case opcode.OpClosure:
+			constIndex := opcode.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			err := vm.pushClosure(int(constIndex))
+			if err != nil {
+				return err
+			}
+		case opcode.OpGetFree:
+			freeIndex := opcode.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			value := *frame.cl.Free[freeIndex].Value
+			if value == nil {
+				return object.NewError(object.NameError, "identifier not found: %s", frame.cl.Fn.Captures[freeIndex].Name)
+			}
+
+			err := vm.push(value)
+			if err != nil {
+				return err
+			}
+		case opcode.OpAssignFree:
+			freeIndex := opcode.ReadUint8(ins[ip+1:])
+			operator := opcode.Opcode(opcode.ReadUint8(ins[ip+2:]))
+			frame.ip += 2
+
+			upvalue := frame.cl.Free[freeIndex]
+			val, err := vm.assignedValue(*upvalue.Value, vm.pop(), operator)
+			if err != nil {
+				return err
+			}
+
+			*upvalue.Value = val
+			err = vm.push(val)
+			if err != nil {
+				return err
+			}
+		case opcode.OpCall:
+			numArgs := opcode.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			callee := vm.stack[vm.sp-1-int(numArgs)]
+			err := vm.callFunction(int(numArgs), nil)
+			if err != nil {
+				return vm.callError(err, callee)
+			}
+		case opcode.OpApply:
+			numArgs := opcode.ReadUint8(ins[ip+1:])
+			constIndex := opcode.ReadUint16(ins[ip+2:])
+			frame.ip += 3
+
+			callee := vm.stack[vm.sp-1-int(numArgs)]
+			kinds := frame.cl.Fn.Constants[constIndex].(*object.Array)
+			err := vm.applyFunction(int(numArgs), kinds.Elements)
+			if err != nil {
+				return vm.callError(err, callee)
+			}
+		case opcode.OpReturnValue:
+			returnValue := vm.pop()
+
+			returning := vm.popFrame()
+			vm.closeUpvalues(returning.basePointer)
+			vm.closeLoops(returning.basePointer)
+
+			if vm.framesIndex == 0 {
+				// A return at the top level ends the program
+				vm.lastPoppedStackElem = returnValue
+				vm.framesIndex = 1
+				return nil
+			}
+
+			// Drop the locals and the function itself
+			vm.sp = returning.basePointer - 1
+
+			err := vm.push(returnValue)
+			if err != nil {
+				return err
+			}
+		case opcode.OpThrow:
+			return thrownError(vm.pop())
+		case opcode.OpImport:
+			constIndex := opcode.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			path := frame.cl.Fn.Constants[constIndex].(*object.String).Value
+			module, err := vm.importModule(frame.cl.Module, path)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(module)
+			if err != nil {
+				return err
+			}
+		case opcode.OpGetMember:
+			constIndex := opcode.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			name := frame.cl.Fn.Constants[constIndex].(*object.String).Value
+			result, memberErr := object.GetMember(vm.pop(), name)
+			if memberErr != nil {
+				return memberErr
+			}
+
+			err := vm.push(result)
+			if err != nil {
+				return err
+			}
+		case opcode.OpSetMember:
+			constIndex := opcode.ReadUint16(ins[ip+1:])
+			operator := opcode.Opcode(opcode.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+
+			name := frame.cl.Fn.Constants[constIndex].(*object.String).Value
+			val := vm.pop()
+			obj := vm.pop()
+
+			val, err := setMemberOperation(obj, name, val, operator)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(val)
+			if err != nil {
+				return err
+			}
+		case opcode.OpStruct:
+			constIndex := opcode.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			// Each declaration that runs declares a type of its own, as in
+			// the interpreter
+			st := *frame.cl.Fn.Constants[constIndex].(*object.StructType)
+			err := vm.push(&st)
+			if err != nil {
+				return err
+			}
+		case opcode.OpJumpIfBound:
+			localIndex := int(opcode.ReadUint16(ins[ip+1:]))
+			pos := int(opcode.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+
+			if vm.stack[frame.basePointer+localIndex] != unbound {
+				frame.ip = pos - 1
+			}
+		case opcode.OpJump:
+			pos := int(opcode.ReadUint16(ins[ip+1:]))
+			// The loop increments ip, so stop just short of the target
+			frame.ip = pos - 1
+		case opcode.OpMatch:
+			constIndex := opcode.ReadUint16(ins[ip+1:])
+			pos := int(opcode.ReadUint16(ins[ip+5:]))
+			frame.ip += 6
+
+			pattern := frame.cl.Fn.Constants[constIndex].(*object.Pattern)
+			bound, err := matchOperation(pattern.Pattern, vm.pop())
+			if err != nil {
+				frame.ip = pos - 1
+				continue
+			}
+
+			for _, val := range bound {
+				err := vm.push(val)
+				if err != nil {
+					return err
+				}
+			}
+		case opcode.OpDestructure:
+			constIndex := opcode.ReadUint16(ins[ip+1:])
+			frame.ip += 4
+
+			pattern := frame.cl.Fn.Constants[constIndex].(*object.Pattern)
+			bound, err := matchOperation(pattern.Pattern, vm.pop())
+			if err != nil {
+				return err
+			}
+
+			for _, val := range bound {
+				err := vm.push(val)
+				if err != nil {
+					return err
+				}
+			}
+		case opcode.OpIter:
+			iter, iterErr := object.GetIterator(vm.pop())
+			if iterErr != nil {
+				return iterErr
+			}
+
+			err := vm.push(iter)
+			if err != nil {
+				return err
+			}
+			vm.loops = append(vm.loops, vm.sp-1)
+		case opcode.OpIterNext:
+			pos := int(opcode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			el, ok := vm.stack[vm.sp-1].(object.Iterator).Next()
+			if !ok {
+				vm.pop()
+				vm.loops = vm.loops[:len(vm.loops)-1]
+				frame.ip = pos - 1
+				continue
+			}
+			if err, ok := el.(*object.Error); ok {
+				return err
+			}
+
+			err := vm.push(el)
+			if err != nil {
+				return err
+			}
+		case opcode.OpAppend:
+			depth := int(opcode.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			el := vm.pop()
+			arr := vm.stack[vm.sp-1-depth].(*object.Array)
+			arr.Elements = append(arr.Elements, el)
+		case opcode.OpInsert:
+			depth := int(opcode.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			value := vm.pop()
+			key := vm.pop()
+			hash := vm.stack[vm.sp-1-depth].(*object.Hash)
+
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return object.NewError(object.TypeError, "unusable as hash key: %s", key.Type())
+			}
+			hash.Pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+		case opcode.OpCloseUpvalues:
+			slot := int(opcode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			vm.closeUpvalues(frame.basePointer + slot)
+		case opcode.OpGenerator:
+			returning := vm.popFrame()
+			iter := vm.newGenerator(returning)
+
+			// Drop the locals and the function itself
+			vm.sp = returning.basePointer - 1
+
+			err := vm.push(iter)
+			if err != nil {
+				return err
+			}
+		case opcode.OpYield:
+			if !vm.generator {
+				return object.NewError(object.GenericError, "yield outside of a generator")
+			}
+
+			vm.yielded = vm.pop()
+
+			// The value of the yield once the generator resumes
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+			return nil
+		case opcode.OpNoMatch:
+			subject := vm.pop()
+			return object.NewError(object.MatchError, "non-exhaustive match: no pattern matched %s", subject.Inspect())
+		case opcode.OpJumpNotTruthy:
+			pos := int(opcode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				frame.ip = pos - 1
+			}
+		case opcode.OpRange:
+			inclusive := opcode.ReadUint8(ins[ip+1:]) == 1
+			frame.ip += 1
+
+			step := vm.pop()
+			if step == Null {
+				step = nil
+			}
+			end := vm.pop()
+			start := vm.pop()
+
+			rng, rangeErr := object.NewRange(start, end, step, inclusive)
+			if rangeErr != nil {
+				return rangeErr
+			}
+
+			err := vm.push(rng)
+			if err != nil {
+				return err
+			}
+		case opcode.OpSpread:
+			if _, ok := vm.stack[vm.sp-1].(*object.Array); !ok {
+				return object.NewError(object.TypeError, "cannot spread %s as arguments", vm.stack[vm.sp-1].Type())
+			}
+		case opcode.OpJumpNotNull:
+			pos := int(opcode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if vm.StackTop() != Null {
+				frame.ip = pos - 1
+			} else {
+				vm.pop()
+			}
+		case opcode.OpJumpNull:
+			pos := int(opcode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if vm.StackTop() == Null {
+				frame.ip = pos - 1
+			}
+		case opcode.OpJumpMissingIndex:
+			pos := int(opcode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if object.IsMissingIndex(vm.stack[vm.sp-2], vm.stack[vm.sp-1]) {
+				vm.sp--
+				vm.stack[vm.sp-1] = Null
+				frame.ip = pos - 1
+			}
+		case opcode.OpJumpMissingMember:
+			constIndex := opcode.ReadUint16(ins[ip+1:])
+			pos := int(opcode.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+
+			name := frame.cl.Fn.Constants[constIndex].(*object.String).Value
+			obj := vm.StackTop()
+			if obj == Null || object.IsMissingMember(obj, name) {
+				vm.stack[vm.sp-1] = Null
+				frame.ip = pos - 1
+			}
 		}
 	}
 
 	return nil
 }
 
+func (vm *VM) executeBinaryOperation(op opcode.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	result, err := binaryOperation(op, left, right)
+	if err != nil {
+		return err
+	}
+
+	return vm.push(result)
+}
+
+// withPosition returns a copy of err positioned at the instruction the
+// current frame is running, unless err already has a position, leaving err
+// itself untouched in case a caught exception holds it.
+func (vm *VM) withPosition(err *object.Error) *object.Error {
+	if err.Line != 0 {
+		return err
+	}
+
+	frame := vm.currentFrame()
+	err = err.Copy()
+	err.Line, err.Column = frame.cl.Fn.PositionAt(frame.ip)
+	return err
+}
+
+// withCallFrame returns a copy of err with the call the current frame is
+// making added to its stack, where callee is the function called.
+func (vm *VM) withCallFrame(err *object.Error, callee object.Object) *object.Error {
+	frame := vm.currentFrame()
+	stackFrame := frame.cl.Fn.CallSiteAt(frame.ip)
+	if cl, ok := callee.(*object.Closure); ok && cl.Fn.Name != "" {
+		stackFrame.Function = cl.Fn.Name
+	}
+
+	err = err.Copy()
+	err.Stack = append(err.Stack, stackFrame)
+	return err
+}
+
+// callError adds the call the current frame failed to make to the stack of
+// err, as a call the error propagated out of.
+func (vm *VM) callError(err error, callee object.Object) error {
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		return err
+	}
+
+	return vm.withCallFrame(vm.withPosition(errObj), callee)
+}
+
+// thrownError returns the error that throwing val raises, which carries val
+// as its value. Throwing a caught exception raises a copy of its error
+// again, with its message, position and stack.
+func thrownError(val object.Object) *object.Error {
+	if exception, ok := val.(*object.Exception); ok {
+		return exception.Error.Copy()
+	}
+
+	message := val.Inspect()
+	if str, ok := val.(*object.String); ok {
+		message = str.Value
+	}
+
+	return &object.Error{Kind: object.GenericError, Message: message, Value: val}
+}
+
+// applyFunction calls the function under the top numArgs elements of the
+// stack, where kinds tells positional, spread and keyword arguments apart.
+// Spread arguments, which OpSpread has checked are arrays, are expanded into
+// the positional ones, which are put back on the stack for callFunction.
+func (vm *VM) applyFunction(numArgs int, kinds []object.Object) error {
+	values := make([]object.Object, numArgs)
+	copy(values, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.sp -= numArgs
+
+	args := []object.Object{}
+	kwargs := []object.KeywordArgument{}
+	for i, val := range values {
+		switch kind := kinds[i].(*object.String).Value; kind {
+		case "":
+			args = append(args, val)
+		case "...":
+			args = append(args, val.(*object.Array).Elements...)
+		default:
+			kwargs = append(kwargs, object.KeywordArgument{Name: kind, Value: val})
+		}
+	}
+
+	for _, arg := range args {
+		err := vm.push(arg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return vm.callFunction(len(args), kwargs)
+}
+
+// callFunction calls the function under the top numArgs elements of the
+// stack, which are its positional arguments.
+func (vm *VM) callFunction(numArgs int, kwargs []object.KeywordArgument) error {
+	switch callee := vm.stack[vm.sp-1-numArgs].(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs, kwargs)
+	case *object.StructType:
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+		vm.sp = vm.sp - numArgs - 1
+
+		instance, err := callee.Construct(args, kwargs)
+		if err != nil {
+			return err
+		}
+
+		return vm.push(instance)
+	case *object.Builtin:
+		if len(kwargs) > 0 {
+			return object.NewError(object.ArgumentError, "builtin functions do not accept keyword arguments, got %s", kwargs[0].Name)
+		}
+
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+		vm.sp = vm.sp - numArgs - 1
+
+		var result object.Object
+		if callee.CallFn != nil {
+			result = callee.CallFn(vm.callBack, args...)
+		} else {
+			result = callee.Fn(args...)
+		}
+		if err, ok := result.(*object.Error); ok {
+			return err
+		}
+		if result == nil {
+			result = Null
+		}
+
+		return vm.push(result)
+	default:
+		return object.NewError(object.TypeError, "not a function: %s", callee.Type())
+	}
+}
+
+// callBack calls fn with args for a builtin that is passed a function. The
+// call runs to completion on a VM of its own, as the builtin may call it
+// while this VM is in the middle of an instruction, and returns the value
+// the call returns or the error it raises.
+func (vm *VM) callBack(fn object.Object, args ...object.Object) object.Object {
+	stack := make([]object.Object, StackSize)
+	stack[0] = fn
+	copy(stack[1:], args)
+
+	// The call returns to a frame that has no instructions to run
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = NewFrame(&object.Closure{Fn: &object.CompiledFunction{}}, 0)
+
+	call := &VM{
+		stack:       stack,
+		sp:          len(args) + 1,
+		frames:      frames,
+		framesIndex: 1,
+	}
+
+	err := call.callFunction(len(args), nil)
+	if err == nil && call.framesIndex > 1 {
+		err = call.Run()
+
+		// The interpreter records no stack frame for a call a builtin
+		// makes, so drop the one for the frame that has no call site
+		if errObj, ok := err.(*object.Error); ok {
+			errObj.Stack = errObj.Stack[:len(errObj.Stack)-1]
+		}
+	}
+	if err != nil {
+		if errObj, ok := err.(*object.Error); ok {
+			return errObj
+		}
+		return object.NewError(object.GenericError, "%s", err)
+	}
+
+	return call.pop()
+}
+
+// callClosure binds the arguments of a call to the parameters of cl, with the
+// same rules and errors as the interpreter, and starts running its body.
+// Positional arguments are bound in order, with any extras collected by the
+// rest parameter, then keyword arguments by name. Parameters that are still
+// unbound are left for the body to give their default value.
+func (vm *VM) callClosure(cl *object.Closure, numArgs int, kwargs []object.KeywordArgument) error {
+	fn := cl.Fn
+	numParams := len(fn.Parameters)
+	basePointer := vm.sp - numArgs
+
+	if numArgs > numParams && fn.Rest == "" {
+		return object.NewError(object.ArgumentError, "too many arguments. got=%d, want at most %d", numArgs, numParams)
+	}
+
+	if basePointer+fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow: exceeded stack limit of %d", StackSize)
+	}
+
+	var rest *object.Array
+	if fn.Rest != "" {
+		rest = &object.Array{Elements: []object.Object{}}
+		if numArgs > numParams {
+			rest.Elements = append(rest.Elements, vm.stack[basePointer+numParams:vm.sp]...)
+			vm.sp = basePointer + numParams
+		}
+	}
+
+	for i := vm.sp - basePointer; i < numParams; i++ {
+		vm.stack[basePointer+i] = unbound
+	}
+
+	for _, kwarg := range kwargs {
+		index := -1
+		for i, param := range fn.Parameters {
+			if param == kwarg.Name {
+				index = i
+			}
+		}
+
+		if index == -1 {
+			return object.NewError(object.ArgumentError, "unexpected keyword argument %s", kwarg.Name)
+		}
+		if vm.stack[basePointer+index] != unbound {
+			return object.NewError(object.ArgumentError, "multiple values for parameter %s", kwarg.Name)
+		}
+		vm.stack[basePointer+index] = kwarg.Value
+	}
+
+	for i, param := range fn.Parameters {
+		if vm.stack[basePointer+i] == unbound && !fn.HasDefault[i] {
+			return object.NewError(object.ArgumentError, "missing argument for parameter %s", param)
+		}
+	}
+
+	if rest != nil {
+		vm.stack[basePointer+numParams] = rest
+		numParams++
+	}
+
+	// The other locals start out empty, for the functions declared in the
+	// body to tell a name the body has not bound yet
+	for i := numParams; i < fn.NumLocals; i++ {
+		vm.stack[basePointer+i] = nil
+	}
+
+	err := vm.pushFrame(NewFrame(cl, basePointer))
+	if err != nil {
+		return err
+	}
+	vm.sp = basePointer + fn.NumLocals
+
+	return nil
+}
+
+// pushClosure creates a closure of the compiled function in the given
+// constant, capturing the variables it refers to from the current frame.
+func (vm *VM) pushClosure(constIndex int) error {
+	frame := vm.currentFrame()
+	fn := frame.cl.Fn.Constants[constIndex].(*object.CompiledFunction)
+
+	free := make([]*object.Upvalue, len(fn.Captures))
+	for i, capture := range fn.Captures {
+		if capture.Local {
+			free[i] = vm.captureUpvalue(frame.basePointer + capture.Index)
+		} else {
+			free[i] = frame.cl.Free[capture.Index]
+		}
+	}
+
+	return vm.push(&object.Closure{Fn: fn, Free: free, Module: frame.cl.Module})
+}
+
+// captureUpvalue returns the upvalue of the variable in the given stack
+// slot, creating it unless another closure has already captured the
+// variable, so that all closures over a variable share it.
+func (vm *VM) captureUpvalue(slot int) *object.Upvalue {
+	for _, open := range vm.openUpvalues {
+		if open.slot == slot {
+			return open.upvalue
+		}
+	}
+
+	upvalue := &object.Upvalue{Value: &vm.stack[slot]}
+	vm.openUpvalues = append(vm.openUpvalues, openUpvalue{slot: slot, upvalue: upvalue})
+	return upvalue
+}
+
+// closeUpvalues closes the upvalues of the variables in the stack slots from
+// the given one up, which are about to be discarded.
+func (vm *VM) closeUpvalues(slot int) {
+	stillOpen := vm.openUpvalues[:0]
+	for _, open := range vm.openUpvalues {
+		if open.slot >= slot {
+			open.upvalue.Close()
+		} else {
+			stillOpen = append(stillOpen, open)
+		}
+	}
+	vm.openUpvalues = stillOpen
+}
+
+// closeLoops closes the iterators of the loops whose iterators are in the
+// stack slots from the given one up, which are about to be discarded.
+func (vm *VM) closeLoops(slot int) {
+	for len(vm.loops) > 0 && vm.loops[len(vm.loops)-1] >= slot {
+		last := vm.loops[len(vm.loops)-1]
+		vm.stack[last].(object.Iterator).Close()
+		vm.loops = vm.loops[:len(vm.loops)-1]
+	}
+}
+
+// assignedValue returns the value an assignment stores over current, which
+// is val itself unless the assignment is compound.
+func (vm *VM) assignedValue(current, val object.Object, operator opcode.Opcode) (object.Object, error) {
+	if operator == 0 {
+		return val, nil
+	}
+
+	return binaryOperation(operator, current, val)
+}
+
+// buildHash creates a hash from the keys and values interleaved in
+// stack[startIndex:endIndex].
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, object.NewError(object.TypeError, "unusable as hash key: %s", key.Type())
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}, nil
+}
+
+func nativeBoolToBooleanObject(b bool) *object.Boolean {
+	if b {
+		return True
+	}
+	return False
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
 func (vm *VM) push(obj object.Object) error {
 	if vm.sp >= StackSize {
 		return fmt.Errorf("stack overflow: exceeded stack limit of %d", StackSize)
@@ -83,3 +1128,9 @@ func (vm *VM) StackTop() object.Object {
 	}
 	return vm.stack[vm.sp-1]
 }
+
+// LastPoppedStackElem returns the value of the last expression statement that
+// was run.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.lastPoppedStackElem
+}
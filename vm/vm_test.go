@@ -7,6 +7,7 @@ import (
 	"seville/lexer"
 	"seville/object"
 	"seville/parser"
+	"strings"
 	"testing"
 )
 
@@ -29,16 +30,36 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 
 		vm := New(comp.Bytecode())
 		err = vm.Run()
+		if expected, ok := tt.expected.(*object.Error); ok {
+			testExpectedError(t, tt.input, expected, err)
+			continue
+		}
 		if err != nil {
 			t.Fatalf("vm error: %s", err)
 		}
 
-		stackElem := vm.StackTop()
+		stackElem := vm.LastPoppedStackElem()
 
 		testExpectedObject(t, tt.expected, stackElem)
 	}
 }
 
+// testExpectedError checks that running input failed with an error of the
+// expected kind and message.
+func testExpectedError(t *testing.T, input string, expected *object.Error, err error) {
+	t.Helper()
+
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		t.Errorf("expected %s from %q, got=%T (%+v)", expected.Inspect(), input, err, err)
+		return
+	}
+
+	if errObj.Kind != expected.Kind || errObj.Message != expected.Message {
+		t.Errorf("wrong error from %q. want=%q, got=%q", input, expected.Inspect(), errObj.Inspect())
+	}
+}
+
 func testExpectedObject(t *testing.T, expected interface{}, actual object.Object) {
 	t.Helper()
 
@@ -48,6 +69,61 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 		if err != nil {
 			t.Errorf("testIntegerObject failed: %s", err)
 		}
+	case bool:
+		err := testBooleanObject(expected, actual)
+		if err != nil {
+			t.Errorf("testBooleanObject failed: %s", err)
+		}
+	case string:
+		err := testStringObject(expected, actual)
+		if err != nil {
+			t.Errorf("testStringObject failed: %s", err)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+			return
+		}
+
+		for i, expectedElem := range expected {
+			err := testIntegerObject(int64(expectedElem), array.Elements[i])
+			if err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+	case map[object.HashKey]int64:
+		hash, ok := actual.(*object.Hash)
+		if !ok {
+			t.Errorf("object is not Hash. got=%T (%+v)", actual, actual)
+			return
+		}
+
+		if len(hash.Pairs) != len(expected) {
+			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d", len(expected), len(hash.Pairs))
+			return
+		}
+
+		for expectedKey, expectedValue := range expected {
+			pair, ok := hash.Pairs[expectedKey]
+			if !ok {
+				t.Errorf("no pair for given key in Pairs")
+			}
+
+			err := testIntegerObject(expectedValue, pair.Value)
+			if err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("object is not Null: %T (%+v)", actual, actual)
+		}
 	}
 }
 
@@ -70,6 +146,32 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+	}
+
+	return nil
+}
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+	}
+
+	return nil
+}
+
 func TestIntegerArithmetic(t *testing.T) {
 	tests := []vmTestCase{
 		{"1", 1},
@@ -77,7 +179,839 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"1 + 2", 3},
 		{"1 - 2", -1},
 		{"5 - 2 + 10", 13},
+		{"5 * (2 + 10)", 60},
+		{"-50 + 100 + -50", 0},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"7 % 3", 1},
+		{"2 ** 10", 1024},
+		{"1 / 0", &object.Error{Kind: object.ZeroDivisionError, Message: "division by zero: 1 / 0"}},
+		{"-true", &object.Error{Kind: object.TypeError, Message: "unknown operator: -BOOLEAN"}},
+		{"1 + true", &object.Error{Kind: object.TypeError, Message: "type mismatch: INTEGER + BOOLEAN"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"12 & 10", 8},
+		{"12 | 3", 15},
+		{"12 ^ 10", 6},
+		{"~5", -6},
+		{"1 << 10", 1024},
+		{"-16 >> 2", -4},
+		{"0xff & ~0x0f | 1 << 2", 244},
+		{"0b1010 + 0o10 - 1_000", -982},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"2 <= 2", true},
+		{"1 >= 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true == false", false},
+		{"true != false", true},
+		{"1 < 2 == true", true},
+		{"1 < 2 < 3", true},
+		{"3 > 2 > 2", false},
+		{"1 < 3 > 2 >= 2", true},
+		{"2 < 1 < 3", false},
+		{"(1 < 2 < 3) ? 10 : 20", 10},
+		{"!true", false},
+		{"!!5", true},
+		{"!null", true},
+		{"null == null", true},
+		{`"a" < "b"`, true},
+		{"[1, 2] < [1, 3]", true},
+		{"2 in [1, 2]", true},
+		{`"a" in {"a": 1}`, true},
+		{"1 < \"a\"", &object.Error{Kind: object.TypeError, Message: "type mismatch: INTEGER < STRING"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"true ? 10 : 20", 10},
+		{"false ? 10 : 20", 20},
+		{"1 ? 10 : 20", 10},
+		{"false ? 1 : true ? 2 : 3", 2},
+		{"true ? 1 + 2 : 3 - 4", 3},
+		{"false ? true : false", false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIfExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 } ", 20},
+		{"if (1 > 2) { 10 } elif (1 < 2) { 20 } else { 30 }", 20},
+		{"if (1 > 2) { 10 }", &object.Null{}},
+		{"if (false) { 10 }", &object.Null{}},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { let x = 1 }", &object.Null{}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = 2; one + two", 3},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let x = 1; let x = x + 1; x", 2},
+		{"y", &object.Error{Kind: object.NameError, Message: "identifier not found: y"}},
+		{"let x = y; let y = 1", &object.Error{Kind: object.NameError, Message: "identifier not found: y"}},
+		{"const x = 1; let y = x + 1; y", 2},
+		{"let x = 1; const x = x + 1; x", 2},
 	}
 
 	runVmTests(t, tests)
 }
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"seville"`, "seville"},
+		{`"sev" + "ille"`, "seville"},
+		{`"sev" + "ille" + "!"`, "seville!"},
+		{`"a" - "b"`, &object.Error{Kind: object.TypeError, Message: "unknown operator: STRING - STRING"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2, 3]", []int{1, 2, 3}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"{}", map[object.HashKey]int64{}},
+		{
+			"{1: 2, 2: 3}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 2,
+				(&object.Integer{Value: 2}).HashKey(): 3,
+			},
+		},
+		{
+			"{1 + 1: 2 * 2, 3 + 3: 4 * 4}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 2}).HashKey(): 4,
+				(&object.Integer{Value: 6}).HashKey(): 16,
+			},
+		},
+		{"{[]: 1}", &object.Error{Kind: object.TypeError, Message: "unusable as hash key: ARRAY"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][1]", 2},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[-1]`, "o"},
+		{"{1: 1, 2: 2}[2]", 2},
+		{"[1, 2, 3][3]", &object.Error{Kind: object.IndexError, Message: "array index out of bounds: given index 3, array length is: 3"}},
+		{"[1, 2, 3][-4]", &object.Error{Kind: object.IndexError, Message: "array index out of bounds: given index -4, array length is: 3"}},
+		{"{1: 1}[0]", &object.Error{Kind: object.KeyError, Message: "key 0 not found in hash map"}},
+		{"1[0]", &object.Error{Kind: object.TypeError, Message: "index operator not supported: INTEGER"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][:2]", []int{1, 2}},
+		{"[1, 2, 3, 4][-2:]", []int{3, 4}},
+		{"[1, 2, 3, 4][::-1]", []int{4, 3, 2, 1}},
+		{"[1, 2, 3, 4][1:100:2]", []int{2, 4}},
+		{"[1, 2, 3, 4][null:null:null]", []int{1, 2, 3, 4}},
+		{`"héllo"[1:4]`, "éll"},
+		{`"héllo"[::-2]`, "olh"},
+		{"[1, 2][::0]", &object.Error{Kind: object.ArgumentError, Message: "slice step cannot be zero"}},
+		{`[1, 2]["a":]`, &object.Error{Kind: object.TypeError, Message: "slice indices must be integers, got STRING"}},
+		{"{}[1:]", &object.Error{Kind: object.TypeError, Message: "slice operator not supported: HASH"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssignmentExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x = 2", 2},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x %= 4; x", 2},
+		{"let x = 2; x **= 3", 8},
+		{`let s = "se"; s += "ville"; s`, "seville"},
+		{"let arr = [1, 2, 3]; arr[-1] = 4; arr", []int{1, 2, 4}},
+		{"let arr = [1, 2, 3]; arr[0] += 10", 11},
+		{`let h = {"a": 1}; h["a"] *= 3; h["b"] = 2; h`, map[object.HashKey]int64{
+			(&object.String{Value: "a"}).HashKey(): 3,
+			(&object.String{Value: "b"}).HashKey(): 2,
+		}},
+		{"x = 1", &object.Error{Kind: object.NameError, Message: "cannot assign to undeclared identifier: x"}},
+		{"x += 1", &object.Error{Kind: object.NameError, Message: "identifier not found: x"}},
+		{`let x = 1; x += "a"`, &object.Error{Kind: object.TypeError, Message: "type mismatch: INTEGER + STRING"}},
+		{"let arr = [1]; arr[1] = 2", &object.Error{Kind: object.IndexError, Message: "Array index out of bounds: given index 1, array length is 1"}},
+		{`let arr = [1]; arr["a"] = 2`, &object.Error{Kind: object.TypeError, Message: "Array indices must be integers. got=*object.String"}},
+		{`let h = {}; h["a"] += 1`, &object.Error{Kind: object.KeyError, Message: "key a not found in hash map"}},
+		{`let s = "a"; s[0] = "b"`, &object.Error{Kind: object.TypeError, Message: "cannot index type of *object.String"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; if (true) { let x = 2; x }", 2},
+		{"let x = 1; if (true) { let x = 2 }; x", 1},
+		{"let x = 1; if (false) { 0 } else { let x = x + 1; x *= 10; x }", 20},
+		{"let x = 1; if (true) { x = 2 }; x", 2},
+		{"let x = 1; if (true) { let y = 2; if (true) { x += y } }; x", 3},
+		{"const x = 1; if (true) { let x = 2; x = 3; x }", 3},
+		{"if (true) { let leaked = 1 }; leaked", &object.Error{Kind: object.NameError, Message: "identifier not found: leaked"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10 }; fivePlusTen()", 15},
+		{"let one = fn() { 1 }; let two = fn() { 2 }; one() + two()", 3},
+		{"let a = fn() { 1 }; let b = fn() { a() + 1 }; let c = fn() { b() + 1 }; c()", 3},
+		{"let early = fn() { return 99; 100 }; early()", 99},
+		{"let nested = fn() { if (true) { return 1 }; 2 }; nested()", 1},
+		{"let noValue = fn() { }; noValue()", Null},
+		{"let identity = fn(a) { a }; identity(4)", 4},
+		{"let sum = fn(a, b) { let c = a + b; c }; sum(1, 2) + sum(3, 4)", 10},
+		{"let globalNum = 10; let f = fn(a) { let num = 1; globalNum - num - a }; f(2)", 7},
+		{"let fib = fn(n) { n < 2 ? n : fib(n - 1) + fib(n - 2) }; fib(15)", 610},
+		{"let double = |x| x * 2; double(21)", 42},
+		{"return 1; 2", 1},
+		{"1(2)", &object.Error{Kind: object.TypeError, Message: "not a function: INTEGER"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctionArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn(a, b = 2) { [a, b] }; f(1)", []int{1, 2}},
+		{"let f = fn(a, b = 2) { [a, b] }; f(1, 3)", []int{1, 3}},
+		{"let f = fn(a, b = a * 10) { [a, b] }; f(4)", []int{4, 40}},
+		{"let f = fn(a, b = 2, c = 3) { [a, b, c] }; f(1, c = 5)", []int{1, 2, 5}},
+		{"let f = fn(a, b) { [a, b] }; f(b = 1, a = 2)", []int{2, 1}},
+		{"let f = fn(first, ...rest) { rest }; f(1, 2, 3)", []int{2, 3}},
+		{"let f = fn(first, ...rest) { rest }; f(1)", []int{}},
+		{"let f = fn(a, b, c) { [a, b, c] }; f(...[1, 2], 3)", []int{1, 2, 3}},
+		{"let f = fn(...all) { all }; f(...[], 1, ...[2, 3])", []int{1, 2, 3}},
+		// Blocks in default values get slots apart from the parameters
+		{"let f = fn(a = if (true) { let t = 4; t } else { 0 }, b = a + 1, ...r) { [a, b, len(r)] }; f()", []int{4, 5, 0}},
+		{"let f = fn(a, b = if (true) { let t = 4; t } else { 0 }, ...r) { [a, b, len(r)] }; f(1, 2, 3)", []int{1, 2, 1}},
+		{"let f = fn(a) { a }; f(1, 2)", &object.Error{Kind: object.ArgumentError, Message: "too many arguments. got=2, want at most 1"}},
+		{"let f = fn(a, b) { a }; f(1)", &object.Error{Kind: object.ArgumentError, Message: "missing argument for parameter b"}},
+		{"let f = fn(a) { a }; f(b = 1)", &object.Error{Kind: object.ArgumentError, Message: "unexpected keyword argument b"}},
+		{"let f = fn(a) { a }; f(1, a = 2)", &object.Error{Kind: object.ArgumentError, Message: "multiple values for parameter a"}},
+		{"let f = fn(a) { a }; f(...1)", &object.Error{Kind: object.TypeError, Message: "cannot spread INTEGER as arguments"}},
+		{"len(a = 1)", &object.Error{Kind: object.ArgumentError, Message: "builtin functions do not accept keyword arguments, got a"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"let newClosure = fn(a) { fn() { a } }; let closure = newClosure(99); closure()", 99},
+		{"let adder = fn(a) { fn(b) { fn(c) { a + b + c } } }; adder(1)(2)(3)", 6},
+		{`
+		let counter = fn() {
+			let count = 0;
+			fn() { count += 1 }
+		};
+		let c = counter();
+		c(); c();
+		c()
+		`, 3},
+		{`
+		let shared = fn() {
+			let x = 1;
+			let inc = fn() { x += 1 };
+			let get = fn() { x };
+			inc(); inc();
+			[x, get()]
+		};
+		shared()
+		`, []int{3, 3}},
+		{`
+		let f = fn() {
+			let countDown = fn(x) { x == 0 ? 0 : countDown(x - 1) };
+			countDown(3)
+		};
+		f()
+		`, 0},
+		{"if (true) { let y = 10; let k = fn() { y }; k() }", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("héllo")`, 5},
+		{`len([1, 2, 3])`, 3},
+		{`push([1], 2)`, []int{1, 2}},
+		{`type("a")`, "STRING"},
+		{`type(fn() { 1 })`, "FUNCTION"},
+		{`next(iter([7, 8]))`, 7},
+		{`[x for x in map([1, 2, 3], |x| x + 1)]`, []int{2, 3, 4}},
+		{`let base = 10; let it = map([1, 2], fn(x) { base + x }); next(it); next(it)`, 12},
+		{`struct P { x }; [p.x for p in map([4], P)]`, []int{4}},
+		{`[x for x in map(["ab"], len)]`, []int{2}},
+		{`let f = fn(x) { try { x / 0 } catch (e) { 7 } }; next(map([1], f))`, 7},
+		{`next(map([1], |x| x / 0))`, &object.Error{Kind: object.ZeroDivisionError, Message: "division by zero: 1 / 0"}},
+		{`next(map([1], 5))`, &object.Error{Kind: object.TypeError, Message: "not a function: INTEGER"}},
+		{`fn gen() { yield 1; yield 2 }; let it = gen(); next(it); close(it); next(it)`, Null},
+		{`let len = fn(x) { 0 }; len("abc")`, 0},
+		{`len(1)`, &object.Error{Kind: object.TypeError, Message: "argument to `len` not supported, got INTEGER"}},
+		{`len("one", "two")`, &object.Error{Kind: object.ArgumentError, Message: "wrong number of arguments. got=2, want=1"}},
+		{`len = 1`, &object.Error{Kind: object.NameError, Message: "cannot assign to undeclared identifier: len"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctionDeclarations(t *testing.T) {
+	tests := []vmTestCase{
+		{"fn add(a, b) { a + b } add(1, 2)", 3},
+		{"let r = twice(3); fn twice(x) { x * 2 } r", 6},
+		{`
+		fn isEven(n) { n == 0 ? true : isOdd(n - 1) }
+		fn isOdd(n) { n == 0 ? false : isEven(n - 1) }
+		isOdd(7)
+		`, true},
+		{`
+		fn outer() {
+			let r = inner();
+			fn inner() { 42 }
+			r
+		}
+		outer()
+		`, 42},
+		{"if (true) { fn scoped() { 1 } }; scoped()", &object.Error{Kind: object.NameError, Message: "identifier not found: scoped"}},
+		{"fn outer() { let n = 5; fn get() { n }; get() }; outer()", 5},
+		{`
+		fn counter() {
+			let c = 0;
+			fn inc(x) { c += x; c }
+			inc
+		}
+		let inc = counter();
+		inc(2);
+		inc(3)
+		`, 5},
+		{"fn outer() { if (true) { let m = 7; fn get() { m * 2 }; get() } }; outer()", 14},
+		{"fn outer(n) { if (true) { let n = n + 1; fn get() { n }; get() } }; outer(1)", 2},
+		{
+			"fn outer() { fn get() { n }; let early = get(); let n = 1; early }; outer()",
+			&object.Error{Kind: object.NameError, Message: "identifier not found: n"},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLambdas(t *testing.T) {
+	tests := []vmTestCase{
+		{"let double = |x| x * 2; double(4)", 8},
+		{"(|a, b| a + b)(2, 3)", 5},
+		{"let answer = || 42; answer()", 42},
+		{"let adder = |x| |y| x + y; adder(2)(3)", 5},
+		{"let n = 10; let addN = |x| x + n; n = 20; addN(1)", 21},
+		{"let apply = fn(f, x) { f(x) }; apply(|x| x - 1, 5)", 4},
+		{"let f = |a, b = 2, ...rest| a + b + len(rest); f(1, 2, 3, 4)", 5},
+		{"let f = fn() { let total = 0; let add = |x| total += x; add(2); add(3); total }; f()", 5},
+	}
+
+	runVmTests(t, tests)
+}
+
+// runVmError compiles and runs input, which is expected to fail at runtime.
+func runVmError(t *testing.T, input string) *object.Error {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err := New(comp.Bytecode()).Run()
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		t.Fatalf("expected *object.Error from %q, got=%T (%+v)", input, err, err)
+	}
+
+	return errObj
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"1 + true", 1, 3},
+		{"let a = 1\n-true", 2, 1},
+		{"[1, 2][5]", 1, 7},
+		{"{\"a\": 1}[\"b\"]", 1, 9},
+		{"let f = fn() {\n  1 + true\n}\nf()", 2, 5},
+		{"let x = 1\nx()", 2, 2},
+		{"let p = fn(x) { x }; p(...5)", 1, 24},
+	}
+
+	for _, tt := range tests {
+		errObj := runVmError(t, tt.input)
+
+		if errObj.Line != tt.expectedLine || errObj.Column != tt.expectedColumn {
+			t.Errorf("wrong position for %q. expected=%d:%d, got=%d:%d",
+				tt.input, tt.expectedLine, tt.expectedColumn, errObj.Line, errObj.Column)
+		}
+	}
+}
+
+func TestErrorStackTraces(t *testing.T) {
+	input := `let inner = fn(x) {
+	x + true
+}
+let outer = fn(y) {
+	inner(y * 2)
+}
+outer(1)`
+
+	errObj := runVmError(t, input)
+
+	expectedStack := []object.StackFrame{
+		{Function: "inner", Line: 5, Column: 2},
+		{Function: "outer", Line: 7, Column: 1},
+	}
+
+	if len(errObj.Stack) != len(expectedStack) {
+		t.Fatalf("wrong stack length. expected=%d, got=%d (%+v)", len(expectedStack), len(errObj.Stack), errObj.Stack)
+	}
+
+	for i, frame := range expectedStack {
+		if errObj.Stack[i] != frame {
+			t.Errorf("wrong stack frame %d. expected=%+v, got=%+v", i, frame, errObj.Stack[i])
+		}
+	}
+}
+
+func TestErrorStackTraceFrames(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStack []string
+	}{
+		{"1 + true", []string{}},
+		{"len(1)", []string{"len"}},
+		{"let p = fn(x) { x }; p(...5)", []string{}},
+		{"let f = fn() { len(1) }; f()", []string{"len", "f"}},
+		{"fn() { 1 + true }()", []string{"<anonymous>"}},
+		{"let f = fn() { fn() { -true } }; f()()", []string{"<anonymous>"}},
+		{"fn inner() { -true }; let g = inner; g()", []string{"inner"}},
+		{"let f = fn() { fn inner() { -true } inner }; f()()", []string{"inner"}},
+		{
+			"let f = fn(n) { if (n == 0) { return 1 + true } f(n - 1) }; f(2)",
+			[]string{"f", "f", "f"},
+		},
+	}
+
+	for _, tt := range tests {
+		errObj := runVmError(t, tt.input)
+
+		names := []string{}
+		for _, frame := range errObj.Stack {
+			names = append(names, frame.Function)
+		}
+
+		if strings.Join(names, ",") != strings.Join(tt.expectedStack, ",") {
+			t.Errorf("wrong stack for %q. expected=%v, got=%v", tt.input, tt.expectedStack, names)
+		}
+	}
+}
+
+func TestTryCatchExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{"try { 1 + true; 1 } catch (e) { 2 }", 2},
+		{`try { throw 5 } catch (e) { e["value"] }`, 5},
+		{`try { throw "boom" } catch (e) { e["message"] }`, "boom"},
+		{`try { {"a": 1}["b"] } catch (e) { e["type"] }`, "KeyError"},
+		{"try {\n  [1][4]\n} catch (e) { [e[\"line\"], e[\"column\"]] }", []int{2, 6}},
+		{"try { throw 1 } catch { 2 }", 2},
+		{"1 + try { 2 + true } catch (e) { 10 }", 11},
+		{`[1, try { throw 2 } catch (e) { e["value"] * 10 }, 3]`, []int{1, 20, 3}},
+		{"let a = 1; try { let a = 2; throw a } catch (e) { a + e[\"value\"] }", 3},
+		// Errors propagate out of calls to the try around them
+		{`let f = fn() { throw "bad" }; try { f() } catch (e) { e["message"] }`, "bad"},
+		{`let f = fn(n) { if (n == 0) { throw n } 1 + f(n - 1) }; let r = try { f(5) } catch (e) { 7 }; r + 1`, 8},
+		{`try { try { throw 1 } catch (e) { throw e["value"] + 1 } } catch (e) { e["value"] }`, 2},
+		{`try { throw 1 } catch (e) { e["nope"] }`, &object.Error{Kind: object.KeyError, Message: "exception has no field nope"}},
+		{"throw 1", &object.Error{Kind: object.GenericError, Message: "1"}},
+		{"let f = fn() { try { 1 + true } catch (e) { throw e } }; f()", &object.Error{Kind: object.TypeError, Message: "type mismatch: INTEGER + BOOLEAN"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFinallyBlocks(t *testing.T) {
+	tests := []vmTestCase{
+		{"try { 1 } finally { 2 }", 1},
+		{"let x = 0; let r = try { throw 1 } catch (e) { 2 } finally { x = 5 }; [r, x]", []int{2, 5}},
+		{`let x = []; try { try { throw 1 } finally { x = push(x, 3) } } catch (e) { x = push(x, e["value"]) }; x`, []int{3, 1}},
+		{"let x = 0; let f = fn() { try { return 1 } finally { x = 9 } }; [f(), x]", []int{1, 9}},
+		// A return or error in the finally block replaces the result
+		{"let f = fn() { try { return 1 } finally { return 2 } }; f()", 2},
+		{"let f = fn() { try { throw 1 } finally { return 2 } }; f()", 2},
+		{`let f = fn() { try { 1 } finally { throw 7 } }; try { f() } catch (e) { e["value"] }`, 7},
+		// An error in a finally block run by a return is not caught by its
+		// own try
+		{`let f = fn() { try { try { return 1 } catch (e) { return 3 } finally { throw 2 } } catch (e) { return e["value"] + 10 } }; f()`, 12},
+		{
+			`let log = []; let f = fn() { try { try { return 1 } finally { log = push(log, 1) } } finally { log = push(log, 2) } }; let r = f(); push(log, r)`,
+			[]int{1, 2, 1},
+		},
+		{"let f = fn() { try { 1 + true } finally { 0 } }; f()", &object.Error{Kind: object.TypeError, Message: "type mismatch: INTEGER + BOOLEAN"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCaughtErrorStackTraces(t *testing.T) {
+	// Rethrowing a caught exception does not add to the stack it holds
+	input := `let saved = null
+let f = fn(e) { throw e }
+try { len(1) } catch (e) { saved = e }
+try { f(saved) } catch (e) { 0 }
+f(saved)`
+
+	errObj := runVmError(t, input)
+
+	expectedStack := []object.StackFrame{
+		{Function: "len", Line: 3, Column: 7},
+		{Function: "f", Line: 5, Column: 1},
+	}
+
+	if len(errObj.Stack) != len(expectedStack) {
+		t.Fatalf("wrong stack length. expected=%d, got=%d (%+v)", len(expectedStack), len(errObj.Stack), errObj.Stack)
+	}
+
+	for i, frame := range expectedStack {
+		if errObj.Stack[i] != frame {
+			t.Errorf("wrong stack frame %d. expected=%+v, got=%+v", i, frame, errObj.Stack[i])
+		}
+	}
+
+	// A closure over a variable of a frame that an error unwound keeps it
+	runVmTests(t, []vmTestCase{
+		{"let g = null; let f = fn() { let n = 3; g = fn() { n += 1 }; throw 1 }; try { f() } catch (e) { 0 }; g(); g()", 5},
+	})
+}
+
+func TestMemberExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`let h = {"a": 1}; h.a`, 1},
+		{`let h = {"a": {"b": 2}}; h.a.b * 3`, 6},
+		{`let h = {"a": 1}; h.a = 5; h.a`, 5},
+		{`let h = {"a": 1}; h.a += 5`, 6},
+		{`let h = {}; h.f = fn() { 4 }; h.f()`, 4},
+		{`try { throw "m" } catch (e) { e.message }`, "m"},
+		{`let h = {"a": 1}; h.b`, &object.Error{Kind: object.KeyError, Message: "key b not found in hash map"}},
+		{"let x = 1; x.y", &object.Error{Kind: object.TypeError, Message: "cannot access member y of INTEGER"}},
+		{"let x = [1]; x.y = 2", &object.Error{Kind: object.TypeError, Message: "cannot assign to member y of ARRAY"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestNullCoalescing(t *testing.T) {
+	tests := []vmTestCase{
+		{"null ?? 5", 5},
+		{"3 ?? 5", 3},
+		{"false ?? 5", false},
+		{"null ?? null ?? 7", 7},
+		{"null ?? null", Null},
+		{"let x = null; x ?? 1 + 1", 2},
+		{"fn() { let x = null; x ?? 4 }()", 4},
+		// The right side is not evaluated when the left side is not null
+		{"1 ?? undefined_name", 1},
+		{"null ?? undefined_name", &object.Error{Kind: object.NameError, Message: "identifier not found: undefined_name"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestOptionalChaining(t *testing.T) {
+	tests := []vmTestCase{
+		{`let h = {"a": 1}; h?.["a"]`, 1},
+		{`let h = {"a": 1}; h?.["b"] ?? 0`, 0},
+		{`let h = null; h?.["b"]`, Null},
+		{`let h = {"a": {"b": 2}}; h?.["x"]?.["b"] ?? 3`, 3},
+		{"[1, 2]?.[2]", Null},
+		{"(0..5)?.[9]", Null},
+		{"let a = null; a?.[1:][0]", Null},
+		{"let f = fn(x) { x * 2 }; f?.(4)", 8},
+		{"let f = null; f?.(undefined_name)", Null},
+		{"let f = null; f?.(1)(2)", Null},
+		{`let h = {"a": {"b": 2}}; h?.a?.b`, 2},
+		{`let h = {"a": 1}; len(h?.keys())`, 1},
+		{"let h = null; h?.k.upper()", Null},
+		{"let h = null; h?.k.j ?? 5", 5},
+		{`[x?.a ?? 0 for x in [null, {"a": 1}]]`, []int{0, 1}},
+		{`let h = {"k": {}}; h?.["k"]["j"]`, &object.Error{Kind: object.KeyError, Message: "key j not found in hash map"}},
+		{"let h = null; (h?.k).j", &object.Error{Kind: object.TypeError, Message: "cannot access member j of NULL"}},
+		{"struct P { x }; let p = P(1); p?.y", &object.Error{Kind: object.AttributeError, Message: "P has no field y"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRangeExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"len(0..10)", 10},
+		{"(0..=10 by 5)[-1]", 10},
+		{"0..3 == 0..=2", true},
+		{"let n = 5; 3 in 0..n", true},
+		{"5 in 0..5", false},
+		{"[x for x in 0..5]", []int{0, 1, 2, 3, 4}},
+		{"[x for x in 5..0 by -2]", []int{5, 3, 1}},
+		{"[x for x in take(0..10, 3)]", []int{0, 1, 2}},
+		{"fn squares(n) { [x * x for x in 0..n] }; squares(4)", []int{0, 1, 4, 9}},
+		{"0..true", &object.Error{Kind: object.TypeError, Message: "range bounds must be INTEGER, got BOOLEAN"}},
+		{"0..5 by 0", &object.Error{Kind: object.ArgumentError, Message: "range step cannot be zero"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStructs(t *testing.T) {
+	tests := []vmTestCase{
+		{"struct P { x, y }; let p = P(1, 2); p.x + p.y", 3},
+		{"struct P { x, y }; let p = P(y = 5, x = 1); [p.x, p.y]", []int{1, 5}},
+		{"struct P { x, y }; let p = P(1, y = 7); p.y", 7},
+		{"struct P { x }; let p = P(1); p.x = 4; p.x += 2; p.x", 6},
+		{"struct P { x, y }; P(1, 2) == P(1, 2)", true},
+		{"struct P { x, y }; P(1, 2) == P(2, 1)", false},
+		{"struct P { x }; type(P(1))", "P"},
+		// Each run of a declaration declares a new type
+		{"let f = fn() { struct P { x }; P(1) }; f() == f()", false},
+		{"struct P { x }; let f = fn() { P(3).x * 2 }; f()", 6},
+		{"struct P { x, y }; P(1, 2, 3)", &object.Error{Kind: object.ArgumentError, Message: "too many arguments. got=3, want at most 2"}},
+		{"struct P { x, y }; P(1)", &object.Error{Kind: object.ArgumentError, Message: "missing argument for field y"}},
+		{"struct P { x }; P(1, x = 2)", &object.Error{Kind: object.ArgumentError, Message: "multiple values for field x"}},
+		{"struct P { x }; P(z = 2)", &object.Error{Kind: object.ArgumentError, Message: "unexpected keyword argument z"}},
+		{"struct P { x }; P(1).z", &object.Error{Kind: object.AttributeError, Message: "P has no field z"}},
+		{"struct P { x }; let p = P(1); p.z = 2", &object.Error{Kind: object.AttributeError, Message: "P has no field z"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinMethods(t *testing.T) {
+	tests := []vmTestCase{
+		{`"héllo".len()`, 5},
+		{`"Hello".upper()`, "HELLO"},
+		{`"  padded  ".trim()`, "padded"},
+		{`"a,b,c".split(",")[1]`, "b"},
+		{`"seville".contains("vil")`, true},
+		{`"a-b-c".replace("-", "+")`, "a+b+c"},
+		{`let s = "x"; let up = s.upper; up()`, "X"},
+		{`let arr = [1, 2, 3]; arr.push(4)`, []int{1, 2, 3, 4}},
+		{`let arr = [1, 2, 3]; arr.push(4); arr`, []int{1, 2, 3}},
+		{`let arr = [1, 2, 3]; arr.append(4); arr`, []int{1, 2, 3, 4}},
+		{`let arr = [1, 2, 3]; arr.append(4)`, Null},
+		{`let arr = [1, 2, 3]; let last = arr.pop(); [last, len(arr)]`, []int{3, 2}},
+		{`let f = fn(a) { a.append(1) }; let arr = []; f(arr); f(arr); arr.len()`, 2},
+		{`[1, "a", true].join("-")`, "1-a-true"},
+		{`{"a": 1}.keys()[0]`, "a"},
+		{`{"a": 1}.get("b", 0)`, 0},
+		{`let h = {"a": 1, "b": 2}; h.delete("a"); h.len()`, 1},
+		{`let h = {"keys": 1}; h.keys`, 1},
+		{`"abc".reverse()`, &object.Error{Kind: object.AttributeError, Message: "STRING has no method reverse"}},
+		{`{}.missing()`, &object.Error{Kind: object.KeyError, Message: "key missing not found in hash map"}},
+		{`[].pop()`, &object.Error{Kind: object.IndexError, Message: "pop from empty array"}},
+		{`"a".split(1)`, &object.Error{Kind: object.TypeError, Message: "argument to `split` must be STRING, got INTEGER"}},
+		{`[].push(1, 2)`, &object.Error{Kind: object.ArgumentError, Message: "wrong number of arguments. got=2, want=1"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`match (1) { 1 => "one", _ => "other" }`, "one"},
+		{`match (5) { 1 => "one", _ => "other" }`, "other"},
+		{`match (-1) { -1 => "minus one", _ => "other" }`, "minus one"},
+		{`match (null) { null => 1, _ => 2 }`, 1},
+		{`match (7) { n => n * 2 }`, 14},
+		{`match ([1, 2, 3]) { [a, b] => a + b, _ => 0 }`, 0},
+		{`match ([1, 2, 3]) { [head, ...tail] => tail }`, []int{2, 3}},
+		{`match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }`, 6},
+		{`match ({"type": "circle", "r": 2}) { {"type": "square", "s": s} => s, {"type": "circle", "r": r} => r }`, 2},
+		{`match (5) { n if n > 10 => "big", n if n > 0 => "small", _ => "neg" }`, "small"},
+		{`match (5) { n => { let doubled = n * 2; doubled + 1 } }`, 11},
+		{`let f = fn(x) { match (x) { 0 => { return "zero" }, _ => 1 }; "after" }; f(0)`, "zero"},
+		{`let n = 1; match (2) { n => n }; n`, 1},
+		{`match (1) { 1 => { } }`, Null},
+		{`1 + match (2) { 1 => 10, n => n * 100 }`, 201},
+		// Closures capture the names an arm binds
+		{`let g = fn(x) { match (x) { [a, ...rest] => fn() { a + len(rest) } } }; g([5, 1, 1])()`, 7},
+		{`let f = fn() { try { match (1) { 2 => 3 } } catch (e) { e.type } }; f()`, "MatchError"},
+		{`match (3) { 1 => 1, 2 => 2 }`, &object.Error{Kind: object.MatchError, Message: "non-exhaustive match: no pattern matched 3"}},
+		{`match (1) { n if n + true => 1 }`, &object.Error{Kind: object.TypeError, Message: "type mismatch: INTEGER + BOOLEAN"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{"let [head, ...tail] = [1, 2, 3]; tail", []int{2, 3}},
+		{"let [_, second] = [1, 2]; second", 2},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", 6},
+		{`let {"name": n} = {"name": "ada", "age": 36}; n`, "ada"},
+		{`let {"pos": [x, y]} = {"pos": [3, 4]}; x * y`, 12},
+		{"let [a, b] = [1, 2]; let [a, b] = [b, a]; a * 10 + b", 21},
+		{"let f = fn(pair) { let [a, b] = pair; a - b }; f([5, 3])", 2},
+		{"let f = fn() { let [x, ...r] = [1, 2]; fn() { x + len(r) } }; f()()", 2},
+		{"const [a, b] = [1, 2]; a + b", 3},
+		{"const a = 1; if (true) { let [a] = [2]; a }", 2},
+		{"let [a, b] = [1, 2, 3]", &object.Error{Kind: object.MatchError, Message: "pattern [a, b] expects 2 elements, got 3"}},
+		{"let [a, b, ...rest] = [1]", &object.Error{Kind: object.MatchError, Message: "pattern [a, b, ...rest] expects at least 2 elements, got 1"}},
+		{"let [a, b] = 5", &object.Error{Kind: object.MatchError, Message: "pattern [a, b] expects an array, got INTEGER"}},
+		{`let {"name": n} = {"age": 36}`, &object.Error{Kind: object.MatchError, Message: "pattern {name: n} expects key name, which is missing"}},
+		{"let [1, b] = [2, 3]", &object.Error{Kind: object.MatchError, Message: "pattern 1 does not match 2"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestComprehensions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[x * 2 for x in [1, 2, 3]]", []int{2, 4, 6}},
+		{"[x for x in [3, -1, 0, 4] if x > 0]", []int{3, 4}},
+		{"[x for x in []]", []int{}},
+		{`[c + c for c in "ab"][1]`, "bb"},
+		{"[a + b for a, b in [[1, 2], [3, 4]]]", []int{3, 7}},
+		{"[h for [h, ...t] in [[1, 2], [3]] if len(t) > 0]", []int{1}},
+		{"[[y + x for y in [10, 20]] for x in [1, 2]][1]", []int{12, 22}},
+		{`let h = {"a": 1, "b": 2}; let d = {k: v * 10 for k, v in items(h)}; d["a"] + d["b"]`, 30},
+		{`let d = {x: x * x for x in [1, 2, 3] if x != 2}; len(items(d)) + d[3]`, 11},
+		{"[x * x for x in take(iter([1, 2, 3, 4]), 3)]", []int{1, 4, 9}},
+		// Closures created in an iteration keep the targets of that iteration
+		{"let fs = [|| x for x in [1, 2]]; [f() for f in fs]", []int{1, 2}},
+		{"let fs = [[|| a + b for b in [1, 2]] for a in [10, 20]]; [f() for f in fs[1]]", []int{21, 22}},
+		{"let g = fn() { let n = 5; [fn() { n + i } for i in [0, 1, 2]] }; [f() for f in g()]", []int{5, 6, 7}},
+		// The loop variable does not leak into the enclosing scope
+		{"let x = 10; [x for x in [1, 2]]; x", 10},
+		{"try { [1 / x for x in [1, 0]] } catch (e) { e.type }", "ZeroDivisionError"},
+		{"[x for x in 5]", &object.Error{Kind: object.TypeError, Message: "INTEGER is not iterable"}},
+		{"[a for a, b in [[1]]]", &object.Error{Kind: object.MatchError, Message: "pattern [a, b] expects 2 elements, got 1"}},
+		{"{[x]: 1 for x in [1]}", &object.Error{Kind: object.TypeError, Message: "unusable as hash key: ARRAY"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []vmTestCase{
+		{"fn gen() { yield 1; yield 2 }; [x for x in gen()]", []int{1, 2}},
+		{"fn gen(a, b) { yield a; yield b }; [x for x in gen(3, 4)]", []int{3, 4}},
+		{"let gen = |x| yield x * 2; [x for x in gen(5)]", []int{10}},
+		{"fn gen() { yield 1; return 5; yield 2 }; [x for x in gen()]", []int{1}},
+		{"fn gen() { yield 1 }; type(gen())", "ITERATOR"},
+		{"fn gen() { yield 1 }; let it = gen(); [next(it), next(it)][1]", Null},
+		// Generators are independent and resume where they left off
+		{"fn gen() { yield 1; yield 2 }; let a = gen(); let b = gen(); next(a); [next(a), next(b)]", []int{2, 1}},
+		{"fn gen() { yield 1; yield 2; yield 3 }; let it = gen(); next(it); [x for x in it]", []int{2, 3}},
+		// The body does not run until the first value is requested, but the
+		// call evaluates the default values
+		{`let log = []; fn gen() { log.append("ran"); yield 1 }; let it = gen(); len(log)`, 0},
+		{`let log = []; fn gen() { log.append("ran"); yield 1 }; let it = gen(); next(it); len(log)`, 1},
+		{"fn g(a, b = a * 2) { yield a; yield b }; [x for x in g(3)]", []int{3, 6}},
+		{"fn gen(a = 1 + true) { yield a }; gen()", &object.Error{Kind: object.TypeError, Message: "type mismatch: INTEGER + BOOLEAN"}},
+		// Infinite generators are fine as long as only a prefix is consumed
+		{"fn naturals(n) { yield n; [yield x for x in naturals(n + 1)] }; [x for x in take(skip(naturals(0), 3), 3)]", []int{3, 4, 5}},
+		{"let n = 0; fn gen() { n += 1; yield n; n += 1; yield n }; let r = [x for x in gen()]; [r[0], r[1], n]", []int{1, 2, 2}},
+		{"fn gen(a) { yield || a; a = 5; yield || a }; let fs = [f for f in gen(1)]; [f() for f in fs]", []int{5, 5}},
+		{"fn gen() { try { yield 1; throw 2 } catch (e) { yield e.value } finally { yield 3 } }; [x for x in gen()]", []int{1, 2, 3}},
+		// Loops abandoned by an error close their iterators
+		{"fn gen() { yield 1; yield 2 }; let it = gen(); try { [1 / (x - 1) for x in it] } catch (e) { next(it) }", Null},
+		{"let it = iter([1, 2, 3]); fn gen() { [yield x for x in it] }; let g = gen(); [x for x in take(g, 1)]; [next(g), next(it)][1]", Null},
+		{"fn gen() { yield 1; 1 + true }; [x for x in gen()]", &object.Error{Kind: object.TypeError, Message: "type mismatch: INTEGER + BOOLEAN"}},
+		{"let it = null; fn gen() { yield next(it) }; it = gen(); next(it)", &object.Error{Kind: object.GenericError, Message: "generator gen is already running"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGeneratorErrorStackTraces(t *testing.T) {
+	input := `let h = fn(x) {
+  x + true
+}
+fn gen() {
+  yield 1
+  h(2)
+}
+let it = gen()
+next(it)
+next(it)`
+
+	errObj := runVmError(t, input)
+
+	if errObj.Line != 2 || errObj.Column != 5 {
+		t.Errorf("wrong position. expected=2:5, got=%d:%d", errObj.Line, errObj.Column)
+	}
+
+	expectedStack := []object.StackFrame{
+		{Function: "h", Line: 6, Column: 3},
+		{Function: "next", Line: 10, Column: 1},
+	}
+
+	if len(errObj.Stack) != len(expectedStack) {
+		t.Fatalf("wrong stack length. expected=%d, got=%d (%+v)", len(expectedStack), len(errObj.Stack), errObj.Stack)
+	}
+
+	for i, frame := range expectedStack {
+		if errObj.Stack[i] != frame {
+			t.Errorf("wrong stack frame %d. expected=%+v, got=%+v", i, frame, errObj.Stack[i])
+		}
+	}
+}